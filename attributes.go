@@ -0,0 +1,221 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the typed attributes of the tasks
+
+// Besides its human-readable description a task carries typed attributes:
+// the material, the colour, the weld specification, the components that
+// are assembled, the quantity and the product. Every station type uses
+// some of them:
+//  - pickup: product, material, quantity
+//  - welding: product, material, weld spec, quantity
+//  - assembly: product, components, quantity
+//  - painting: product, material, colour, quantity
+//  - dropoff: product, quantity
+// A task with an attribute its station type does not use or a negative
+// quantity is invalid.
+// The attributes of the recipes of the catalogue (see catalogue.go) are
+// the parameters of the same names, the components are separated by
+// commas. A recipe step without an action gets a description rendered
+// from its attributes, e. g. paint steel bar in blue.
+// The working time of a task is the working time of its station type for
+// every unit of its quantity and, at an assembly station, for every
+// component. The setup of a station depends on an attribute (see
+// setup.go) and the attributes are part of the timing of a task (see
+// notify.go). Tasks without attributes, e. g. those of gen_task_set, keep
+// their description only.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// attribute names as they are used in recipes and setup policies
+const (
+	AttributeProduct    = "product"
+	AttributeMaterial   = "material"
+	AttributeColour     = "colour"
+	AttributeWeldSpec   = "weld_spec"
+	AttributeComponents = "components"
+	AttributeQuantity   = "quantity"
+)
+
+// typed attributes of a task, the zero value has none
+type TaskAttributes struct {
+	Product    string   `json:"product,omitempty"`    // name of the product, e. g. steel bar
+	Material   string   `json:"material,omitempty"`   // e. g. steel
+	Colour     string   `json:"colour,omitempty"`     // e. g. blue
+	WeldSpec   string   `json:"weld_spec,omitempty"`  // e. g. butt
+	Components []string `json:"components,omitempty"` // parts that are assembled
+	Quantity   int      `json:"quantity,omitempty"`   // units handled by the task, 1 if 0
+}
+
+// attributes used by each station type
+var stationAttributes = map[string][]string{
+	"pickup":   {AttributeProduct, AttributeMaterial, AttributeQuantity},
+	"welding":  {AttributeProduct, AttributeMaterial, AttributeWeldSpec, AttributeQuantity},
+	"assembly": {AttributeProduct, AttributeComponents, AttributeQuantity},
+	"painting": {AttributeProduct, AttributeMaterial, AttributeColour, AttributeQuantity},
+	"dropoff":  {AttributeProduct, AttributeQuantity},
+}
+
+// one task of a typed task set
+type TypedTask struct {
+	Station    string
+	Attributes TaskAttributes
+}
+
+// generate a task set of typed tasks, their descriptions are rendered
+// from their attributes
+// returns an error if a station is unknown or an attribute is not valid at its station
+func TypedTaskSet(controlCenter *ControlCenter, id int, tasks []TypedTask) (TaskSet, error) {
+	taskset := TaskSet{id: id, tasks: make([]*Task, len(tasks))}
+	for i, typed := range tasks {
+		facilitySet := controlCenter.facilitySet(typed.Station)
+		if facilitySet == nil {
+			return TaskSet{}, fmt.Errorf("taskset %d has unknown station %q", id, typed.Station)
+		}
+		if err := typed.Attributes.validate(typed.Station); err != nil {
+			return TaskSet{}, fmt.Errorf("taskset %d: %v", id, err)
+		}
+		taskset.tasks[i] = newTask(facilitySet, typed.Attributes.describe(typed.Station), id)
+		taskset.tasks[i].attributes = typed.Attributes
+	}
+	return taskset, nil
+}
+
+// //////////////////// Attributes //////////////////////
+
+// check that the station type uses all attributes that are set
+func (attributes TaskAttributes) validate(station string) error {
+	used, known := stationAttributes[station]
+	if !known {
+		return fmt.Errorf("unknown station %q", station)
+	}
+	for _, name := range attributes.names() {
+		if !slices.Contains(used, name) {
+			return fmt.Errorf("%s is not an attribute of %s tasks", name, station)
+		}
+	}
+	if attributes.Quantity < 0 {
+		return fmt.Errorf("negative quantity %d", attributes.Quantity)
+	}
+	return nil
+}
+
+// names of the attributes that are set
+func (attributes TaskAttributes) names() []string {
+	var names []string
+	for _, name := range []string{AttributeProduct, AttributeMaterial, AttributeColour, AttributeWeldSpec, AttributeComponents, AttributeQuantity} {
+		if attributes.value(name) != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// value of an attribute as text, empty if it is not set
+func (attributes TaskAttributes) value(name string) string {
+	switch name {
+	case AttributeProduct:
+		return attributes.Product
+	case AttributeMaterial:
+		return attributes.Material
+	case AttributeColour:
+		return attributes.Colour
+	case AttributeWeldSpec:
+		return attributes.WeldSpec
+	case AttributeComponents:
+		return strings.Join(attributes.Components, ", ")
+	case AttributeQuantity:
+		if attributes.Quantity > 0 {
+			return strconv.Itoa(attributes.Quantity)
+		}
+	}
+	return ""
+}
+
+// attributes of a task at a station taken from the parameters of the same
+// names, the components are separated by commas
+func attributesFor(station string, parameters map[string]string) (TaskAttributes, error) {
+	var attributes TaskAttributes
+	for _, name := range stationAttributes[station] {
+		value := parameters[name]
+		if value == "" {
+			continue
+		}
+		switch name {
+		case AttributeProduct:
+			attributes.Product = value
+		case AttributeMaterial:
+			attributes.Material = value
+		case AttributeColour:
+			attributes.Colour = value
+		case AttributeWeldSpec:
+			attributes.WeldSpec = value
+		case AttributeComponents:
+			for _, component := range strings.Split(value, ",") {
+				if component = strings.TrimSpace(component); component != "" {
+					attributes.Components = append(attributes.Components, component)
+				}
+			}
+		case AttributeQuantity:
+			quantity, err := strconv.Atoi(value)
+			if err != nil {
+				return TaskAttributes{}, fmt.Errorf("quantity %q is not a number", value)
+			}
+			attributes.Quantity = quantity
+		}
+	}
+	return attributes, attributes.validate(station)
+}
+
+// human-readable description of a task with the attributes at a station
+func (attributes TaskAttributes) describe(station string) string {
+	part := attributes.Product
+	if part == "" {
+		part = attributes.Material
+	}
+	if part == "" {
+		part = "part"
+	}
+	if attributes.Quantity > 1 {
+		part = fmt.Sprintf("%d x %s", attributes.Quantity, part)
+	}
+	description := stationVerbs[station] + " " + part
+	switch {
+	case station == "welding" && attributes.WeldSpec != "":
+		description += " with a " + attributes.WeldSpec + " weld"
+	case station == "assembly" && len(attributes.Components) > 0:
+		description += " from " + strings.Join(attributes.Components, ", ")
+	case station == "painting" && attributes.Colour != "":
+		description += " in " + attributes.Colour
+	}
+	return description
+}
+
+// the attributes if any is set, nil otherwise
+func (attributes TaskAttributes) typed() *TaskAttributes {
+	if attributes.names() == nil {
+		return nil
+	}
+	return &attributes
+}
+
+// units handled by a task with the attributes
+func (attributes TaskAttributes) units() int {
+	return max(attributes.Quantity, 1)
+}
+
+// //////////////////// Durations //////////////////////
+
+// working time of a task with the attributes at a station, the working time
+// of the station for every unit and every component it assembles
+func (durations Durations) workOn(station string, attributes TaskAttributes) int {
+	return durations.work(station) * attributes.units() * max(len(attributes.Components), 1)
+}
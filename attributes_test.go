@@ -0,0 +1,123 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the typed attributes of the tasks
+
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Test that typed tasks are validated against their stations and described
+func TestTypedTaskSet(t *testing.T) {
+	programTime := StartProgramTime()
+	controlCenter := BuildFactory(1, 1, 1, 1, 1, 1, 2, 1, 1, programTime)
+	taskset, err := TypedTaskSet(&controlCenter, 1, []TypedTask{
+		{"pickup", TaskAttributes{Material: "steel", Quantity: 2}},
+		{"welding", TaskAttributes{Product: "steel pot", WeldSpec: "fillet"}},
+		{"assembly", TaskAttributes{Product: "steel pot", Components: []string{"lid", "handle"}}},
+		{"painting", TaskAttributes{Product: "steel pot", Material: "steel", Colour: "green"}},
+		{"dropoff", TaskAttributes{Product: "steel pot"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"pickup 2 x steel", "weld steel pot with a fillet weld", "assemble steel pot from lid, handle", "paint steel pot in green", "dropoff steel pot"} {
+		if got := taskset.tasks[i].description; got != want {
+			t.Errorf("Task %d is described as %q, want %q", i, got, want)
+		}
+	}
+	// the setups depend on the typed attributes
+	controlCenter.PaintingStations.SetSetupPolicy(SetupPolicy{Attribute: AttributeMaterial})
+	if setup := taskset.tasks[3].setup(); setup != "steel" {
+		t.Errorf("Painting task needs the setup %q, want steel", setup)
+	}
+
+	for _, invalid := range []TypedTask{
+		{"welding", TaskAttributes{Colour: "blue"}},
+		{"dropoff", TaskAttributes{Components: []string{"lid"}}},
+		{"pickup", TaskAttributes{Quantity: -1}},
+		{"polishing", TaskAttributes{}},
+	} {
+		if _, err := TypedTaskSet(&controlCenter, 2, []TypedTask{invalid}); err == nil {
+			t.Errorf("Task %+v was accepted", invalid)
+		}
+	}
+}
+
+// Test that the catalogue takes the attributes from the parameters
+func TestRecipeAttributes(t *testing.T) {
+	programTime := StartProgramTime()
+	controlCenter := BuildFactory(1, 1, 1, 1, 1, 1, 2, 1, 1, programTime)
+	catalogue := Catalogue{"pot": {ID: "pot", Name: "steel pot", Recipe: []RecipeStep{
+		{Station: "assembly"},
+		{Station: "painting", Action: "paint {product} in {colour}"},
+	}, Parameters: map[string]string{"colour": "green", "components": "lid, handle,", "quantity": "3"}}}
+	tasksets, err := catalogue.Expand(&controlCenter, Order{Product: "pot"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assembly, painting := tasksets[0].tasks[0], tasksets[0].tasks[1]
+	if assembly.description != "assemble 3 x steel pot from lid, handle" || !slices.Equal(assembly.attributes.Components, []string{"lid", "handle"}) || assembly.attributes.Colour != "" {
+		t.Errorf("Assembly task %q has the attributes %+v", assembly.description, assembly.attributes)
+	}
+	if painting.attributes.Colour != "green" || painting.attributes.Quantity != 3 {
+		t.Errorf("Painting task has the attributes %+v", painting.attributes)
+	}
+	if _, err := catalogue.Expand(&controlCenter, Order{Product: "pot", Parameters: map[string]string{"quantity": "many"}}, 2); err == nil {
+		t.Errorf("Quantity that is not a number was accepted")
+	}
+}
+
+// Test that the working time depends on the quantity and the components
+func TestAttributeWork(t *testing.T) {
+	durations := Durations{Work: map[string]int{"assembly": 2}}
+	for _, tc := range []struct {
+		station    string
+		attributes TaskAttributes
+		want       int
+	}{
+		{"assembly", TaskAttributes{}, 2},
+		{"assembly", TaskAttributes{Quantity: 3}, 6},
+		{"assembly", TaskAttributes{Quantity: 2, Components: []string{"lid", "handle"}}, 8},
+		{"painting", TaskAttributes{Quantity: 4, Components: nil}, 4},
+	} {
+		if got := durations.workOn(tc.station, tc.attributes); got != tc.want {
+			t.Errorf("Working on %+v at %s takes %d, want %d", tc.attributes, tc.station, got, tc.want)
+		}
+	}
+
+	// painting 8 units takes longer than painting one, give or take a few time units
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 0, 0, 1, 1, 0, 0, 1, 2, programTime)
+	go controlCenter.Boot()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	painted := make(map[int]int)
+	for id, quantity := range map[int]int{1: 1, 2: 8} {
+		taskset, err := TypedTaskSet(&controlCenter, id, []TypedTask{{"pickup", TaskAttributes{Material: "steel"}}, {"painting", TaskAttributes{Material: "steel", Colour: "red", Quantity: quantity}}, {"dropoff", TaskAttributes{}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		handle, err := controlCenter.Submit(&taskset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := handle.Wait(ctx)
+		if err != nil || result.Status != taskSetCompleted {
+			t.Fatalf("Taskset %d finished with %+v, %v", id, result, err)
+		}
+		if result.Tasks[1].Attributes == nil || result.Tasks[1].Attributes.Quantity != quantity {
+			t.Errorf("Timing of the painting has the attributes %+v", result.Tasks[1].Attributes)
+		}
+		painted[quantity] = result.Tasks[1].Finished - result.Tasks[1].Started
+	}
+	if painted[8] < painted[1]+5 {
+		t.Errorf("Painting took %d time units for 8 units and %d for one", painted[8], painted[1])
+	}
+}
@@ -0,0 +1,326 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the batching of tasks at the stations
+
+// A station of a facility type with a batch policy processes several units
+// of the same kind in one cycle, e. g. a painting station paints up to 4
+// parts of the same product in the same colour at once. Tasks with typed
+// attributes (see attributes.go) are of the same kind if their attributes
+// are equal, whatever their descriptions say, tasks without attributes if
+// their descriptions are equal.
+// The first task assigned to a free station opens a batch: the station and
+// the workers are assigned as usual. Further tasks of the same kind join
+// the open batch instead of waiting for a station of their own, they get
+// the station of the batch and no workers, only their transportation
+// worker brings the part. Tasks waiting for a free station check again
+// whenever a batch opens. So that a task waiting for a station does not
+// keep the others from joining a batch, the assignment handler of a
+// facility type with batching assigns its tasks concurrently and takes the
+// workers under the claim of the worker set like the decentralised
+// dispatch mode (see decentral.go). Once the workers of the first task arrived, the
+// station waits until the batch is full or the maximum batch wait time is
+// over, closes the batch and waits for the transporters of the tasks that
+// joined before it processes all of them in one cycle.
+// A fault, a rejection by the quality check or an abort of the first task
+// fails the whole batch, tasks that joined and were aborted on their way
+// are left out. The batch wait counts towards the timeout of the watchdog
+// for the workers of the first task (see watchdog.go).
+// The first pickup of a task set is assigned together with the task set and
+// is never batched, the recorded dispatch decisions (see replay.go) only
+// contain the tasks that opened a batch.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// batch policy of a facility type, all times are in program time
+// the zero value processes one task per cycle
+type BatchPolicy struct {
+	Size    int // tasks processed in one cycle at most, 0 or 1 disables batching
+	MaxWait int // time a station waits for a batch to fill once the workers of its first task arrived
+}
+
+// open batches of a facility type
+type batchTable struct {
+	mutex  sync.Mutex
+	policy BatchPolicy
+	open   map[string]*batch // batches still taking tasks by their kind
+	opened chan struct{}     // closed and replaced whenever a batch opens
+}
+
+// tasks processed together in one cycle of a station
+type batch struct {
+	table    *batchTable
+	kind     string
+	facility *Facility
+	leader   *Task             // task that opened the batch
+	members  []*Task           // tasks that joined the batch
+	arrived  map[*Task]*Worker // transportation workers of the members at the station, only used by the station
+	closed   bool
+}
+
+// //////////////////// Configuration //////////////////////
+
+// set the batch policy of a facility type
+// must be called before the factory is booted
+func (facilitySet *FacilitySet) SetBatchPolicy(policy BatchPolicy) {
+	if policy.Size <= 1 {
+		facilitySet.batching = nil
+		return
+	}
+	facilitySet.batching = &batchTable{policy: policy, open: make(map[string]*batch), opened: make(chan struct{})}
+}
+
+// the batch policy of a facility type
+func (facilitySet *FacilitySet) batchPolicy() BatchPolicy {
+	if facilitySet.batching == nil {
+		return BatchPolicy{}
+	}
+	return facilitySet.batching.policy
+}
+
+// //////////////////// Assigning //////////////////////
+
+// assign the task in the handler of its facility type
+// the tasks of a facility type with batching are assigned concurrently
+func (controlCenter *ControlCenter) handleAssignment(task *Task, workers *WorkerSet, n int) {
+	if task.FacilityType.batching == nil {
+		controlCenter.assign(task, workers, n)
+		return
+	}
+	go controlCenter.assign(task, workers, n)
+}
+
+// wait for a free facility of the task's type or an open batch of the same kind
+// returns the facility and whether the task joined its batch,
+// nil if the task was aborted meanwhile
+func (controlCenter *ControlCenter) awaitFacility(task *Task, decision *decision) (*Facility, bool) {
+	if task.FacilityType.batching == nil {
+		return decision.facilityFor(task, task.aborted()), false
+	}
+	for {
+		facility, opened := controlCenter.joinBatch(task)
+		if facility != nil {
+			return facility, true
+		}
+		// stop waiting for a facility when a batch opens
+		interrupt := make(chan struct{})
+		stop := make(chan struct{})
+		go func() {
+			select {
+			case <-task.aborted():
+			case <-opened:
+			case <-stop:
+				return
+			}
+			close(interrupt)
+		}()
+		facility = decision.facilityFor(task, interrupt)
+		close(stop)
+		if facility != nil {
+			return facility, false
+		}
+		select {
+		case <-task.aborted():
+			return nil, false
+		default:
+		}
+	}
+}
+
+// join an open batch of the same kind as the task
+// returns the station of the batch, or nil and a channel that is closed
+// when the next batch opens if there is none
+func (controlCenter *ControlCenter) joinBatch(task *Task) (*Facility, <-chan struct{}) {
+	table := task.FacilityType.batching
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	batch := table.open[task.batchKind()]
+	if batch == nil {
+		return nil, table.opened
+	}
+	batch.members = append(batch.members, task)
+	if batch.full() {
+		batch.close()
+	}
+	task.Facility = batch.facility
+	now := controlCenter.ProgramTime.GetCurrentTime()
+	task.enterStage(stageWorkers, now)
+	task.assignedAt(now)
+	// print task X joins the batch at facility Y
+	controlCenter.events.println("[", task.tasksetID, "]", "🧺: task", task.description, "joins the batch of taskset", batch.leader.tasksetID, "at", batch.facility.facilityType, "station", batch.facility.id)
+	return batch.facility, nil
+}
+
+// open a batch at the station assigned to the task
+// must be called before the task is sent to the station
+func (facility *Facility) openBatch(task *Task) {
+	table := task.FacilityType.batching
+	if table == nil {
+		return
+	}
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	facility.batch = &batch{table: table, kind: task.batchKind(), facility: facility, leader: task, arrived: make(map[*Task]*Worker)}
+	// a batch of the same kind opened at the same time keeps taking the tasks
+	if _, open := table.open[facility.batch.kind]; !open {
+		table.open[facility.batch.kind] = facility.batch
+	}
+	close(table.opened)
+	table.opened = make(chan struct{})
+}
+
+// kind of a task, batches only take tasks of the same kind
+func (task *Task) batchKind() string {
+	if task.attributes.typed() == nil {
+		return task.description
+	}
+	var kind []string
+	for _, name := range task.attributes.names() {
+		kind = append(kind, name+"="+task.attributes.value(name))
+	}
+	return strings.Join(kind, "; ")
+}
+
+// check if the batch takes no more tasks, the table must be locked
+func (batch *batch) full() bool {
+	return 1+len(batch.members) >= batch.table.policy.Size
+}
+
+// take no more tasks, the table must be locked
+func (batch *batch) close() {
+	if batch.closed {
+		return
+	}
+	batch.closed = true
+	if batch.table.open[batch.kind] == batch {
+		delete(batch.table.open, batch.kind)
+	}
+}
+
+// tasks that joined the batch so far
+func (batch *batch) joined() []*Task {
+	batch.table.mutex.Lock()
+	defer batch.table.mutex.Unlock()
+	return append([]*Task(nil), batch.members...)
+}
+
+// //////////////////// Processing //////////////////////
+
+// take the transportation worker of a task that joined the batch of the station
+// returns false if the task is not part of the batch
+func (facility *Facility) admit(arrival Arrival) bool {
+	if facility.batch == nil {
+		return false
+	}
+	for _, member := range facility.batch.joined() {
+		if member == arrival.task {
+			facility.events.println("[", member.tasksetID, "]", arrival.worker.to_emoji(), " ➢ 🧺: ", arrival.worker.specialization.specialization, " worker", arrival.worker.id, "arrived at", facility.facilityType, "station", facility.id)
+			facility.batch.arrived[member] = arrival.worker
+			return true
+		}
+	}
+	return false
+}
+
+// wait until the batch of the station is full or the maximum batch wait time
+// is over, close it and wait for the transportation workers of the tasks
+// that joined, tasks aborted on their way are left out
+// returns false if the first task is aborted meanwhile
+func (facility *Facility) gatherBatch(leader *Task, workers []*Worker) bool {
+	batch := facility.batch
+	if batch == nil {
+		return true
+	}
+	deadline := facility.programTime.GetCurrentTime() + batch.table.policy.MaxWait
+	for {
+		batch.table.mutex.Lock()
+		done := batch.full() || facility.programTime.GetCurrentTime() >= deadline
+		if done {
+			batch.close()
+		}
+		batch.table.mutex.Unlock()
+		// the members are fixed once the batch is closed
+		if done && batch.onTheirWay() == 0 {
+			break
+		}
+		select {
+		case arrival := <-facility.workerArrival:
+			if !facility.admit(arrival) {
+				arrival.worker.task_completed <- false
+			}
+		case <-facility.programTime.After(1):
+		case <-leader.aborted():
+			return false
+		}
+	}
+	now := facility.programTime.GetCurrentTime()
+	for member, transporter := range batch.arrived {
+		member.enterStage(stageProcessing, now)
+		// the workers of the batch and the transportation worker of the member
+		handlers := []*Worker{transporter}
+		for _, worker := range workers {
+			if worker.specialization.specialization != "transport" {
+				handlers = append(handlers, worker)
+			}
+		}
+		member.handledBy(handlers, now)
+	}
+	if len(batch.arrived) > 0 {
+		// print batch of N tasks at facility Y
+		facility.events.println("[", leader.tasksetID, "]", "🧺: batch of", 1+len(batch.arrived), "tasks", leader.description, "at", facility.facilityType, "station", facility.id)
+	}
+	return true
+}
+
+// number of members whose transportation worker did not arrive yet and was not aborted
+func (batch *batch) onTheirWay() int {
+	n := 0
+	for _, member := range batch.joined() {
+		if _, arrived := batch.arrived[member]; arrived {
+			continue
+		}
+		select {
+		case <-member.aborted():
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// notify the workers at the station and the transportation workers of the
+// tasks that joined its batch whether their task is completed
+// the batch is over then, a failed batch aborts all tasks that joined it
+func (facility *Facility) notify(workers []*Worker, completed bool) {
+	batch := facility.batch
+	if batch == nil {
+		notifyWorkers(workers, completed)
+		return
+	}
+	facility.batch = nil
+	batch.table.mutex.Lock()
+	batch.close()
+	batch.table.mutex.Unlock()
+	batch.leader.batched = 1 + len(batch.arrived)
+	notifyWorkers(workers, completed)
+	reason := batch.leader.abortReason()
+	if reason == "" {
+		reason = fmt.Sprintf("batch of taskset %d at %s station %d was given up", batch.leader.tasksetID, facility.facilityType, facility.id)
+	}
+	for _, member := range batch.joined() {
+		if !completed {
+			member.cancel(reason)
+		}
+		if transporter, arrived := batch.arrived[member]; arrived {
+			member.batched = batch.leader.batched
+			transporter.task_completed <- completed
+		}
+	}
+}
@@ -0,0 +1,151 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the batching of tasks
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// submit an order of painting task sets and wait for them
+func paintOrder(t *testing.T, controlCenter *ControlCenter, orders []Order) []TaskSetResult {
+	catalogue := Catalogue{"sign": {ID: "sign", Name: "metal sign", Recipe: []RecipeStep{
+		{Station: "pickup", Action: "pickup {product}"},
+		{Station: "painting", Action: "paint {product} in {colour}"},
+		{Station: "dropoff", Action: "dropoff {product}"},
+	}, Parameters: map[string]string{"colour": "blue"}}}
+	return submitOrders(t, controlCenter, catalogue, orders)
+}
+
+// submit orders of a catalogue and wait for their task sets
+func submitOrders(t *testing.T, controlCenter *ControlCenter, catalogue Catalogue, orders []Order) []TaskSetResult {
+	var handles []*TaskSetHandle
+	id := 1
+	for _, order := range orders {
+		tasksets, err := catalogue.Expand(controlCenter, order, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range tasksets {
+			handle, err := controlCenter.Submit(&tasksets[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			handles = append(handles, handle)
+		}
+		id += len(tasksets)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var results []TaskSetResult
+	for _, handle := range handles {
+		result, err := handle.Wait(ctx)
+		if err != nil || result.Status != taskSetCompleted {
+			t.Fatalf("Taskset %d finished with %+v, %v", handle.ID(), result, err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Test that a painting station paints parts of the same colour in one cycle
+func TestBatching(t *testing.T) {
+	for _, mode := range []string{DispatchCentral, DispatchDecentral} {
+		programTime := StartSimulatedTime(0, 5*time.Millisecond)
+		// 1 painting station and 1 painter for 5 parts carried at the same time
+		controlCenter := BuildFactory(5, 0, 0, 1, 5, 0, 0, 1, 5, programTime)
+		controlCenter.PaintingStations.SetBatchPolicy(BatchPolicy{Size: 4, MaxWait: 3})
+		if err := controlCenter.SetDispatchMode(mode); err != nil {
+			t.Fatal(err)
+		}
+		go controlCenter.Boot()
+
+		results := paintOrder(t, &controlCenter, []Order{{Product: "sign", Quantity: 4}, {Product: "sign", Parameters: map[string]string{"colour": "red"}}})
+
+		// the blue signs are painted in one cycle, the red one on its own
+		for _, result := range results {
+			painting := result.Tasks[1]
+			want := 4
+			if painting.Description == "paint metal sign in red" {
+				want = 1
+			}
+			if painting.Batched != want {
+				t.Errorf("Painting of taskset %d was batched with %d tasks, want %d in the %s mode", result.ID, painting.Batched, want, mode)
+			}
+		}
+		if painting, _ := controlCenter.State().Facility("painting", 0); painting.TasksDone != 2 {
+			t.Errorf("Painting station worked %d cycles, want 2 in the %s mode", painting.TasksDone, mode)
+		}
+	}
+}
+
+// Test that tasks with equal attributes are batched whatever their descriptions say
+func TestBatchAttributes(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(4, 0, 0, 1, 4, 0, 0, 1, 4, programTime)
+	controlCenter.PaintingStations.SetBatchPolicy(BatchPolicy{Size: 4, MaxWait: 3})
+	go controlCenter.Boot()
+	defer controlCenter.Shutdown()
+
+	// both products paint a metal sign in blue, worded differently
+	catalogue := Catalogue{
+		"sign": {ID: "sign", Name: "metal sign", Recipe: []RecipeStep{
+			{Station: "pickup", Action: "pickup {product}"},
+			{Station: "painting", Action: "paint {product} in {colour}"},
+			{Station: "dropoff", Action: "dropoff {product}"},
+		}, Parameters: map[string]string{"colour": "blue"}},
+		"coated": {ID: "coated", Name: "metal sign", Recipe: []RecipeStep{
+			{Station: "pickup", Action: "pickup {product}"},
+			{Station: "painting", Action: "coat {product} with {colour} paint"},
+			{Station: "dropoff", Action: "dropoff {product}"},
+		}, Parameters: map[string]string{"colour": "blue"}},
+	}
+	results := submitOrders(t, &controlCenter, catalogue, []Order{{Product: "sign", Quantity: 2}, {Product: "coated", Quantity: 2}})
+	for _, result := range results {
+		if painting := result.Tasks[1]; painting.Batched != 4 {
+			t.Errorf("Painting %q of taskset %d was batched with %d tasks, want 4", painting.Description, result.ID, painting.Batched)
+		}
+	}
+	if painting, _ := controlCenter.State().Facility("painting", 0); painting.TasksDone != 1 {
+		t.Errorf("Painting station worked %d cycles, want 1", painting.TasksDone)
+	}
+}
+
+// Test that a station does not wait longer than the maximum batch wait time
+func TestBatchWait(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 0, 0, 1, 1, 0, 0, 1, 1, programTime)
+	controlCenter.PaintingStations.SetBatchPolicy(BatchPolicy{Size: 4, MaxWait: 3})
+	go controlCenter.Boot()
+
+	// a single transport worker never brings a second part in time
+	results := paintOrder(t, &controlCenter, []Order{{Product: "sign", Quantity: 2}})
+	for _, result := range results {
+		if painting := result.Tasks[1]; painting.Batched != 1 {
+			t.Errorf("Painting of taskset %d was batched with %d tasks", result.ID, painting.Batched)
+		}
+	}
+	if painting, _ := controlCenter.State().Facility("painting", 0); painting.TasksDone != 2 {
+		t.Errorf("Painting station worked %d cycles, want 2", painting.TasksDone)
+	}
+}
+
+// Test that a failed batch is retried by all of its tasks
+func TestBatchFailure(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(3, 0, 0, 1, 3, 0, 0, 1, 3, programTime)
+	controlCenter.PaintingStations.SetBatchPolicy(BatchPolicy{Size: 3, MaxWait: 3})
+	controlCenter.PaintingStations.SetQualityCheck(0.5)
+	go controlCenter.Boot()
+
+	for _, result := range paintOrder(t, &controlCenter, []Order{{Product: "sign", Quantity: 3}}) {
+		if painting := result.Tasks[1]; !painting.Completed || painting.Batched < 1 {
+			t.Errorf("Painting of taskset %d is %+v", result.ID, painting)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the batteries of the workers and the charging stations
+
+// With a battery policy every worker has a battery that starts full. Every
+// commute takes some energy and so does the work on a task at a station,
+// which is taken when the worker arrives there. A battery never drops below
+// empty, a worker with an empty battery still finishes its task and the
+// state store counts that it ran empty.
+// A worker whose battery is below the threshold when it is back at the
+// control center goes to a free charging station before it takes the next
+// task, a transportation worker once all task sets of its load are
+// finished. The charging stations are a facility type of their own that
+// only charges batteries, a battery is charged at the charge rate until it
+// is full. Without charging stations the workers never charge.
+// The battery levels are part of the status of the workers (see state.go)
+// and of snapshots (see snapshot.go), the state store counts the charges,
+// the time spent charging and waiting for a charging station.
+
+package main
+
+import (
+	"sync"
+)
+
+// batteries of the workers and their charging
+type BatteryPolicy struct {
+	Capacity   int // energy of a full battery, 0 means the workers have no batteries
+	Commute    int // energy taken by one commute
+	Work       int // energy taken by the work on one task at a station
+	Threshold  int // a worker below it charges once its current task is finished
+	ChargeRate int // energy charged per time unit, 1 if 0
+	Stations   int // number of charging stations
+}
+
+// charging of the batteries, all times are in program time
+type BatteryMetrics struct {
+	Charges      int
+	ChargingTime int // time the workers spent at the charging stations
+	Waited       int // time the workers waited for a free charging station
+	Depleted     int // number of times a battery ran empty
+}
+
+// battery of a worker
+type battery struct {
+	mutex sync.Mutex
+	level int
+}
+
+// battery policy and charging stations shared by all worker sets
+type powerSupply struct {
+	policy   BatteryPolicy
+	stations *FacilitySet
+}
+
+// give every worker a battery and build the charging stations
+// must be called before the factory is booted
+func (controlCenter *ControlCenter) SetBatteryPolicy(policy BatteryPolicy) {
+	stations := controlCenter.ChargingStations
+	stations.facilities = make([]*Facility, policy.Stations)
+	stations.freeFacilities = make(chan *Facility, policy.Stations)
+	for i := range stations.facilities {
+		stations.facilities[i] = newFacility(i, "charging", controlCenter.ProgramTime, controlCenter.state, controlCenter.events)
+	}
+	controlCenter.power.policy = policy
+	for _, workerSet := range []*WorkerSet{controlCenter.AssemblyWorkers, controlCenter.WeldingWorkers, controlCenter.PaintingWorkers, controlCenter.TransportWorkers} {
+		for _, worker := range workerSet.workers {
+			worker.battery.level = policy.Capacity
+			controlCenter.state.battery(workerSet.specialization, worker, policy.Capacity)
+		}
+	}
+}
+
+// //////////////////// Draining //////////////////////
+
+// take energy from the battery of the worker
+func (worker *Worker) drain(energy int) {
+	power := worker.specialization.power
+	if power.policy.Capacity == 0 || energy == 0 {
+		return
+	}
+	worker.battery.mutex.Lock()
+	defer worker.battery.mutex.Unlock()
+	if worker.battery.level > 0 && worker.battery.level <= energy {
+		// print worker W ran empty
+		worker.specialization.events.println("🪫:", worker.specialization.specialization, "worker", worker.id, "ran empty")
+		worker.specialization.state.depleted()
+	}
+	worker.battery.level = max(worker.battery.level-energy, 0)
+	worker.specialization.state.battery(worker.specialization.specialization, worker, worker.battery.level)
+}
+
+// energy left in the battery of the worker
+func (worker *Worker) level() int {
+	worker.battery.mutex.Lock()
+	defer worker.battery.mutex.Unlock()
+	return worker.battery.level
+}
+
+// //////////////////// Charging //////////////////////
+
+// charge the battery of a worker that is back at the control center if it
+// is below the threshold
+// gives up once the factory is shut down
+func (worker *Worker) recharge() {
+	power := worker.specialization.power
+	policy := power.policy
+	if policy.Capacity == 0 || len(power.stations.facilities) == 0 || worker.level() >= policy.Threshold {
+		return
+	}
+	programTime := worker.specialization.programTime
+	state := worker.specialization.state
+	state.worker(worker, statusCharging, 0)
+	requested := programTime.GetCurrentTime()
+	station := power.stations.acquire(programTime.Stopped(), nil)
+	if station == nil {
+		return
+	}
+	waited := programTime.GetCurrentTime() - requested
+	state.facility(station, statusCharging, 0)
+	// print worker W goes to charging station C
+	worker.specialization.events.println("🔋:", worker.specialization.specialization, "worker", worker.id, "goes to charging station", station.id, "with", worker.level(), "energy left")
+	worker.commute()
+	// charge until the battery is full
+	rate := max(policy.ChargeRate, 1)
+	duration := (policy.Capacity - worker.level() + rate - 1) / rate
+	if !programTime.WaitRunning(duration) {
+		return
+	}
+	worker.battery.mutex.Lock()
+	worker.battery.level = policy.Capacity
+	worker.battery.mutex.Unlock()
+	state.battery(worker.specialization.specialization, worker, policy.Capacity)
+	state.charged(duration, waited)
+	station.free(power.stations.freeFacilities)
+	worker.commute()
+}
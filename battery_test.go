@@ -0,0 +1,83 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the batteries of the workers
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// run a task set through a factory with batteries and wait for the
+// transportation worker to be back at the control center
+func runOnBattery(t *testing.T, policy BatteryPolicy) ControlCenter {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 0, 0, 1, 1, 0, 0, 1, 1, programTime)
+	controlCenter.SetBatteryPolicy(policy)
+	go controlCenter.Boot()
+	runTaskSet(t, &controlCenter, gen_task_set(&controlCenter, 1, []string{"pickup", "painting", "dropoff"}, []string{"pickup sign", "paint sign in red", "dropoff sign"}))
+	deadline := time.Now().Add(10 * time.Second)
+	for controlCenter.State().FreeWorkers("transport") == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return controlCenter
+}
+
+// battery levels of the workers by specialization
+func batteryLevels(state FactoryState) map[string]int {
+	levels := make(map[string]int)
+	for _, worker := range state.Workers {
+		levels[worker.Specialization] = worker.Battery
+	}
+	return levels
+}
+
+// Test that a worker below the threshold charges after its task
+func TestBatteryCharging(t *testing.T) {
+	controlCenter := runOnBattery(t, BatteryPolicy{Capacity: 20, Commute: 1, Work: 2, Threshold: 12, ChargeRate: 5, Stations: 1})
+	defer controlCenter.Shutdown()
+	state := controlCenter.State()
+	// the transportation worker took 10 for three tasks and the way back,
+	// charged 11 in 3 time units and came back from the charging station
+	want := BatteryMetrics{Charges: 1, ChargingTime: 3}
+	if state.Batteries != want {
+		t.Errorf("Battery metrics are %+v, want %+v", state.Batteries, want)
+	}
+	if levels := batteryLevels(state); levels["transport"] != 19 || levels["painting"] != 16 {
+		t.Errorf("Battery levels are %v", levels)
+	}
+	if state.FreeFacilities("charging") != 1 {
+		t.Errorf("Charging station is not free: %+v", state.Facilities)
+	}
+
+	// the battery levels are kept in snapshots
+	controlCenter.Pause()
+	snapshot, err := controlCenter.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := RestoreFactory(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Shutdown()
+	if levels := batteryLevels(restored.State()); levels["transport"] != 19 || levels["painting"] != 16 || restored.power.policy != snapshot.Battery {
+		t.Errorf("Restored battery levels are %v", levels)
+	}
+}
+
+// Test that the workers run empty without charging stations
+func TestBatteryDepleted(t *testing.T) {
+	controlCenter := runOnBattery(t, BatteryPolicy{Capacity: 5, Commute: 1, Work: 2, Threshold: 3})
+	defer controlCenter.Shutdown()
+	state := controlCenter.State()
+	if state.Batteries != (BatteryMetrics{Depleted: 1}) {
+		t.Errorf("Battery metrics are %+v", state.Batteries)
+	}
+	if levels := batteryLevels(state); levels["transport"] != 0 || levels["painting"] != 1 {
+		t.Errorf("Battery levels are %v", levels)
+	}
+}
@@ -0,0 +1,176 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the throughput and latency benchmarks of the dispatcher
+
+// Every benchmark drives thousands of task sets through a factory of a
+// given size under a fast simulated clock and reports
+//  - the throughput in task sets per unit of program time
+//  - the p50, p95 and p99 latency of a task set in units of program time,
+//    from its submission to its completion
+//  - the contention of the busiest handler of the control center: the share
+//    of the run it was busy and the mean time a request waited for it
+// The factory prints every event, run the benchmarks with e. g.
+//   go test -run '^$' -bench Dispatcher | grep -v '^$' | grep Benchmark
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// real duration of one unit of program time in the benchmarks
+const benchTick = time.Millisecond
+
+// task set routes of the benchmarks, used in turns
+var benchRoutes = [][]string{
+	{"pickup", "welding", "assembly", "painting", "dropoff"},
+	{"pickup", "painting", "dropoff"},
+	{"pickup", "assembly", "dropoff"},
+	{"pickup", "welding", "dropoff"},
+}
+
+// results of one run of the benchmark
+type benchRun struct {
+	elapsed   int           // program time from the first submission to the last completion
+	real      time.Duration // real time of the run
+	latencies []int         // program time from submission to completion of every task set
+	handlers  []HandlerStatus
+}
+
+// drive the task sets through a factory with the given number of facilities
+// of each type and workers of each specialization in the given dispatch mode
+func runDispatcher(tb testing.TB, mode string, facilities, workers, tasksets int) benchRun {
+	programTime := StartSimulatedTime(0, benchTick)
+	controlCenter := BuildFactory(facilities, facilities, facilities, facilities, facilities, workers, workers, workers, workers, programTime)
+	if err := controlCenter.SetDispatchMode(mode); err != nil {
+		tb.Fatal(err)
+	}
+	go controlCenter.Boot()
+	defer controlCenter.Shutdown()
+
+	start, started := programTime.GetCurrentTime(), time.Now()
+	handles := make([]*TaskSetHandle, 0, tasksets)
+	for id := 1; id <= tasksets; id++ {
+		route := benchRoutes[id%len(benchRoutes)]
+		descriptions := make([]string, len(route))
+		for i, station := range route {
+			descriptions[i] = station + " steel bar"
+		}
+		taskset := gen_task_set(&controlCenter, id, route, descriptions)
+		handle, err := controlCenter.Submit(&taskset)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		handles = append(handles, handle)
+	}
+
+	// every task set is done after a few units of program time per task set
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(100*tasksets)*benchTick+time.Minute)
+	defer cancel()
+	run := benchRun{latencies: make([]int, 0, tasksets)}
+	for _, handle := range handles {
+		result, err := handle.Wait(ctx)
+		if err != nil {
+			tb.Fatalf("Taskset %d is not finished: %v", handle.ID(), err)
+		}
+		if result.Status != taskSetCompleted {
+			tb.Fatalf("Taskset %d finished with %+v", handle.ID(), result)
+		}
+		run.latencies = append(run.latencies, result.Time-result.Submitted)
+		run.elapsed = max(run.elapsed, result.Time-start)
+	}
+	run.real = time.Since(started)
+	run.handlers = controlCenter.State().Handlers
+	return run
+}
+
+// handler that was busy for the longest time
+func busiestHandler(handlers []HandlerStatus) HandlerStatus {
+	var busiest HandlerStatus
+	for _, handler := range handlers {
+		if handler.Busy > busiest.Busy {
+			busiest = handler
+		}
+	}
+	return busiest
+}
+
+// Benchmark both dispatch modes with factories of increasing size
+func BenchmarkDispatcher(b *testing.B) {
+	const tasksets = 1000
+	for _, size := range []struct {
+		mode                string
+		facilities, workers int
+	}{
+		{DispatchCentral, 1, 2},
+		{DispatchCentral, 2, 4},
+		{DispatchCentral, 4, 8},
+		{DispatchCentral, 8, 16},
+		{DispatchCentral, 16, 32},
+		{DispatchDecentral, 1, 2},
+		{DispatchDecentral, 2, 4},
+		{DispatchDecentral, 4, 8},
+		{DispatchDecentral, 8, 16},
+		{DispatchDecentral, 16, 32},
+	} {
+		b.Run(fmt.Sprintf("mode=%s/facilities=%d/workers=%d", size.mode, size.facilities, size.workers), func(b *testing.B) {
+			var runs []benchRun
+			for i := 0; i < b.N; i++ {
+				runs = append(runs, runDispatcher(b, size.mode, size.facilities, size.workers, tasksets))
+			}
+
+			var latencies []int
+			elapsed, handled := 0, 0
+			var real, busy, waited time.Duration
+			var busiest HandlerStatus
+			for _, run := range runs {
+				latencies = append(latencies, run.latencies...)
+				elapsed += run.elapsed
+				real += run.real
+				busiest = busiestHandler(run.handlers)
+				busy += busiest.Busy
+				waited += busiest.Waited
+				handled += busiest.Handled
+			}
+			b.ReportMetric(float64(tasksets*b.N)/float64(elapsed), "tasksets/tick")
+			b.ReportMetric(float64(percentile(latencies, 50)), "p50-ticks")
+			b.ReportMetric(float64(percentile(latencies, 95)), "p95-ticks")
+			b.ReportMetric(float64(percentile(latencies, 99)), "p99-ticks")
+			b.ReportMetric(float64(busy)/float64(real), "busiest-handler-load")
+			b.ReportMetric(float64(waited)/float64(benchTick)/float64(max(handled, 1)), "handler-wait-ticks/req")
+			b.Logf("busiest handler of the last run: %s", busiest.Station)
+		})
+	}
+}
+
+// Test that the harness drives task sets through a factory under the fast clock
+func TestDispatcherHarness(t *testing.T) {
+	run := runDispatcher(t, DispatchCentral, 1, 2, 20)
+
+	// 20 task sets are done in far less than a second of real time per task
+	if len(run.latencies) != 20 || run.elapsed <= 0 {
+		t.Fatalf("Run finished %d task sets in %d units of program time", len(run.latencies), run.elapsed)
+	}
+	if p50, p99 := percentile(run.latencies, 50), percentile(run.latencies, 99); p50 <= 0 || p99 < p50 {
+		t.Errorf("Latencies have p50 %d and p99 %d", p50, p99)
+	}
+
+	// every handler of a station on the routes served requests
+	handled := make(map[string]int)
+	for _, handler := range run.handlers {
+		handled[handler.Station] = handler.Handled
+	}
+	for _, station := range []string{dispatchStation, "welding", "assembly", "painting", "dropoff"} {
+		if handled[station] == 0 {
+			t.Errorf("Handler of %s served no requests: %+v", station, run.handlers)
+		}
+	}
+	if handled[dispatchStation] != 20 {
+		t.Errorf("Request handler dispatched %d task sets, want 20", handled[dispatchStation])
+	}
+}
@@ -0,0 +1,208 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the static capacity planner of a factory layout
+
+// The planner computes how long every kind of resource is occupied by a
+// task set of the expected order mix, without running the factory:
+//  - a facility from its assignment until the task is done, i. e. while the
+//    workers commute to it and while it works
+//  - a worker of a station from its assignment until it is back at the
+//    control center, i. e. commuting there, working and commuting back
+//  - a transportation worker from the dispatch until it is back at the
+//    control center, i. e. commuting to and working at every station of
+//    the route and commuting back
+// Welding takes 2 welders, assembly 1 assembler and painting 1 painter,
+// every task takes the transportation worker of the task set.
+// With these demands, a resource of n units can serve n/demand task sets
+// per unit of program time. The resource with the lowest of these limits
+// is the bottleneck and its limit the theoretical maximum throughput.
+// Waiting, faults, retries, breakdowns and maintenance are not taken into
+// account, so the real throughput stays below the maximum.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// workers a station requires besides the transportation worker
+var stationWorkers = map[string]struct {
+	specialization string
+	n              int
+}{
+	"pickup":   {"", 0},
+	"welding":  {"welding", 2},
+	"assembly": {"assembly", 1},
+	"painting": {"painting", 1},
+	"dropoff":  {"", 0},
+}
+
+// durations of the factory in program time
+type Durations struct {
+	Commute int            // traveling between the control center and a facility or two facilities
+	Work    map[string]int // working on a task, by station type, 1 if not given
+}
+
+// durations of the factory as it is simulated
+func FactoryDurations() Durations {
+	return Durations{Commute: 1, Work: map[string]int{"pickup": 1, "welding": 1, "assembly": 1, "painting": 1, "dropoff": 1}}
+}
+
+// working time of a task at a station
+func (durations Durations) work(station string) int {
+	if work, known := durations.Work[station]; known {
+		return work
+	}
+	return 1
+}
+
+// expected order mix, the share of every route among the task sets
+type OrderMix []OrderShare
+
+// task sets of a route and their share
+// shares are relative, e. g. 3 and 1 mean 75 and 25 percent
+type OrderShare struct {
+	Route   []string // station types of the tasks
+	Share   float64
+	Product string // name of the product in the task descriptions, e. g. steel bar
+}
+
+// verbs of the task descriptions, by station type
+var stationVerbs = map[string]string{
+	"pickup":   "pickup",
+	"welding":  "weld",
+	"assembly": "assemble",
+	"painting": "paint",
+	"dropoff":  "dropoff",
+}
+
+// task set of the route with the given id
+func (share OrderShare) taskset(controlCenter *ControlCenter, id int) TaskSet {
+	product := share.Product
+	if product == "" {
+		product = "part"
+	}
+	descriptions := make([]string, len(share.Route))
+	for i, station := range share.Route {
+		descriptions[i] = stationVerbs[station] + " " + product
+	}
+	return gen_task_set(controlCenter, id, share.Route, descriptions)
+}
+
+// load of one kind of resource
+type ResourceLoad struct {
+	Resource    string  // e. g. welding station or welding worker
+	Count       int     // number of resources of the kind
+	Demand      float64 // program time a task set occupies one of them, on average over the mix
+	Capacity    float64 // maximum task sets per unit of program time, Count / Demand
+	Utilization float64 // share of the time they are busy at the planned rate
+}
+
+// capacity plan of a factory layout for an order mix
+type CapacityPlan struct {
+	Rate          float64        // task sets per unit of program time the utilization is planned for
+	Resources     []ResourceLoad // by capacity, the bottleneck first
+	Bottleneck    string         // resource with the lowest capacity
+	MaxThroughput float64        // task sets per unit of program time the bottleneck allows
+}
+
+// plan the capacity of the layout for the order mix arriving at the rate,
+// a rate of 0 plans for the maximum throughput
+// resources not used by the mix are left out
+func PlanCapacity(layout Layout, durations Durations, mix OrderMix, rate float64) (CapacityPlan, error) {
+	total := 0.0
+	for _, share := range mix {
+		if share.Share < 0 {
+			return CapacityPlan{}, fmt.Errorf("capacity: negative share %v", share.Share)
+		}
+		total += share.Share
+	}
+	if total == 0 {
+		return CapacityPlan{}, errors.New("capacity: empty order mix")
+	}
+
+	// program time a task set occupies each kind of resource
+	demands := make(map[string]float64)
+	for _, share := range mix {
+		weight := share.Share / total
+		transport := float64(durations.Commute)
+		for _, station := range share.Route {
+			required, known := stationWorkers[station]
+			if !known {
+				return CapacityPlan{}, fmt.Errorf("capacity: unknown station type %q", station)
+			}
+			work := float64(durations.work(station))
+			demands[station+" station"] += weight * (float64(durations.Commute) + work)
+			if required.n > 0 {
+				demands[required.specialization+" worker"] += weight * float64(required.n) * (2*float64(durations.Commute) + work)
+			}
+			transport += float64(durations.Commute) + work
+		}
+		demands["transport worker"] += weight * transport
+	}
+
+	counts := layout.units()
+	plan := CapacityPlan{}
+	for resource, demand := range demands {
+		if demand == 0 {
+			continue
+		}
+		count := *counts[resource]
+		plan.Resources = append(plan.Resources, ResourceLoad{Resource: resource, Count: count, Demand: demand, Capacity: float64(count) / demand})
+	}
+	sort.Slice(plan.Resources, func(i, j int) bool {
+		a, b := plan.Resources[i], plan.Resources[j]
+		return a.Capacity < b.Capacity || a.Capacity == b.Capacity && a.Resource < b.Resource
+	})
+	if len(plan.Resources) == 0 {
+		return plan, nil
+	}
+	plan.Bottleneck = plan.Resources[0].Resource
+	plan.MaxThroughput = plan.Resources[0].Capacity
+
+	// utilization at the planned rate, resources that are missing entirely are always busy
+	plan.Rate = rate
+	if rate == 0 {
+		plan.Rate = plan.MaxThroughput
+	}
+	for i := range plan.Resources {
+		load := &plan.Resources[i]
+		if load.Count == 0 {
+			load.Utilization = 1
+			continue
+		}
+		load.Utilization = plan.Rate * load.Demand / float64(load.Count)
+	}
+	return plan, nil
+}
+
+// number of units of every kind of resource of the layout
+func (layout *Layout) units() map[string]*int {
+	return map[string]*int{
+		"pickup station":   &layout.PickupStations,
+		"assembly station": &layout.AssemblyStations,
+		"welding station":  &layout.WeldingStations,
+		"painting station": &layout.PaintingStations,
+		"dropoff station":  &layout.DropoffStations,
+		"assembly worker":  &layout.AssemblyWorkers,
+		"welding worker":   &layout.WeldingWorkers,
+		"painting worker":  &layout.PaintingWorkers,
+		"transport worker": &layout.TransportWorkers,
+	}
+}
+
+// table of the capacity plan
+func (plan CapacityPlan) String() string {
+	var report strings.Builder
+	fmt.Fprintf(&report, "%-18s %5s %8s %10s %12s\n", "resource", "count", "demand", "capacity", "utilization")
+	for _, load := range plan.Resources {
+		fmt.Fprintf(&report, "%-18s %5d %8.2f %10.3f %11.0f%%\n", load.Resource, load.Count, load.Demand, load.Capacity, 100*load.Utilization)
+	}
+	fmt.Fprintf(&report, "bottleneck: %s, maximum throughput %.3f task sets per time unit, planned for %.3f\n", plan.Bottleneck, plan.MaxThroughput, plan.Rate)
+	return report.String()
+}
@@ -0,0 +1,78 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the capacity planner
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// Test the capacity plan of the demo factory and of a welding heavy mix
+func TestPlanCapacity(t *testing.T) {
+	fullRoute := []string{"pickup", "welding", "assembly", "painting", "dropoff"}
+	layout := Layout{2, 2, 2, 2, 2, 2, 2, 2, 2}
+
+	// a task set takes a transport worker for 5 tasks of 2 time units and the way back
+	plan, err := PlanCapacity(layout, FactoryDurations(), OrderMix{{Route: fullRoute, Share: 1}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Bottleneck != "transport worker" || math.Abs(plan.MaxThroughput-2.0/11) > 1e-9 {
+		t.Errorf("Bottleneck is %s with %.3f task sets per time unit, want transport worker with %.3f", plan.Bottleneck, plan.MaxThroughput, 2.0/11)
+	}
+	for _, load := range plan.Resources {
+		// 2 welders for commuting there, 1 time unit of welding and commuting back
+		if load.Resource == "welding worker" && (load.Demand != 6 || math.Abs(load.Utilization-6.0/11) > 1e-9) {
+			t.Errorf("Load of the welders is %+v, want a demand of 6 and a utilization of %.3f", load, 6.0/11)
+		}
+	}
+
+	// with plenty of transport workers, welding three quarters of the task sets takes the welders
+	layout.TransportWorkers = 20
+	mix := OrderMix{{Route: []string{"pickup", "welding", "dropoff"}, Share: 3}, {Route: []string{"pickup", "painting", "dropoff"}, Share: 1}}
+	plan, err = PlanCapacity(layout, FactoryDurations(), mix, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Bottleneck != "welding worker" || math.Abs(plan.MaxThroughput-2/4.5) > 1e-9 {
+		t.Errorf("Bottleneck is %s with %.3f task sets per time unit, want welding worker with %.3f", plan.Bottleneck, plan.MaxThroughput, 2/4.5)
+	}
+	for _, load := range plan.Resources {
+		if load.Resource == "assembly station" || load.Resource == "assembly worker" {
+			t.Errorf("Plan contains %s, which the mix does not use", load.Resource)
+		}
+	}
+
+	// invalid mixes
+	if _, err := PlanCapacity(layout, FactoryDurations(), nil, 0); err == nil {
+		t.Errorf("Empty order mix was planned")
+	}
+	if _, err := PlanCapacity(layout, FactoryDurations(), OrderMix{{Route: []string{"pickup", "polishing"}, Share: 1}}, 0); err == nil {
+		t.Errorf("Order mix with an unknown station type was planned")
+	}
+}
+
+// Test that the factory does not exceed the planned maximum throughput
+func TestPlanCapacityBound(t *testing.T) {
+	const tasksets = 200
+	var mix OrderMix
+	for _, route := range benchRoutes {
+		mix = append(mix, OrderShare{Route: route, Share: 1})
+	}
+	plan, err := PlanCapacity(Layout{2, 2, 2, 2, 2, 4, 4, 4, 4}, FactoryDurations(), mix, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := runDispatcher(t, DispatchCentral, 2, 4, tasksets)
+	throughput := float64(tasksets) / float64(run.elapsed)
+	t.Logf("measured %.3f task sets per time unit, planned at most %.3f (%s)", throughput, plan.MaxThroughput, plan.Bottleneck)
+	// a little room for ticks of the simulated clock lost under load
+	if throughput > 1.1*plan.MaxThroughput || throughput < 0.3*plan.MaxThroughput {
+		t.Errorf("Measured throughput %.3f is far from the planned maximum %.3f", throughput, plan.MaxThroughput)
+	}
+}
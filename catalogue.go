@@ -0,0 +1,320 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the product catalogue of the factory
+
+// A product defines its routing recipe once: the steps, the station type of
+// each step and the steps that have to be done before it. Without any
+// dependencies the steps run in the order of the recipe, with them the
+// recipe is a DAG and the steps run in an order that respects it, the
+// earlier step of the recipe first if several are ready.
+// The action of a step is the description of its task with parameters in
+// braces, e. g. "paint {product} in {colour}". {product} is the name of the
+// product, the other parameters come from the order or the defaults of the
+// product.
+// An order references a product, its parameters and a quantity, each unit
+// is expanded into a task set of its own. A product with a kit is assembled
+// from components that are products of the catalogue, every unit is
+// preceded by a task set for each component that supplies its part to the
+// kit of the first assembly step (see kitting.go). The components take the
+// defaults of their products and should not end at a dropoff station.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// one step of a routing recipe
+type RecipeStep struct {
+	Name    string   `json:"name,omitempty"`  // unique within the recipe, the station if empty
+	Station string   `json:"station"`         // station type, e. g. painting
+	Action  string   `json:"action"`          // description of the task, e. g. paint {product} in {colour}, rendered from the attributes if empty
+	After   []string `json:"after,omitempty"` // names of the steps done before this one
+}
+
+// product of the catalogue
+type Product struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"` // the id if empty
+	Recipe     []RecipeStep      `json:"recipe"`
+	Parameters map[string]string `json:"parameters,omitempty"` // defaults of the parameters
+	Materials  map[string]int    `json:"materials,omitempty"`  // raw materials taken at the first pickup, see inventory.go
+	Kit        []string          `json:"kit,omitempty"`        // ids of the components assembled by the first assembly step, see kitting.go
+}
+
+// products by id
+type Catalogue map[string]Product
+
+// order of a product
+type Order struct {
+	ID         string            `json:"id,omitempty"`         // id of the customer order, see shipping.go
+	Product    string            `json:"product"`              // id of the product
+	Parameters map[string]string `json:"parameters,omitempty"` // override the defaults of the product
+	Quantity   int               `json:"quantity"`             // number of task sets, 1 if 0
+	Priority   int               `json:"priority,omitempty"`
+}
+
+// catalogue of the demo products
+func DefaultCatalogue() Catalogue {
+	recipe := []RecipeStep{
+		{Station: "pickup", Action: "pickup {product}"},
+		{Station: "welding", Action: "weld {product}"},
+		{Station: "assembly", Action: "assemble {product}"},
+		{Station: "painting", Action: "paint {product} in {colour}"},
+		{Station: "dropoff", Action: "dropoff {product}"},
+	}
+	return Catalogue{
+		"bar":  {ID: "bar", Name: "steel bar", Recipe: recipe, Parameters: map[string]string{"colour": "blue", "material": "steel", "weld_spec": "butt"}, Materials: map[string]int{"steel": 1}},
+		"wool": {ID: "wool", Name: "steel wool", Recipe: recipe, Parameters: map[string]string{"colour": "red", "material": "steel", "weld_spec": "spot"}, Materials: map[string]int{"steel": 1}},
+		"pot":  {ID: "pot", Name: "steel pot", Recipe: recipe, Parameters: map[string]string{"colour": "green", "material": "steel", "weld_spec": "fillet"}, Materials: map[string]int{"steel": 2}},
+		// the scooter is assembled from a frame and a motor
+		"frame": {ID: "frame", Name: "scooter frame", Recipe: []RecipeStep{{Station: "pickup"}, {Station: "welding"}}, Parameters: map[string]string{"material": "steel", "weld_spec": "butt"}, Materials: map[string]int{"steel": 2}},
+		"motor": {ID: "motor", Name: "electric motor", Recipe: []RecipeStep{{Station: "pickup"}, {Station: "assembly"}}, Parameters: map[string]string{"components": "stator, rotor"}, Materials: map[string]int{"steel": 1}},
+		"scooter": {ID: "scooter", Name: "scooter", Recipe: []RecipeStep{
+			{Station: "pickup", Action: "pickup housing of {product}"},
+			{Station: "assembly"},
+			{Station: "painting"},
+			{Station: "dropoff"},
+		}, Parameters: map[string]string{"colour": "black", "material": "steel"}, Materials: map[string]int{"steel": 1}, Kit: []string{"frame", "motor"}},
+	}
+}
+
+// load a catalogue from a JSON file with a list of products
+func LoadCatalogue(path string) (Catalogue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var products []Product
+	if err := json.Unmarshal(data, &products); err != nil {
+		return nil, fmt.Errorf("catalogue: %v", err)
+	}
+	catalogue := make(Catalogue)
+	for _, product := range products {
+		if _, known := catalogue[product.ID]; known || product.ID == "" {
+			return nil, fmt.Errorf("catalogue: product id %q is empty or not unique", product.ID)
+		}
+		if _, err := product.steps(); err != nil {
+			return nil, err
+		}
+		catalogue[product.ID] = product
+	}
+	return catalogue, nil
+}
+
+// load orders from a JSON file with a list of orders
+func LoadOrders(path string) ([]Order, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var orders []Order
+	if err := json.Unmarshal(data, &orders); err != nil {
+		return nil, fmt.Errorf("orders: %v", err)
+	}
+	return orders, nil
+}
+
+// expand an order into task sets with the ids from firstID on
+func (catalogue Catalogue) Expand(controlCenter *ControlCenter, order Order, firstID int) ([]TaskSet, error) {
+	return catalogue.expand(controlCenter, order, firstID, nil)
+}
+
+// expand an order of a product that is a component of the products of the path
+func (catalogue Catalogue) expand(controlCenter *ControlCenter, order Order, firstID int, path []string) ([]TaskSet, error) {
+	product, known := catalogue[order.Product]
+	if !known {
+		return nil, fmt.Errorf("catalogue: unknown product %q", order.Product)
+	}
+	if slices.Contains(path, product.ID) {
+		return nil, fmt.Errorf("catalogue: product %q is a component of itself", product.ID)
+	}
+	if order.Quantity < 0 {
+		return nil, fmt.Errorf("catalogue: negative quantity %d of product %q", order.Quantity, order.Product)
+	}
+	steps, err := product.steps()
+	if err != nil {
+		return nil, err
+	}
+
+	// the parameters of the order override the defaults of the product
+	parameters := map[string]string{"product": product.name()}
+	for name, value := range product.Parameters {
+		parameters[name] = value
+	}
+	for name, value := range order.Parameters {
+		parameters[name] = value
+	}
+	stations := make([]string, len(steps))
+	descriptions := make([]string, len(steps))
+	attributes := make([]TaskAttributes, len(steps))
+	kitStep := -1
+	for i, step := range steps {
+		if controlCenter.facilitySet(step.Station) == nil {
+			return nil, fmt.Errorf("catalogue: product %q uses the unknown station %q", product.ID, step.Station)
+		}
+		stations[i] = step.Station
+		if attributes[i], err = attributesFor(step.Station, parameters); err != nil {
+			return nil, fmt.Errorf("catalogue: product %q, step %s: %v", product.ID, step.name(), err)
+		}
+		// the first assembly step assembles the kit
+		if len(product.Kit) > 0 && kitStep < 0 && step.Station == "assembly" {
+			kitStep = i
+			attributes[i].Components = product.Kit
+		}
+		if step.Action == "" {
+			descriptions[i] = attributes[i].describe(step.Station)
+		} else if descriptions[i], err = fill(step.Action, parameters); err != nil {
+			return nil, fmt.Errorf("catalogue: product %q: %v", product.ID, err)
+		}
+	}
+
+	if len(product.Kit) > 0 && kitStep < 0 {
+		return nil, fmt.Errorf("catalogue: product %q has a kit but no assembly step", product.ID)
+	}
+
+	var tasksets []TaskSet
+	id := firstID
+	units := max(order.Quantity, 1)
+	for unit := 0; unit < units; unit++ {
+		// the components of the kit come first, each supplies the part of its last task set
+		var supplies []*Task
+		for _, component := range product.Kit {
+			components, err := catalogue.expand(controlCenter, Order{Product: component, Priority: order.Priority}, id, append(slices.Clip(path), product.ID))
+			if err != nil {
+				return nil, err
+			}
+			last := components[len(components)-1].tasks
+			supplies = append(supplies, last[len(last)-1])
+			tasksets = append(tasksets, components...)
+			id += len(components)
+		}
+		taskset := gen_task_set(controlCenter, id, stations, descriptions)
+		taskset.priority = order.Priority
+		for j, task := range taskset.tasks {
+			task.attributes = attributes[j]
+		}
+		// the first pickup takes the raw materials of the product
+		for _, task := range taskset.tasks {
+			if task.FacilityType.facilityType == "pickup" {
+				task.materials = product.Materials
+				break
+			}
+		}
+		// the last dropoff leaves the finished goods
+		for j := len(taskset.tasks) - 1; j >= 0; j-- {
+			if task := taskset.tasks[j]; task.FacilityType.facilityType == "dropoff" {
+				task.goods = &Goods{Product: product.ID, Order: order.ID}
+				break
+			}
+		}
+		if kitStep >= 0 {
+			kit := fmt.Sprintf("%s-%d", product.ID, id)
+			taskset.tasks[kitStep].kit = kit
+			for j, task := range supplies {
+				task.supplies = &KitSupply{Kit: kit, Component: product.Kit[j]}
+			}
+		}
+		tasksets = append(tasksets, taskset)
+		id++
+	}
+	return tasksets, nil
+}
+
+// name of the product
+func (product Product) name() string {
+	if product.Name == "" {
+		return product.ID
+	}
+	return product.Name
+}
+
+// name of the step
+func (step RecipeStep) name() string {
+	if step.Name == "" {
+		return step.Station
+	}
+	return step.Name
+}
+
+// steps of the recipe in an order that respects their dependencies
+func (product Product) steps() ([]RecipeStep, error) {
+	if len(product.Recipe) == 0 {
+		return nil, fmt.Errorf("catalogue: product %q has no recipe", product.ID)
+	}
+	index := make(map[string]int)
+	for i, step := range product.Recipe {
+		name := step.name()
+		if _, known := index[name]; known {
+			return nil, fmt.Errorf("catalogue: product %q has the step %q twice", product.ID, name)
+		}
+		index[name] = i
+	}
+	// number of steps each step waits for and the steps waiting for it
+	waiting := make([]int, len(product.Recipe))
+	next := make([][]int, len(product.Recipe))
+	for i, step := range product.Recipe {
+		for _, before := range step.After {
+			j, known := index[before]
+			if !known {
+				return nil, fmt.Errorf("catalogue: product %q has no step %q", product.ID, before)
+			}
+			waiting[i]++
+			next[j] = append(next[j], i)
+		}
+	}
+	// take the earliest step of the recipe that is ready
+	var ready []int
+	for i := range product.Recipe {
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	steps := make([]RecipeStep, 0, len(product.Recipe))
+	for len(ready) > 0 {
+		i := ready[0]
+		ready = ready[1:]
+		steps = append(steps, product.Recipe[i])
+		for _, j := range next[i] {
+			if waiting[j]--; waiting[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+		sort.Ints(ready)
+	}
+	if len(steps) < len(product.Recipe) {
+		return nil, fmt.Errorf("catalogue: recipe of product %q has a cycle", product.ID)
+	}
+	return steps, nil
+}
+
+// replace the parameters in braces by their values
+func fill(action string, parameters map[string]string) (string, error) {
+	var description strings.Builder
+	for {
+		open := strings.IndexByte(action, '{')
+		if open < 0 {
+			description.WriteString(action)
+			return description.String(), nil
+		}
+		end := strings.IndexByte(action[open:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unclosed parameter in %q", action)
+		}
+		name := action[open+1 : open+end]
+		value, known := parameters[name]
+		if !known {
+			return "", fmt.Errorf("missing parameter %q", name)
+		}
+		description.WriteString(action[:open])
+		description.WriteString(value)
+		action = action[open+end+1:]
+	}
+}
@@ -0,0 +1,167 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the product catalogue
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// descriptions of the tasks of a task set
+func descriptions(taskset TaskSet) []string {
+	var descriptions []string
+	for _, task := range taskset.tasks {
+		descriptions = append(descriptions, task.description)
+	}
+	return descriptions
+}
+
+// Test that orders are expanded into task sets following the recipe
+func TestExpandOrder(t *testing.T) {
+	programTime := StartProgramTime()
+	controlCenter := BuildFactory(1, 1, 1, 1, 1, 1, 2, 1, 1, programTime)
+	catalogue := DefaultCatalogue()
+
+	tasksets, err := catalogue.Expand(&controlCenter, Order{Product: "pot", Parameters: map[string]string{"colour": "yellow"}, Quantity: 2, Priority: 3}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"pickup steel pot", "weld steel pot", "assemble steel pot", "paint steel pot in yellow", "dropoff steel pot"}
+	if len(tasksets) != 2 {
+		t.Fatalf("Order expanded into %d task sets, want 2", len(tasksets))
+	}
+	for i, taskset := range tasksets {
+		if got := descriptions(taskset); taskset.id != 5+i || taskset.priority != 3 || len(got) != len(want) {
+			t.Fatalf("Taskset %d has the tasks %v and priority %d", taskset.id, got, taskset.priority)
+		}
+		for j, task := range taskset.tasks {
+			if task.description != want[j] || task.tasksetID != 5+i {
+				t.Errorf("Task %d of taskset %d is %q, want %q", j, taskset.id, task.description, want[j])
+			}
+		}
+		if taskset.tasks[3].FacilityType != controlCenter.PaintingStations {
+			t.Errorf("Painting of taskset %d is not at a painting station", taskset.id)
+		}
+	}
+
+	// the default colour of the product
+	tasksets, err = catalogue.Expand(&controlCenter, Order{Product: "bar"}, 1)
+	if err != nil || len(tasksets) != 1 || tasksets[0].tasks[3].description != "paint steel bar in blue" {
+		t.Errorf("Default order of a steel bar expanded into %+v, %v", tasksets, err)
+	}
+
+	for _, order := range []Order{{Product: "chair"}, {Product: "bar", Quantity: -1}} {
+		if _, err := catalogue.Expand(&controlCenter, order, 1); err == nil {
+			t.Errorf("Order %+v was expanded", order)
+		}
+	}
+}
+
+// Test that the steps of a DAG recipe respect their dependencies
+func TestRecipeSteps(t *testing.T) {
+	// the frame is welded and the legs are assembled before both are painted,
+	// the legs are listed first but have to wait for the pickup
+	product := Product{ID: "table", Recipe: []RecipeStep{
+		{Name: "legs", Station: "assembly", Action: "assemble legs", After: []string{"pickup"}},
+		{Station: "pickup", Action: "pickup {product}"},
+		{Name: "frame", Station: "welding", Action: "weld frame", After: []string{"pickup"}},
+		{Station: "painting", Action: "paint {product} in {colour}", After: []string{"legs", "frame"}},
+		{Station: "dropoff", Action: "dropoff {product}", After: []string{"painting"}},
+	}, Parameters: map[string]string{"colour": "white"}}
+	steps, err := product.steps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"pickup", "assembly", "welding", "painting", "dropoff"}
+	for i, step := range steps {
+		if step.Station != want[i] {
+			t.Fatalf("Steps are %+v, want the stations %v", steps, want)
+		}
+	}
+
+	programTime := StartProgramTime()
+	controlCenter := BuildFactory(1, 1, 1, 1, 1, 1, 2, 1, 1, programTime)
+	tasksets, err := Catalogue{"table": product}.Expand(&controlCenter, Order{Product: "table"}, 1)
+	if err != nil || tasksets[0].tasks[3].description != "paint table in white" {
+		t.Errorf("Table expanded into %+v, %v", tasksets, err)
+	}
+
+	for name, recipe := range map[string][]RecipeStep{
+		"cycle":     {{Name: "a", Station: "welding", After: []string{"b"}}, {Name: "b", Station: "painting", After: []string{"a"}}},
+		"unknown":   {{Station: "welding", After: []string{"pickup"}}},
+		"duplicate": {{Station: "welding"}, {Station: "welding"}},
+		"empty":     nil,
+	} {
+		if _, err := (Product{ID: name, Recipe: recipe}).steps(); err == nil {
+			t.Errorf("Recipe with a %s step was accepted", name)
+		}
+	}
+	if _, err := (Catalogue{"table": product}).Expand(&controlCenter, Order{Product: "table", Parameters: map[string]string{"colour": "{size}"}}, 1); err != nil {
+		t.Errorf("Parameter values are filled in again: %v", err)
+	}
+	product.Parameters = nil
+	if _, err := (Catalogue{"table": product}).Expand(&controlCenter, Order{Product: "table"}, 1); err == nil {
+		t.Errorf("Table without a colour was expanded")
+	}
+}
+
+// Test that a catalogue is loaded from a file and its orders are completed
+func TestLoadCatalogue(t *testing.T) {
+	dir := t.TempDir()
+	cataloguePath := filepath.Join(dir, "catalogue.json")
+	ordersPath := filepath.Join(dir, "orders.json")
+	if err := os.WriteFile(cataloguePath, []byte(`[{"id": "sign", "name": "metal sign", "recipe": [
+		{"station": "pickup", "action": "pickup {product}"},
+		{"station": "painting", "action": "paint {product} with {text}"},
+		{"station": "dropoff", "action": "dropoff {product}"}]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ordersPath, []byte(`[{"product": "sign", "parameters": {"text": "exit"}, "quantity": 2}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	catalogue, err := LoadCatalogue(cataloguePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders, err := LoadOrders(ordersPath)
+	if err != nil || len(orders) != 1 {
+		t.Fatalf("Orders are %+v, %v", orders, err)
+	}
+
+	programTime := StartSimulatedTime(0, time.Millisecond)
+	controlCenter := BuildFactory(1, 0, 0, 1, 1, 0, 0, 1, 2, programTime)
+	go controlCenter.Boot()
+	tasksets, err := catalogue.Expand(&controlCenter, orders[0], 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for i := range tasksets {
+		handle, err := controlCenter.Submit(&tasksets[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, err := handle.Wait(ctx); err != nil || result.Status != taskSetCompleted {
+			t.Errorf("Taskset %d finished with %+v, %v", handle.ID(), result, err)
+		}
+	}
+	if got := tasksets[1].tasks[1].description; got != "paint metal sign with exit" {
+		t.Errorf("Painting task is %q", got)
+	}
+
+	// a product id has to be unique
+	if err := os.WriteFile(cataloguePath, []byte(`[{"id": "sign", "recipe": [{"station": "pickup"}]}, {"id": "sign", "recipe": [{"station": "pickup"}]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCatalogue(cataloguePath); err == nil {
+		t.Errorf("Catalogue with a product twice was accepted")
+	}
+}
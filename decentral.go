@@ -0,0 +1,81 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the decentralised dispatch mode
+
+// In the central dispatch mode a transportation worker sends every task to
+// the assignment handler of the station type, which assigns a facility and
+// the workers one task after the other. In the decentralised dispatch mode
+// the transportation workers skip the handlers and race on the channels of
+// the free facilities and workers themselves.
+// Racing for more than one worker can deadlock: two transporters that need
+// two welders each may get hold of one welder each and wait for the other
+// one forever. The transporters therefore follow a simple protocol:
+//  1. take a free facility of the required type
+//  2. take the claim of the worker set, only one transporter at a time holds it
+//  3. take all the required workers of the set, then give back the claim
+// Only the holder of the claim takes workers of the set, so the workers it
+// waits for are busy with tasks that end without any transporter giving
+// something back. An aborted transporter gives back the workers it already
+// took and the claim.
+// The assignment handlers are not started in the decentralised mode, the
+// request handler still dispatches the task sets from the intake queue.
+// The mode is chosen at build time, the factory uses the decentralised mode
+// when built with the tag decentral (go build -tags decentral), and can be
+// changed with SetDispatchMode before the factory is booted.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// dispatch modes of the control center
+const (
+	DispatchCentral   = "central"
+	DispatchDecentral = "decentral"
+)
+
+// set the dispatch mode of the control center
+// must be called before the factory is booted
+func (controlCenter *ControlCenter) SetDispatchMode(mode string) error {
+	if mode != DispatchCentral && mode != DispatchDecentral {
+		return fmt.Errorf("unknown dispatch mode %q", mode)
+	}
+	controlCenter.dispatchMode = mode
+	return nil
+}
+
+// the dispatch mode of the control center
+func (controlCenter *ControlCenter) DispatchMode() string {
+	return controlCenter.dispatchMode
+}
+
+// workers required for a task at a facility of the set
+func (controlCenter *ControlCenter) workersFor(facilitySet *FacilitySet) (*WorkerSet, int) {
+	switch facilitySet {
+	case controlCenter.WeldingStations:
+		return controlCenter.WeldingWorkers, 2
+	case controlCenter.AssemblyStations:
+		return controlCenter.AssemblyWorkers, 1
+	case controlCenter.PaintingStations:
+		return controlCenter.PaintingWorkers, 1
+	}
+	return nil, 0
+}
+
+// take a free facility of the task's type and the workers for the task
+// in the decentralised dispatch mode
+// returns nil if the task was aborted meanwhile
+func (transportWorker *Worker) acquire(controlCenter *ControlCenter, task *Task) *Facility {
+	started := time.Now()
+	// the transportation worker goes to the facility itself, nobody is notified
+	workers, n := controlCenter.workersFor(task.FacilityType)
+	facility, waited := controlCenter.assignTask(task, workers, n, true, nil)
+	if facility != nil {
+		controlCenter.state.handled(task.FacilityType.facilityType, waited, time.Since(started))
+	}
+	return facility
+}
@@ -0,0 +1,129 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the decentralised dispatch mode
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// units of program time the median latencies of the dispatch modes may
+// differ by on top of a factor of two, the simulated clock ticks in real time
+const dispatchSlack = 20
+
+// run task sets that need two welders each through a factory with scarce
+// welders in a dispatch mode, returns the results by task set
+func runDispatchMode(t *testing.T, mode string, tasksets int) (map[int]TaskSetResult, FactoryState) {
+	programTime := StartSimulatedTime(0, benchTick)
+
+	// Build the factory with 3 welding stations and 3 welders for 6 transport workers,
+	// three transporters holding one welder each could wait for each other forever
+	controlCenter := BuildFactory(2, 0, 3, 0, 2, 1, 3, 1, 6, programTime)
+	if err := controlCenter.SetDispatchMode(mode); err != nil {
+		t.Fatal(err)
+	}
+	controlCenter.RecordDecisions()
+
+	// Boot the control center
+	go controlCenter.Boot()
+	defer controlCenter.Shutdown()
+
+	var handles []*TaskSetHandle
+	for id := 1; id <= tasksets; id++ {
+		taskset := gen_task_set(&controlCenter, id, []string{"pickup", "welding", "dropoff"}, []string{"pickup steel bar", "weld steel bar", "dropoff steel bar"})
+		handle, err := controlCenter.Submit(&taskset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handles = append(handles, handle)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	results := make(map[int]TaskSetResult)
+	for _, handle := range handles {
+		result, err := handle.Wait(ctx)
+		if err != nil || result.Status != taskSetCompleted {
+			t.Fatalf("Taskset %d finished with %+v, %v in the %s mode", handle.ID(), result, err, mode)
+		}
+		results[result.ID] = result
+	}
+
+	// every welding got two different welders
+	welded := 0
+	for _, decision := range controlCenter.Decisions() {
+		if decision.Station != "welding" {
+			continue
+		}
+		welded++
+		if len(decision.Workers) != 2 || decision.Workers[0] == decision.Workers[1] {
+			t.Errorf("Welding of taskset %d got welders %v in the %s mode", decision.TaskSet, decision.Workers, mode)
+		}
+	}
+	if welded != tasksets {
+		t.Errorf("%d weldings were decided in the %s mode, want %d", welded, mode, tasksets)
+	}
+	return results, controlCenter.State()
+}
+
+// Test that both dispatch modes weld the same task sets with scarce welders
+// and compare their latencies
+func TestDispatchModes(t *testing.T) {
+	const tasksets = 30
+	central, centralState := runDispatchMode(t, DispatchCentral, tasksets)
+	decentral, decentralState := runDispatchMode(t, DispatchDecentral, tasksets)
+
+	// both modes carry out the same tasks, each in one attempt
+	if centralState.CompletedTaskSets != tasksets || decentralState.CompletedTaskSets != tasksets {
+		t.Errorf("%d task sets were completed in the central mode and %d in the decentral mode, want %d", centralState.CompletedTaskSets, decentralState.CompletedTaskSets, tasksets)
+	}
+	for id, result := range central {
+		other := decentral[id]
+		if len(result.Tasks) != len(other.Tasks) {
+			t.Fatalf("Taskset %d has %d tasks in the central mode and %d in the decentral mode", id, len(result.Tasks), len(other.Tasks))
+		}
+		for i, task := range result.Tasks {
+			if task.Station != other.Tasks[i].Station || task.Attempts != 1 || other.Tasks[i].Attempts != 1 {
+				t.Errorf("Task %d of taskset %d is %+v in the central mode and %+v in the decentral mode", i, id, task, other.Tasks[i])
+			}
+		}
+	}
+
+	// every welding request is served once, by the welding handler in the
+	// central mode and by the transporters in the decentral mode
+	for mode, state := range map[string]FactoryState{DispatchCentral: centralState, DispatchDecentral: decentralState} {
+		for _, handler := range state.Handlers {
+			if handler.Station == "welding" && handler.Handled != tasksets {
+				t.Errorf("Welding was handled %d times in the %s mode, want %d", handler.Handled, mode, tasksets)
+			}
+		}
+	}
+
+	// neither mode is much slower on the same workload
+	latencies := make(map[string][]int)
+	for mode, results := range map[string]map[int]TaskSetResult{DispatchCentral: central, DispatchDecentral: decentral} {
+		for _, result := range results {
+			latencies[mode] = append(latencies[mode], result.Time-result.Submitted)
+		}
+		t.Logf("%s mode: p50 %d, p99 %d units of program time", mode, percentile(latencies[mode], 50), percentile(latencies[mode], 99))
+	}
+	p50Central, p50Decentral := percentile(latencies[DispatchCentral], 50), percentile(latencies[DispatchDecentral], 50)
+	if p50Decentral > 2*p50Central+dispatchSlack || p50Central > 2*p50Decentral+dispatchSlack {
+		t.Errorf("Median latency is %d in the central mode and %d in the decentral mode", p50Central, p50Decentral)
+	}
+}
+
+// Test that an unknown dispatch mode is rejected
+func TestSetDispatchMode(t *testing.T) {
+	controlCenter := BuildFactory(1, 0, 0, 0, 1, 1, 1, 1, 1, StartProgramTime())
+	if controlCenter.DispatchMode() != defaultDispatchMode {
+		t.Errorf("Dispatch mode is %q, want %q", controlCenter.DispatchMode(), defaultDispatchMode)
+	}
+	if err := controlCenter.SetDispatchMode("anarchy"); err == nil || controlCenter.DispatchMode() != defaultDispatchMode {
+		t.Errorf("Unknown dispatch mode was accepted")
+	}
+}
@@ -0,0 +1,12 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file selects the decentralised dispatch mode, see decentral.go
+
+//go:build decentral
+
+package main
+
+// dispatch mode of a new control center
+const defaultDispatchMode = DispatchDecentral
@@ -20,8 +20,14 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -36,6 +42,7 @@ type Worker struct {
 	inbox          chan TaskSet
 	next_facility  chan *Facility
 	task_completed chan bool
+	battery        *battery // see battery.go
 }
 
 // list of workers of a certain specialization
@@ -43,6 +50,17 @@ type WorkerSet struct {
 	workers        []*Worker
 	specialization string
 	freeWorkers    chan *Worker
+	claim          chan struct{} // held while taking workers in the decentralised dispatch mode, see decentral.go
+	state          *stateStore
+	events         *eventLog
+
+	// breakdowns of the workers on their way to a facility, see retry.go
+	programTime     *ProgramTime
+	breakdownRate   float64
+	breakdownRepair int
+
+	// batteries and charging stations, see battery.go
+	power *powerSupply
 }
 
 // robot's task
@@ -54,12 +72,28 @@ type Task struct {
 	assignedWorkers []*Worker
 	completed       bool
 	tasksetID       int
+	watch           *taskWatch     // progress of the current attempt, see watchdog.go
+	avoid           *Facility      // facility of the previous failed attempt, see retry.go
+	batched         int            // number of tasks processed in the same cycle, see batch.go
+	materials       map[string]int // raw materials taken at a pickup, see inventory.go
+	goods           *Goods         // finished goods left at a dropoff, see shipping.go
+	attributes      TaskAttributes // typed attributes, see attributes.go
+	supplies        *KitSupply     // component supplied to a kit once completed, see kitting.go
+	kit             string         // kit assembled by the task, see kitting.go
+	consumed        []KitPart      // parts consumed by the completed assembly, see kitting.go
 }
 
 // list of tasks
 type TaskSet struct {
-	id    int
-	tasks []*Task
+	id        int
+	tasks     []*Task
+	failure   string       // reason why the task set failed, empty if it did not fail
+	timings   []TaskTiming // timing of each task, see notify.go
+	priority  int          // higher priorities leave the intake queue first, see intake.go
+	submitted int          // program time the task set was received
+	queued    time.Time    // real time the task set entered the intake queue
+	booked    bool         // its unit is booked for its customer order, see shipping.go
+	load      []TaskSet    // task sets carried together with it, see transport.go
 }
 
 /////////// facitilies ///////////
@@ -68,8 +102,44 @@ type TaskSet struct {
 type Facility struct {
 	id             int
 	facilityType   string
-	workerArrival  chan *Worker
+	workerArrival  chan Arrival
 	taskAssignment chan *Task
+
+	// maintenance and fault handling (see maintenance.go)
+	programTime     *ProgramTime
+	maintenance     MaintenancePlan
+	nextMaintenance int // program time of the next calendar based window
+	tasksDone       int // tasks processed since the last maintenance window
+	maintenances    int // number of maintenance windows so far
+	faults          int // number of station faults so far
+	availableAt     int // program time a facility in maintenance or repair is free again
+	statusMutex     sync.Mutex
+
+	// setup of the station, guarded by the status mutex (see setup.go)
+	setup       string
+	changeovers int // number of changeovers so far
+	setupTime   int // program time spent on setups so far
+
+	// raw materials in stock, nil if the station has no inventory (see inventory.go)
+	inventory *inventory
+
+	// finished goods of a dropoff station, nil for the other types (see shipping.go)
+	warehouse *warehouse
+
+	// status reported to the state store (see state.go)
+	state *stateStore
+
+	// events printed by the facility
+	events *eventLog
+
+	// tasks processed in the current cycle, see batch.go
+	batch *batch
+}
+
+// a worker arriving at a facility to carry out a task
+type Arrival struct {
+	worker *Worker
+	task   *Task
 }
 
 // list of facilities of a certain type
@@ -78,6 +148,22 @@ type FacilitySet struct {
 	facilityType   string
 	freeFacilities chan *Facility
 	taskAssignment chan *Task
+
+	// handling of failed tasks, see retry.go
+	retryPolicy RetryPolicy
+	rejectRate  float64
+
+	// batching of tasks of the same kind, nil if disabled, see batch.go
+	batching *batchTable
+
+	// changeovers between the setups of the stations, see setup.go
+	setupPolicy SetupPolicy
+
+	// raw material inventory of the stations, nil if they have none, see inventory.go
+	inventoryPolicy *InventoryPolicy
+
+	// capacity limits and shipments of the finished goods, see shipping.go
+	shippingPolicy ShippingPolicy
 }
 
 // //////// control center //////////
@@ -91,6 +177,7 @@ type ControlCenter struct {
 	WeldingStations  *FacilitySet
 	PaintingStations *FacilitySet
 	DropoffStations  *FacilitySet
+	ChargingStations *FacilitySet // charging stations of the batteries of the workers, see battery.go
 
 	// each worker set contains a list of workers of a certain specialization
 	// worker of certain specialization use channels to communicate with the control center
@@ -101,6 +188,7 @@ type ControlCenter struct {
 
 	// inbox when new components arrive
 	request chan *TaskSet // when a truck comes in with a component it sends a request to the control center
+	intake  *intakeQueue  // requests waiting to be dispatched, see intake.go
 
 	// channels to communicate
 	workerArrival   chan *Worker
@@ -109,13 +197,57 @@ type ControlCenter struct {
 	// program time
 	ProgramTime *ProgramTime
 
-	// counter for completed task sets
-	CompletedTaskSets int
+	// counters and status of task sets, facilities and workers, see state.go
+	state *stateStore
+
+	// events of the factory, printed to the standard output by default
+	events *eventLog
+
+	// stuck task detection, see watchdog.go
+	Timeouts Timeouts
+	watched  *watchList
+
+	// task sets that exhausted their retries, see retry.go
+	deadLetters *deadLetterQueue
+
+	// write-ahead log of the task sets, see journal.go
+	journal *Journal
+
+	// units booked for the customer orders, see shipping.go
+	orders *orderBook
+
+	// records of the attempts of the tasks, see traceability.go
+	trace *traceStore
+
+	// parts waiting for their kits and the assemblies, see kitting.go
+	kitting *kittingArea
+
+	// pausing and restoring the factory, see snapshot.go
+	gate     *pauseGate
+	restored []restoredTaskSet
+
+	// recorded and replayed dispatch decisions, see replay.go
+	decisions *decisionLog
+
+	// handles and subscribers of finished task sets, see notify.go
+	notifier *notifier
+
+	// central or decentralised assignment of facilities and workers, see decentral.go
+	dispatchMode string
+
+	// load capacity of the transportation workers, see transport.go
+	transportPolicy TransportPolicy
+
+	// battery policy of the workers, shared with the worker sets, see battery.go
+	power *powerSupply
 }
 
 // ///// time ///////
 type ProgramTime struct {
-	time int
+	time    atomic.Int64
+	tick    time.Duration // real duration of one unit of program time
+	stopped chan struct{} // closed once the program time is stopped
+	stop    sync.Once
 }
 
 // //////////////////// Time functionality //////////////////////
@@ -124,25 +256,82 @@ type ProgramTime struct {
 
 // get program time
 func (pt *ProgramTime) GetCurrentTime() int {
-	return pt.time
+	return int(pt.time.Load())
+}
+
+// real duration of one unit of program time
+func (pt *ProgramTime) Tick() time.Duration {
+	if pt.tick <= 0 {
+		return time.Second
+	}
+	return pt.tick
+}
+
+// wait for the given amount of program time
+func (pt *ProgramTime) Wait(duration int) {
+	time.Sleep(time.Duration(duration) * pt.Tick())
+}
+
+// channel that receives once the given amount of program time passed
+func (pt *ProgramTime) After(duration int) <-chan time.Time {
+	return time.After(time.Duration(duration) * pt.Tick())
+}
+
+// wait for the given amount of program time
+// returns false if the program time is stopped before
+func (pt *ProgramTime) WaitRunning(duration int) bool {
+	select {
+	case <-pt.After(duration):
+		return true
+	case <-pt.Stopped():
+		return false
+	}
+}
+
+// stop the program time, the factory running on it shuts down
+func (pt *ProgramTime) Stop() {
+	if pt.stopped == nil {
+		return
+	}
+	pt.stop.Do(func() { close(pt.stopped) })
+}
+
+// channel that is closed once the program time is stopped
+// the program time of a zero value is never stopped
+func (pt *ProgramTime) Stopped() <-chan struct{} {
+	return pt.stopped
 }
 
 // start program time
 func StartProgramTime() *ProgramTime {
+	return StartSimulatedTime(0, time.Second)
+}
+
+// start program time at a given point in time, e. g. of a restored snapshot,
+// with one unit of program time lasting tick, a short tick runs the whole
+// factory faster, e. g. for benchmarks
+func StartSimulatedTime(start int, tick time.Duration) *ProgramTime {
 	// receives current time
-	ticker := time.NewTicker(time.Second)
+	programTime := &ProgramTime{tick: tick, stopped: make(chan struct{})}
+	ticker := time.NewTicker(programTime.Tick())
 
 	// store program time
-	var programTime ProgramTime
+	programTime.time.Store(int64(start))
 
-	// increment program time
+	// increment program time until it is stopped
 	go func() {
-		for range ticker.C {
-			programTime.time++
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				programTime.time.Add(1)
+			case <-programTime.stopped:
+				return
+			}
 		}
 	}()
 
-	return &programTime
+	return programTime
 }
 
 // //////////////////// Boot Facility //////////////////////
@@ -154,7 +343,7 @@ func (controlCenter *ControlCenter) Boot() {
 	// every pickup station is free at the beginning
 	// every pickup station is started in a separate go routine
 	for _, pickupStation := range controlCenter.PickupStations.facilities {
-		controlCenter.PickupStations.freeFacilities <- pickupStation
+		pickupStation.makeAvailable(controlCenter.PickupStations.freeFacilities)
 		go pickupStation.RunPickupStation(controlCenter.PickupStations.freeFacilities)
 	}
 
@@ -162,7 +351,7 @@ func (controlCenter *ControlCenter) Boot() {
 	// every dropoff station is free at the beginning
 	// every dropoff station is started in a separate go routine
 	for _, dropoffStation := range controlCenter.DropoffStations.facilities {
-		controlCenter.DropoffStations.freeFacilities <- dropoffStation
+		dropoffStation.makeAvailable(controlCenter.DropoffStations.freeFacilities)
 		go dropoffStation.RunDropoffStation(controlCenter.DropoffStations.freeFacilities)
 	}
 
@@ -170,7 +359,7 @@ func (controlCenter *ControlCenter) Boot() {
 	// every assembly station is free at the beginning
 	// every assembly station is started in a separate go routine
 	for _, assemblyStation := range controlCenter.AssemblyStations.facilities {
-		controlCenter.AssemblyStations.freeFacilities <- assemblyStation
+		assemblyStation.makeAvailable(controlCenter.AssemblyStations.freeFacilities)
 		go assemblyStation.RunAssemblyStation(controlCenter.AssemblyStations.freeFacilities)
 	}
 
@@ -178,7 +367,7 @@ func (controlCenter *ControlCenter) Boot() {
 	// every welding station is free at the beginning
 	// every welding station is started in a separate go routine
 	for _, weldingStation := range controlCenter.WeldingStations.facilities {
-		controlCenter.WeldingStations.freeFacilities <- weldingStation
+		weldingStation.makeAvailable(controlCenter.WeldingStations.freeFacilities)
 		go weldingStation.RunWeldingStation(controlCenter.WeldingStations.freeFacilities)
 	}
 
@@ -186,18 +375,27 @@ func (controlCenter *ControlCenter) Boot() {
 	// every painting station is free at the beginning
 	// every painting station is started in a separate go routine
 	for _, paintingStation := range controlCenter.PaintingStations.facilities {
-		controlCenter.PaintingStations.freeFacilities <- paintingStation
+		paintingStation.makeAvailable(controlCenter.PaintingStations.freeFacilities)
 		go paintingStation.RunPaintingStation(controlCenter.PaintingStations.freeFacilities)
 	}
 
+	// make all charging stations available
+	// they only charge the batteries of the workers, so they need no go routine
+	for _, chargingStation := range controlCenter.ChargingStations.facilities {
+		chargingStation.makeAvailable(controlCenter.ChargingStations.freeFacilities)
+	}
+
 	///// Start workers /////
 
 	// start all transport workers
 	// every transport worker is free at the beginning
+	// (unless it carries a task set of a restored snapshot)
 	// every transport worker is started in a separate go routine
 	for _, transportWorker := range controlCenter.TransportWorkers.workers {
 		transportWorker.specialization = controlCenter.TransportWorkers
-		controlCenter.TransportWorkers.freeWorkers <- transportWorker
+		if !controlCenter.carriesRestored(transportWorker) {
+			transportWorker.free(controlCenter.TransportWorkers.freeWorkers)
+		}
 		go transportWorker.RunTransportWorker(controlCenter, controlCenter.TransportWorkers.freeWorkers)
 	}
 
@@ -206,7 +404,7 @@ func (controlCenter *ControlCenter) Boot() {
 	// every assembly worker is started in a separate go routine
 	for _, assemblyWorker := range controlCenter.AssemblyWorkers.workers {
 		assemblyWorker.specialization = controlCenter.AssemblyWorkers
-		controlCenter.AssemblyWorkers.freeWorkers <- assemblyWorker
+		assemblyWorker.free(controlCenter.AssemblyWorkers.freeWorkers)
 		go assemblyWorker.RunAssemblyWorker(controlCenter.AssemblyWorkers.freeWorkers)
 	}
 
@@ -215,7 +413,7 @@ func (controlCenter *ControlCenter) Boot() {
 	// every welding worker is started in a separate go routine
 	for _, weldingWorker := range controlCenter.WeldingWorkers.workers {
 		weldingWorker.specialization = controlCenter.WeldingWorkers
-		controlCenter.WeldingWorkers.freeWorkers <- weldingWorker
+		weldingWorker.free(controlCenter.WeldingWorkers.freeWorkers)
 		go weldingWorker.RunWeldingWorker(controlCenter.WeldingWorkers.freeWorkers)
 	}
 
@@ -224,23 +422,35 @@ func (controlCenter *ControlCenter) Boot() {
 	// every painting worker is started in a separate go routine
 	for _, paintingWorker := range controlCenter.PaintingWorkers.workers {
 		paintingWorker.specialization = controlCenter.PaintingWorkers
-		controlCenter.PaintingWorkers.freeWorkers <- paintingWorker
+		paintingWorker.free(controlCenter.PaintingWorkers.freeWorkers)
 		go paintingWorker.RunPaintingWorker(controlCenter.PaintingWorkers.freeWorkers)
 	}
 
 	// start control center
 	go controlCenter.RunControlCenter()
 
+	// continue the task sets of a restored snapshot
+	go controlCenter.resumeRestored()
+
 	// Print factory status
-	fmt.Println("🌱\nbooted factory with", len(controlCenter.PickupStations.facilities), "pick-up stations,", len(controlCenter.AssemblyStations.facilities), "assembly stations,", len(controlCenter.WeldingStations.facilities), "welding stations,", len(controlCenter.PaintingStations.facilities), "painting stations,", len(controlCenter.DropoffStations.facilities), "drop-off stations,", len(controlCenter.AssemblyWorkers.workers), "assembly workers,", len(controlCenter.WeldingWorkers.workers), "welding workers,", len(controlCenter.PaintingWorkers.workers), "painting workers and", len(controlCenter.TransportWorkers.workers), "transport workers\n🌱")
+	controlCenter.events.println("🌱\nbooted factory with", len(controlCenter.PickupStations.facilities), "pick-up stations,", len(controlCenter.AssemblyStations.facilities), "assembly stations,", len(controlCenter.WeldingStations.facilities), "welding stations,", len(controlCenter.PaintingStations.facilities), "painting stations,", len(controlCenter.DropoffStations.facilities), "drop-off stations,", len(controlCenter.AssemblyWorkers.workers), "assembly workers,", len(controlCenter.WeldingWorkers.workers), "welding workers,", len(controlCenter.PaintingWorkers.workers), "painting workers and", len(controlCenter.TransportWorkers.workers), "transport workers\n🌱")
 
 }
 
+// shut the booted factory down by stopping its program time
+// the handlers, stations and workers return once they wait for their next
+// request, so all task sets should be finished before
+func (controlCenter *ControlCenter) Shutdown() {
+	controlCenter.ProgramTime.Stop()
+}
+
 // /////////////// Run Control center /////////////////
 
 func (controlCenter *ControlCenter) RunControlCenter() {
 	//// Request handling ////
 
+	go controlCenter.HandleIntake()
+
 	// on incoming requests:1. assign free pickup station
 	// 						2. notify assigned pickup station
 	// 						3. assign free transportations worker
@@ -252,17 +462,40 @@ func (controlCenter *ControlCenter) RunControlCenter() {
 	// on incoming task:  1. assign free facility of the specific type
 	// 					  2. notify transportation worker
 	// 					  3. assign free workers of the specific type
-	go controlCenter.HandleWeldingAssignments()
-	go controlCenter.HandleAssemblyAssignments()
-	go controlCenter.HandlePaintingAssignments()
-	go controlCenter.HandleDropoffAssignments()
+	// (in the decentralised dispatch mode the transportation robots do this themselves)
+	if controlCenter.dispatchMode == DispatchCentral {
+		go controlCenter.HandlePickupAssignments()
+		go controlCenter.HandleWeldingAssignments()
+		go controlCenter.HandleAssemblyAssignments()
+		go controlCenter.HandlePaintingAssignments()
+		go controlCenter.HandleDropoffAssignments()
+	}
 	go controlCenter.TaskFinishedInbox()
+
+	//// Stuck task detection ////
+	go controlCenter.RunWatchdog()
+
+	//// Raw material deliveries ////
+	go controlCenter.RunDeliveries(controlCenter.PickupStations)
+
+	//// Shipments of finished goods ////
+	go controlCenter.RunShipments(controlCenter.DropoffStations)
 }
 
 func (controlCenter *ControlCenter) TaskFinishedInbox() {
 	for {
-		taskset := <-controlCenter.taskSetFinished
-		fmt.Println("\n✅ taskset", taskset.id, "was completed ✅\n ")
+		var taskset *TaskSet
+		select {
+		case taskset = <-controlCenter.taskSetFinished:
+		case <-controlCenter.ProgramTime.Stopped():
+			return
+		}
+		controlCenter.notifyFinished(taskset)
+		if taskset.failure != "" {
+			controlCenter.events.println("\n❌ taskset", taskset.id, "failed:", taskset.failure, "❌\n ")
+			continue
+		}
+		controlCenter.events.println("\n✅ taskset", taskset.id, "was completed ✅\n ")
 	}
 }
 
@@ -280,24 +513,90 @@ func (controlCenter *ControlCenter) TaskFinishedInbox() {
 // of the welding station (now avoided) where one transporter gets
 // hold of one worker and the other of the other and then forever wait
 // some kind of lock mechanism would have to be used.
+// This is the decentralised dispatch mode, see decentral.go
 
 // get initial request from the trucks and get things going
+// while the factory is paused no new request is dispatched,
+// a request received before is kept pending until the factory resumes
 func (controlCenter *ControlCenter) HandleRequests() {
+	var pending *TaskSet
 	for {
-		// wait for request to arrive
-		request := <-controlCenter.request
-		fmt.Println("\n📨: taskset", request.id, "received.\n ")
-		// assign facility
-		pickupStation := <-controlCenter.PickupStations.freeFacilities
-		request.tasks[0].Facility = pickupStation
-		pickupStation.taskAssignment <- request.tasks[0]
-		// assign free transportation worker
-		transportWorker := <-controlCenter.TransportWorkers.freeWorkers
-		// for all tasks, assign free transportation worker
-		for _, task := range request.tasks {
-			task.Transporter = transportWorker
+		if pending == nil {
+			// wait for request to arrive in the intake queue
+			if pending = controlCenter.intake.pop(controlCenter.kitted, controlCenter.gate.pausing(), controlCenter.ProgramTime.Stopped()); pending == nil {
+				if controlCenter.stopped() {
+					return
+				}
+				controlCenter.gate.parkHandler()
+				continue
+			}
+		}
+		started := time.Now()
+		if !controlCenter.dispatch(pending) {
+			controlCenter.gate.parkHandler()
+			continue
+		}
+		controlCenter.state.handled(dispatchStation, started.Sub(pending.queued), time.Since(started))
+		controlCenter.intake.dispatched(controlCenter.ProgramTime.GetCurrentTime())
+		pending = nil
+	}
+}
+
+// assign a free pickup station and a free transportation worker to the request
+// returns false if the factory was paused before both were free
+func (controlCenter *ControlCenter) dispatch(request *TaskSet) bool {
+	// assign facility if the taskset starts with a pickup
+	// (tasksets recovered from the journal may resume at a later task)
+	first := request.tasks[request.resumeAt()]
+	decision := controlCenter.decide(request.id, dispatchStation)
+	var pickupStation *Facility
+	if first.FacilityType == controlCenter.PickupStations {
+		pickupStation = decision.facility(controlCenter.PickupStations, controlCenter.gate.pausing(), nil)
+		if pickupStation == nil {
+			decision.drop()
+			return false
 		}
-		transportWorker.inbox <- *request
+	}
+	// assign free transportation worker
+	transportWorker := decision.worker(controlCenter.TransportWorkers, controlCenter.gate.pausing())
+	if transportWorker == nil {
+		if pickupStation != nil {
+			pickupStation.free(controlCenter.PickupStations.freeFacilities)
+		}
+		decision.drop()
+		return false
+	}
+	decision.record()
+	if pickupStation != nil {
+		controlCenter.state.facility(pickupStation, statusBusy, request.id)
+	}
+	controlCenter.state.worker(transportWorker, statusBusy, request.id)
+	// notify assigned pickup station
+	if pickupStation != nil {
+		first.Facility = pickupStation
+		pickupStation.taskAssignment <- first
+	}
+	// for all tasks, assign free transportation worker
+	for _, task := range request.tasks {
+		task.Transporter = transportWorker
+	}
+	// load the waiting task sets carried together with the request
+	request.load = controlCenter.loadWith(request, transportWorker)
+	controlCenter.gate.enter()
+	transportWorker.inbox <- *request
+	return true
+}
+
+// handles pickup assignments
+// only used when a task has to be requeued after a station fault,
+// the first pickup of a task set is assigned in HandleRequests
+func (controlCenter *ControlCenter) HandlePickupAssignments() {
+	for {
+		task, ok := controlCenter.nextAssignment(controlCenter.PickupStations)
+		if !ok {
+			return
+		}
+		controlCenter.handleAssignment(task, nil, 0)
 	}
 }
 
@@ -305,19 +604,11 @@ func (controlCenter *ControlCenter) HandleRequests() {
 // assigns free welding facility and welding workers and notifies transportation worker
 func (controlCenter *ControlCenter) HandleWeldingAssignments() {
 	for {
-		task := <-controlCenter.WeldingStations.taskAssignment
-		// assign facility
-		facility := <-task.FacilityType.freeFacilities
-		task.Facility = facility
-		facility.taskAssignment <- task
-		// notify transportation worker
-		task.Transporter.next_facility <- facility
-		// assign workers
-		worker1 := <-controlCenter.WeldingWorkers.freeWorkers
-		worker2 := <-controlCenter.WeldingWorkers.freeWorkers
-		task.assignedWorkers = []*Worker{worker1, worker2}
-		worker1.inbox <- TaskSet{99, []*Task{task}} // 99 is default id for trivial tasks
-		worker2.inbox <- TaskSet{99, []*Task{task}}
+		task, ok := controlCenter.nextAssignment(controlCenter.WeldingStations)
+		if !ok {
+			return
+		}
+		controlCenter.handleAssignment(task, controlCenter.WeldingWorkers, 2)
 	}
 }
 
@@ -325,17 +616,11 @@ func (controlCenter *ControlCenter) HandleWeldingAssignments() {
 // assigns free assembly facility and assembly workers and notifies transportation worker
 func (controlCenter *ControlCenter) HandleAssemblyAssignments() {
 	for {
-		task := <-controlCenter.AssemblyStations.taskAssignment
-		// assign facility
-		facility := <-task.FacilityType.freeFacilities
-		task.Facility = facility
-		facility.taskAssignment <- task
-		// notify transportation worker
-		task.Transporter.next_facility <- facility
-		// assign workers
-		worker := <-controlCenter.AssemblyWorkers.freeWorkers
-		task.assignedWorkers = []*Worker{worker}
-		worker.inbox <- TaskSet{99, []*Task{task}} // 99 is default id for trivial tasks
+		task, ok := controlCenter.nextAssignment(controlCenter.AssemblyStations)
+		if !ok {
+			return
+		}
+		controlCenter.handleAssignment(task, controlCenter.AssemblyWorkers, 1)
 	}
 }
 
@@ -343,17 +628,11 @@ func (controlCenter *ControlCenter) HandleAssemblyAssignments() {
 // assigns free painting facility and painting workers and notifies transportation worker
 func (controlCenter *ControlCenter) HandlePaintingAssignments() {
 	for {
-		task := <-controlCenter.PaintingStations.taskAssignment
-		// assign facility
-		facility := <-task.FacilityType.freeFacilities
-		task.Facility = facility
-		facility.taskAssignment <- task
-		// notify transportation worker
-		task.Transporter.next_facility <- facility
-		// assign workers
-		worker := <-controlCenter.PaintingWorkers.freeWorkers
-		task.assignedWorkers = []*Worker{worker}
-		worker.inbox <- TaskSet{99, []*Task{task}} // 99 is default id for trivial tasks
+		task, ok := controlCenter.nextAssignment(controlCenter.PaintingStations)
+		if !ok {
+			return
+		}
+		controlCenter.handleAssignment(task, controlCenter.PaintingWorkers, 1)
 	}
 }
 
@@ -361,48 +640,270 @@ func (controlCenter *ControlCenter) HandlePaintingAssignments() {
 // assigns free dropoff facility and notifies transportation worker
 func (controlCenter *ControlCenter) HandleDropoffAssignments() {
 	for {
-		task := <-controlCenter.DropoffStations.taskAssignment
-		// assign facility
-		facility := <-task.FacilityType.freeFacilities
-		task.Facility = facility
-		facility.taskAssignment <- task
+		task, ok := controlCenter.nextAssignment(controlCenter.DropoffStations)
+		if !ok {
+			return
+		}
+		controlCenter.handleAssignment(task, nil, 0)
+	}
+}
+
+// wait for the next task sent to the assignment handler of the facility set
+// returns false once the factory is shut down
+func (controlCenter *ControlCenter) nextAssignment(facilitySet *FacilitySet) (*Task, bool) {
+	select {
+	case task := <-facilitySet.taskAssignment:
+		return task, true
+	case <-controlCenter.ProgramTime.Stopped():
+		return nil, false
+	}
+}
+
+// check if the factory is shut down
+func (controlCenter *ControlCenter) stopped() bool {
+	select {
+	case <-controlCenter.ProgramTime.Stopped():
+		return true
+	default:
+		return false
+	}
+}
+
+// assigns a free facility of the task's type and n free workers of the given set
+// to the task and notifies the transportation worker
+// gives up as soon as the task is aborted by the watchdog
+func (controlCenter *ControlCenter) assign(task *Task, workers *WorkerSet, n int) {
+	started := time.Now()
+	defer func() { controlCenter.state.handled(task.FacilityType.facilityType, 0, time.Since(started)) }()
+	// tasks of a facility type with batching are assigned concurrently,
+	// their workers are taken under the claim of the worker set, see batch.go
+	batching := task.FacilityType.batching != nil
+	controlCenter.assignTask(task, workers, n, batching, func(facility *Facility) bool {
 		// notify transportation worker
-		task.Transporter.next_facility <- facility
+		select {
+		case task.Transporter.next_facility <- facility:
+			return true
+		case <-task.aborted():
+			return false
+		}
+	})
+}
+
+// assigns a free facility of the task's type and n free workers of the given set
+// to the task, notify is called with the facility before the workers are assigned
+// or once the task joined a batch
+// with claim only the holder of the claim of the worker set takes workers,
+// see decentral.go and batch.go
+// returns the facility and how long the claim was waited for,
+// nil if the task is aborted meanwhile
+func (controlCenter *ControlCenter) assignTask(task *Task, workers *WorkerSet, n int, claim bool, notify func(*Facility) bool) (*Facility, time.Duration) {
+	// assign facility, the decision is recorded even if the task is aborted
+	decision := controlCenter.decide(task.tasksetID, task.FacilityType.facilityType)
+	facility, joined := controlCenter.awaitFacility(task, decision)
+	if joined {
+		// the task joined a batch, the workers of the batch carry it out
+		decision.drop()
+		if notify != nil {
+			notify(facility)
+		}
+		return facility, 0
+	}
+	defer decision.record()
+	if facility == nil {
+		return nil, 0
+	}
+	task.Facility = facility
+	controlCenter.state.facility(facility, statusBusy, task.tasksetID)
+	task.enterStage(stageWorkers, controlCenter.ProgramTime.GetCurrentTime())
+	facility.openBatch(task)
+	facility.taskAssignment <- task
+	if notify != nil && !notify(facility) {
+		return nil, 0
+	}
+	if n == 0 {
+		task.assignedAt(controlCenter.ProgramTime.GetCurrentTime())
+		return facility, 0
+	}
+	// take the claim of the worker set
+	var waited time.Duration
+	if claim {
+		claiming := time.Now()
+		select {
+		case workers.claim <- struct{}{}:
+		case <-task.aborted():
+			return nil, 0
+		}
+		defer func() { <-workers.claim }()
+		waited = time.Since(claiming)
+	}
+	// assign workers, already assigned workers are freed again if the task is aborted
+	assigned := make([]*Worker, 0, n)
+	for len(assigned) < n {
+		worker := decision.worker(workers, task.aborted())
+		if worker == nil {
+			for _, worker := range assigned {
+				worker.free(workers.freeWorkers)
+			}
+			return nil, 0
+		}
+		controlCenter.state.worker(worker, statusBusy, task.tasksetID)
+		assigned = append(assigned, worker)
+	}
+	task.assignedWorkers = assigned
+	task.assignedAt(controlCenter.ProgramTime.GetCurrentTime())
+	for _, worker := range assigned {
+		worker.inbox <- TaskSet{id: task.tasksetID, tasks: []*Task{task}}
+	}
+	return facility, waited
+}
+
+// get a free worker of the set
+// returns nil if abort is closed before a worker is free
+func (workerSet *WorkerSet) acquire(abort <-chan struct{}) *Worker {
+	select {
+	case worker := <-workerSet.freeWorkers:
+		return worker
+	case <-abort:
+		return nil
 	}
 }
 
 // //////////////////// Run Facilities //////////////////////
 
-func (facility *Facility) work() {
+func (facility *Facility) work(duration int, abort <-chan struct{}) bool {
 	// dummy function that simulates some predetermined
 	// amount of time for the task to be completed
-	time.Sleep(1 * time.Second)
+	select {
+	case <-facility.programTime.After(duration):
+		return true
+	case <-abort:
+		return false
+	}
+}
+
+// wait for n workers to arrive at the facility to carry out the task
+// workers that arrive for another (aborted) task are sent back
+// returns false if the task is aborted before all workers arrived
+func (facility *Facility) awaitWorkers(task *Task, n int, emoji string, freeFacilities chan *Facility) ([]*Worker, bool) {
+	workers := make([]*Worker, 0, n)
+	for len(workers) < n {
+		select {
+		case arrival := <-facility.workerArrival:
+			if arrival.task != task {
+				// the transportation worker of a task that joined the batch stays
+				if !facility.admit(arrival) {
+					arrival.worker.task_completed <- false
+				}
+				continue
+			}
+			// print worker Z arrived at facility Y
+			facility.events.println("[", task.tasksetID, "]", arrival.worker.to_emoji(), " ➢ "+emoji+": ", arrival.worker.specialization.specialization, " worker", arrival.worker.id, "arrived at", facility.facilityType, "station", facility.id)
+			workers = append(workers, arrival.worker)
+		case <-task.aborted():
+			// the workers that already arrived go back, the facility is free again
+			facility.events.println("[", task.tasksetID, "]", "⏰:", facility.facilityType, "station", facility.id, "gave up on task", task.description)
+			facility.notify(workers, false)
+			facility.free(freeFacilities)
+			return nil, false
+		}
+	}
+	// wait for the tasks joining the batch of the task
+	if !facility.gatherBatch(task, workers) {
+		facility.events.println("[", task.tasksetID, "]", "⏰:", facility.facilityType, "station", facility.id, "gave up on task", task.description)
+		facility.notify(workers, false)
+		facility.free(freeFacilities)
+		return nil, false
+	}
+	task.enterStage(stageProcessing, facility.programTime.GetCurrentTime())
+	task.handledBy(workers, facility.programTime.GetCurrentTime())
+	return workers, true
+}
+
+// process the task with the arrived workers
+// returns false if the task was aborted by a station fault or the watchdog
+// or rejected by the quality check, in which case the workers and the tasks
+// of the batch are notified and the facility is taken care of
+func (facility *Facility) process(task *Task, workers []*Worker, freeFacilities chan *Facility) bool {
+	if !facility.changeOver(task) {
+		facility.events.println("[", task.tasksetID, "]", "⏰:", facility.facilityType, "station", facility.id, "aborted the changeover for task", task.description)
+		facility.notify(workers, false)
+		facility.free(freeFacilities)
+		return false
+	}
+	if facility.faulted(task) {
+		facility.notify(workers, false)
+		facility.repair(freeFacilities)
+		return false
+	}
+	if !facility.work(FactoryDurations().workOn(facility.facilityType, task.attributes), task.aborted()) {
+		facility.events.println("[", task.tasksetID, "]", "⏰:", facility.facilityType, "station", facility.id, "aborted task", task.description)
+		facility.notify(workers, false)
+		facility.free(freeFacilities)
+		return false
+	}
+	if facility.rejected(task) {
+		facility.notify(workers, false)
+		facility.release(freeFacilities)
+		return false
+	}
+	return true
+}
+
+// notify all workers at a facility whether their task is completed
+func notifyWorkers(workers []*Worker, completed bool) {
+	for _, worker := range workers {
+		worker.task_completed <- completed
+	}
 }
 
 // pickup station (only 1 transportation worker per 1 pickup station)
+// wait for the next task assigned to the facility
+// returns false once the factory is shut down
+func (facility *Facility) nextTask() (*Task, bool) {
+	select {
+	case task := <-facility.taskAssignment:
+		return task, true
+	case <-facility.programTime.Stopped():
+		return nil, false
+	}
+}
+
 func (pickupStation *Facility) RunPickupStation(freeFacilities chan *Facility) {
 	for {
 		// wait for task to arrive
-		task := <-pickupStation.taskAssignment
+		task, ok := pickupStation.nextTask()
+		if !ok {
+			return
+		}
 		// print task X arrived at pickup station Y
-		fmt.Println("[", task.tasksetID, "]", "📝 ➢ 📤: task", task.description, "arrived at pickup station", pickupStation.id)
+		pickupStation.events.println("[", task.tasksetID, "]", "📝 ➢ 📤: task", task.description, "arrived at pickup station", pickupStation.id)
 		// wait for transportation worker to arrive
-		transportWorker := <-pickupStation.workerArrival
-		// print transportation worker Z arrived at pickup station Y
-		fmt.Println("[", task.tasksetID, "]", "🚚 ➢ 📤: transportation worker", transportWorker.id, "arrived at pickup station", pickupStation.id)
+		workers, ok := pickupStation.awaitWorkers(task, 1, "📤", freeFacilities)
+		if !ok {
+			continue
+		}
 		// check that the correct worker type arrived, not strictly necessary as guarantueed by how the
 		// control center operatores
-		if transportWorker.specialization.specialization != "transport" {
+		if workers[0].specialization.specialization != "transport" {
 			log.Fatal("Wrong worker arrived at Pickup-Station!")
 		}
-		// do pickup (sleep)
-		pickupStation.work()
+		// take the raw materials from the stock, a stockout blocks or fails the pickup
+		if !pickupStation.withdraw(task) {
+			pickupStation.notify(workers, false)
+			pickupStation.free(freeFacilities)
+			continue
+		}
+		// do pickup (sleep), a fault or timeout aborts the task and its materials go back into the stock
+		if !pickupStation.process(task, workers, freeFacilities) {
+			pickupStation.putBack(task)
+			continue
+		}
 		// notify transportation worker that task is completed
-		transportWorker.task_completed <- true
+		pickupStation.notify(workers, true)
 		// free facility
-		freeFacilities <- pickupStation
+		pickupStation.release(freeFacilities)
 		// print pickup station Y is free again
-		fmt.Println("[", task.tasksetID, "]", "🕊️ : Pickup station", pickupStation.id, "is free again")
+		pickupStation.events.println("[", task.tasksetID, "]", "🕊️ : Pickup station", pickupStation.id, "is free again")
 	}
 }
 
@@ -410,31 +911,33 @@ func (pickupStation *Facility) RunPickupStation(freeFacilities chan *Facility) {
 func (assemblyStation *Facility) RunAssemblyStation(freeFacilities chan *Facility) {
 	for {
 		// wait for task to arrive
-		task := <-assemblyStation.taskAssignment
+		task, ok := assemblyStation.nextTask()
+		if !ok {
+			return
+		}
 		// print task X arrived at assembly station Y
-		fmt.Println("[", task.tasksetID, "]", "📝 ➢ 🦾: task", task.description, "arrived at assembly station", assemblyStation.id)
-		// wait for first worker to arrive
-		worker1 := <-assemblyStation.workerArrival
-		// print first worker Z arrived at assembly station Y
-		fmt.Println("[", task.tasksetID, "]", worker1.to_emoji(), " ➢ 🦾: ", worker1.specialization.specialization, " worker", worker1.id, "arrived at assembly station", assemblyStation.id)
-		// wait for second worker to arrive
-		worker2 := <-assemblyStation.workerArrival
-		// print second worker Z arrived at assembly station Y
-		fmt.Println("[", task.tasksetID, "]", worker2.to_emoji(), " ➢ 🦾: ", worker2.specialization.specialization, " worker", worker2.id, "arrived at assembly station", assemblyStation.id)
+		assemblyStation.events.println("[", task.tasksetID, "]", "📝 ➢ 🦾: task", task.description, "arrived at assembly station", assemblyStation.id)
+		// wait for both workers to arrive
+		workers, ok := assemblyStation.awaitWorkers(task, 2, "🦾", freeFacilities)
+		if !ok {
+			continue
+		}
+		worker1, worker2 := workers[0], workers[1]
 		// check correct workers arrived
 		if !((worker1.specialization.specialization == "transport") && (worker2.specialization.specialization == "assembly") || (worker2.specialization.specialization == "transport") && (worker1.specialization.specialization == "assembly")) {
 			log.Fatal("Wrong workers arrived at Assembly-Station!")
 		}
-		// do assembly (sleep)
-		assemblyStation.work()
-		fmt.Println("[", task.tasksetID, "]", "🦾 ➢ ✅: assembly task finished")
+		// do assembly (sleep), a fault or timeout aborts the task
+		if !assemblyStation.process(task, workers, freeFacilities) {
+			continue
+		}
+		assemblyStation.events.println("[", task.tasksetID, "]", "🦾 ➢ ✅: assembly task finished")
 		// notify all assigned workers that task is completed
-		worker1.task_completed <- true
-		worker2.task_completed <- true
+		assemblyStation.notify(workers, true)
 		// free facility
-		freeFacilities <- assemblyStation
+		assemblyStation.release(freeFacilities)
 		// print type of facility Y is free again
-		fmt.Println("[", task.tasksetID, "]", "🕊️ : Assembly station", assemblyStation.id, "is free again")
+		assemblyStation.events.println("[", task.tasksetID, "]", "🕊️ : Assembly station", assemblyStation.id, "is free again")
 	}
 }
 
@@ -442,25 +945,21 @@ func (assemblyStation *Facility) RunAssemblyStation(freeFacilities chan *Facilit
 func (weldingStation *Facility) RunWeldingStation(freeFacilities chan *Facility) {
 	for {
 		// wait for task to arrive
-		task := <-weldingStation.taskAssignment
+		task, ok := weldingStation.nextTask()
+		if !ok {
+			return
+		}
 		// print task X arrived at welding station Y
-		fmt.Println("[", task.tasksetID, "]", "📝 ➢ 🔨: task", task.description, "arrived at welding station", weldingStation.id)
-		// wait for first worker to arrive
-		worker1 := <-weldingStation.workerArrival
-		// print first worker Z arrived at welding station Y
-		fmt.Println("[", task.tasksetID, "]", worker1.to_emoji(), " ➢ 🔨: ", worker1.specialization.specialization, " worker", worker1.id, "arrived at welding station", weldingStation.id)
-		// wait for second worker to arrive
-		worker2 := <-weldingStation.workerArrival
-		// print second worker Z arrived at welding station Y
-		fmt.Println("[", task.tasksetID, "]", worker2.to_emoji(), " ➢ 🔨: ", worker2.specialization.specialization, " worker", worker2.id, "arrived at welding station", weldingStation.id)
-		// wait for third worker to arrive
-		worker3 := <-weldingStation.workerArrival
-		// print third worker Z arrived at welding station Y
-		fmt.Println("[", task.tasksetID, "]", worker3.to_emoji(), " ➢ 🔨: ", worker3.specialization.specialization, " worker", worker3.id, "arrived at welding station", weldingStation.id)
+		weldingStation.events.println("[", task.tasksetID, "]", "📝 ➢ 🔨: task", task.description, "arrived at welding station", weldingStation.id)
+		// wait for all three workers to arrive
+		workers, ok := weldingStation.awaitWorkers(task, 3, "🔨", freeFacilities)
+		if !ok {
+			continue
+		}
 		// check correct workers arrived
 		weld_count := 0
 		tranp_count := 0
-		for _, worker := range []*Worker{worker1, worker2, worker3} {
+		for _, worker := range workers {
 			if worker.specialization.specialization == "welding" {
 				weld_count++
 			} else if worker.specialization.specialization == "transport" {
@@ -470,17 +969,17 @@ func (weldingStation *Facility) RunWeldingStation(freeFacilities chan *Facility)
 		if !((weld_count == 2) && (tranp_count == 1)) {
 			log.Fatal("Wrong workers arrived at Welding-Station!")
 		}
-		// do welding (sleep)
-		weldingStation.work()
-		fmt.Println("[", task.tasksetID, "]", "🔨 ➢ ✅: welding task finished")
+		// do welding (sleep), a fault or timeout aborts the task
+		if !weldingStation.process(task, workers, freeFacilities) {
+			continue
+		}
+		weldingStation.events.println("[", task.tasksetID, "]", "🔨 ➢ ✅: welding task finished")
 		// notify all assigned workers that task is completed
-		worker1.task_completed <- true
-		worker2.task_completed <- true
-		worker3.task_completed <- true
+		weldingStation.notify(workers, true)
 		// free facility
-		freeFacilities <- weldingStation
+		weldingStation.release(freeFacilities)
 		// print type of facility Y is free again
-		fmt.Println("[", task.tasksetID, "]", "🕊️ : Welding station", weldingStation.id, "is free again")
+		weldingStation.events.println("[", task.tasksetID, "]", "🕊️ : Welding station", weldingStation.id, "is free again")
 	}
 }
 
@@ -488,31 +987,33 @@ func (weldingStation *Facility) RunWeldingStation(freeFacilities chan *Facility)
 func (paintingStation *Facility) RunPaintingStation(freeFacilities chan *Facility) {
 	for {
 		// wait for task to arrive
-		task := <-paintingStation.taskAssignment
+		task, ok := paintingStation.nextTask()
+		if !ok {
+			return
+		}
 		// print task X arrived at painting station Y
-		fmt.Println("[", task.tasksetID, "]", "📝 ➢ 🎨: task", task.description, "arrived at painting station", paintingStation.id)
-		// wait for first worker to arrive
-		worker1 := <-paintingStation.workerArrival
-		// print first worker Z arrived at painting station Y
-		fmt.Println("[", task.tasksetID, "]", worker1.to_emoji(), " ➢ 🎨: ", worker1.specialization.specialization, " worker", worker1.id, "arrived at painting station", paintingStation.id)
-		// wait second worker to arrive
-		worker2 := <-paintingStation.workerArrival
-		// print second worker Z arrived at painting station Y
-		fmt.Println("[", task.tasksetID, "]", worker2.to_emoji(), " ➢ 🎨: ", worker2.specialization.specialization, " worker", worker2.id, "arrived at painting station", paintingStation.id)
+		paintingStation.events.println("[", task.tasksetID, "]", "📝 ➢ 🎨: task", task.description, "arrived at painting station", paintingStation.id)
+		// wait for both workers to arrive
+		workers, ok := paintingStation.awaitWorkers(task, 2, "🎨", freeFacilities)
+		if !ok {
+			continue
+		}
+		worker1, worker2 := workers[0], workers[1]
 		// assert correct workers arrived
 		if !((worker1.specialization.specialization == "transport") && (worker2.specialization.specialization == "painting") || (worker2.specialization.specialization == "transport") && (worker1.specialization.specialization == "painting")) {
 			log.Fatal("Wrong workers arrived at Assembly-Station!")
 		}
-		// do painting (sleep)
-		paintingStation.work()
-		fmt.Println("[", task.tasksetID, "]", "🎨 ➢ ✅: painting task finished")
+		// do painting (sleep), a fault or timeout aborts the task
+		if !paintingStation.process(task, workers, freeFacilities) {
+			continue
+		}
+		paintingStation.events.println("[", task.tasksetID, "]", "🎨 ➢ ✅: painting task finished")
 		// notify all assigned workers that task is completed
-		worker1.task_completed <- true
-		worker2.task_completed <- true
+		paintingStation.notify(workers, true)
 		// free facility
-		freeFacilities <- paintingStation
+		paintingStation.release(freeFacilities)
 		// print type of facility Y is free again
-		fmt.Println("[", task.tasksetID, "]", "🕊️ : Painting station", paintingStation.id, "is free again")
+		paintingStation.events.println("[", task.tasksetID, "]", "🕊️ : Painting station", paintingStation.id, "is free again")
 	}
 }
 
@@ -520,26 +1021,41 @@ func (paintingStation *Facility) RunPaintingStation(freeFacilities chan *Facilit
 func (dropoffStation *Facility) RunDropoffStation(freeFacilities chan *Facility) {
 	for {
 		// wait for task to arrive
-		task := <-dropoffStation.taskAssignment
+		task, ok := dropoffStation.nextTask()
+		if !ok {
+			return
+		}
 		// print task X arrived at dropoff station Y
-		fmt.Println("[", task.tasksetID, "]", "📝 ➢ ✈: task", task.description, "arrived at dropoff station", dropoffStation.id)
+		dropoffStation.events.println("[", task.tasksetID, "]", "📝 ➢ ✈: task", task.description, "arrived at dropoff station", dropoffStation.id)
 		// wait for transportation worker to arrive
-		transportWorker := <-dropoffStation.workerArrival
-		// print transportation worker Z arrived at dropoff station Y
-		fmt.Println("[", task.tasksetID, "]", "🚚 ➢ ✈: transportation worker", transportWorker.id, "arrived at dropoff station", dropoffStation.id)
+		workers, ok := dropoffStation.awaitWorkers(task, 1, "✈", freeFacilities)
+		if !ok {
+			continue
+		}
 		// check correct workers arrived
-		if transportWorker.specialization.specialization != "transport" {
+		if workers[0].specialization.specialization != "transport" {
 			log.Fatal("Wrong worker arrived at Dropoff-Station!")
 		}
-		// do dropoff (sleep)
-		dropoffStation.work()
+		// wait for room for the finished goods, a timeout aborts the task
+		if !dropoffStation.makeRoom(task) {
+			dropoffStation.events.println("[", task.tasksetID, "]", "⏰:", dropoffStation.facilityType, "station", dropoffStation.id, "gave up on task", task.description)
+			dropoffStation.notify(workers, false)
+			dropoffStation.free(freeFacilities)
+			continue
+		}
+		// do dropoff (sleep), a fault or timeout aborts the task
+		if !dropoffStation.process(task, workers, freeFacilities) {
+			continue
+		}
+		// keep the finished goods until they are shipped
+		dropoffStation.store(task)
 		// notify transportation worker that task is completed
-		fmt.Println("[", task.tasksetID, "]", "✈ ➢ ✅: dropoff task finished")
-		transportWorker.task_completed <- true
+		dropoffStation.events.println("[", task.tasksetID, "]", "✈ ➢ ✅: dropoff task finished")
+		dropoffStation.notify(workers, true)
 		// free facility
-		freeFacilities <- dropoffStation
+		dropoffStation.release(freeFacilities)
 		// print type of facility Y is free again
-		fmt.Println("[", task.tasksetID, "]", "🕊️ : Dropoff station", dropoffStation.id, "is free again")
+		dropoffStation.events.println("[", task.tasksetID, "]", "🕊️ : Dropoff station", dropoffStation.id, "is free again")
 	}
 }
 
@@ -561,52 +1077,209 @@ func (worker *Worker) to_emoji() string {
 	}
 }
 
+// wait for the next task set sent to the worker
+// returns false once the factory is shut down
+func (worker *Worker) nextTaskSet() (TaskSet, bool) {
+	select {
+	case taskset := <-worker.inbox:
+		return taskset, true
+	case <-worker.specialization.programTime.Stopped():
+		return TaskSet{}, false
+	}
+}
+
 func (worker *Worker) commute() {
 	// dummy function that simulates some predetermined
 	// amount of time for traveling between facilities
-	time.Sleep(1 * time.Second)
+	worker.specialization.programTime.Wait(1)
+	worker.drain(worker.specialization.power.policy.Commute)
+}
+
+// notify the facility that the worker arrived to carry out the task
+// returns false if the worker broke down on the way or
+// the task was aborted before the worker arrived
+func (worker *Worker) arrive(facility *Facility, task *Task) bool {
+	if worker.brokeDown(facility, task) {
+		return false
+	}
+	select {
+	case facility.workerArrival <- Arrival{worker, task}:
+		// the work on the task takes energy from the battery
+		worker.drain(worker.specialization.power.policy.Work)
+		return true
+	case <-task.aborted():
+		return false
+	}
 }
 
 // transportation worker
 func (transportWorker *Worker) RunTransportWorker(controlCenter *ControlCenter, backToControl chan *Worker) {
 	for {
 		// wait for task to arrive
-		taskset := <-transportWorker.inbox
-		// print task X arrived at transportation worker Y
-		fmt.Println("📝 ➢➢ 🚚: taskset", taskset.id, "arrived at transportation worker", transportWorker.id)
-		// go to pickup station, commute (sleep)
-		transportWorker.commute()
-		// notify assigned pickup station
-		taskset.tasks[0].Facility.workerArrival <- transportWorker
-		// wait for task to be completed
-		<-transportWorker.task_completed
-		// go through all other tasks
-		for _, task := range taskset.tasks[1:] {
-			// send handling request to control center
-			task.FacilityType.taskAssignment <- task
-			// wait for next facility
-			next_facility := <-transportWorker.next_facility
-			// print next facility
-			fmt.Println("[", taskset.id, "]", "🚚: next facility of transportation worker", transportWorker.id, "is", next_facility.facilityType, "number", next_facility.id)
-			// transport, commute (sleep)
-			transportWorker.commute()
-			// notify next assigned facility
-			next_facility.workerArrival <- transportWorker
-			// wait for task to be completed
-			<-transportWorker.task_completed
-			// set task as completed
-			task.completed = true
+		taskset, ok := transportWorker.nextTaskSet()
+		if !ok {
+			return
+		}
+		load := newTransportLoad(taskset)
+		for p, part := range load.parts {
+			// print task X arrived at transportation worker Y
+			transportWorker.specialization.events.println("📝 ➢➢ 🚚: taskset", part.id, "arrived at transportation worker", transportWorker.id)
+			part.startTimings()
+			if load.next[p] == len(part.tasks) {
+				controlCenter.finish(part)
+			}
+		}
+		// go through all tasks that are not completed yet stop by stop, the pickup
+		// station of the first one was already assigned by the control center
+		for first := true; ; first = false {
+			// wait in between two stops while the factory is paused
+			if !first {
+				controlCenter.gate.parkTransporter(transportWorker, load)
+			}
+			stop, served := controlCenter.nextStop(load)
+			if stop == nil {
+				break
+			}
+			load.head(stop)
+			for _, p := range served {
+				part, i := load.parts[p], load.next[p]
+				if !transportWorker.carryOut(controlCenter, part, i, load) {
+					load.next[p] = len(part.tasks)
+					controlCenter.finish(part)
+					continue
+				}
+				controlCenter.journal.completed(part, i, controlCenter.ProgramTime.GetCurrentTime())
+				load.at = part.tasks[i].Facility
+				if load.next[p]++; load.next[p] == len(part.tasks) {
+					controlCenter.finish(part)
+				}
+			}
 		}
-		controlCenter.taskSetFinished <- &taskset
-		controlCenter.CompletedTaskSets++
 		// go back to control center, commute (sleep)
+		controlCenter.state.trip(0)
+		for range load.parts {
+			controlCenter.state.singleLoadTrip(false)
+		}
 		transportWorker.commute()
 		// worker notifies control center
 		// print transportation worker Y arrived at control center
-		fmt.Println("[", taskset.id, "]", "🏠:", "transport worker", transportWorker.id, "arrived at control center")
+		transportWorker.specialization.events.println("[", taskset.id, "]", "🏠:", "transport worker", transportWorker.id, "arrived at control center")
+		// charge the battery if it runs low, a paused factory waits for it
+		transportWorker.recharge()
 		// the worker is taking the specific "entrance" for workers of his specialization
 		// think of a control center with a room for the transporters, welders, ...
-		backToControl <- transportWorker
+		transportWorker.free(backToControl)
+		controlCenter.gate.leave()
+	}
+}
+
+// report a task set of a transportation worker that is finished or failed
+func (controlCenter *ControlCenter) finish(taskset *TaskSet) {
+	controlCenter.journal.finished(taskset, controlCenter.ProgramTime.GetCurrentTime())
+	if taskset.failure != "" {
+		controlCenter.deadLetter(taskset)
+	}
+	controlCenter.state.finished(taskset)
+	controlCenter.taskSetFinished <- taskset
+}
+
+// carry out the i-th task of the taskset of a transportation worker
+// a failed attempt (station fault, worker breakdown, rejected by quality check
+// or aborted by the watchdog) is retried according to the retry policy of the
+// facility type
+// the worker travels to the station unless it is already at a station of
+// the type with another part of its load
+// returns false if the task could not be completed, the reason is stored in the taskset
+func (transportWorker *Worker) carryOut(controlCenter *ControlCenter, taskset *TaskSet, i int, load *transportLoad) bool {
+	task := taskset.tasks[i]
+	policy := task.FacilityType.retryPolicy
+	controlCenter.state.atTask(taskset, i, transportWorker)
+	timing := &taskset.timings[i]
+	timing.Started = controlCenter.ProgramTime.GetCurrentTime()
+	for attempt := 1; ; attempt++ {
+		timing.Attempts = attempt
+		started := controlCenter.ProgramTime.GetCurrentTime()
+		// an assembly waits in the kitting area until its kit is complete,
+		// the watchdog does not time the wait
+		kitted := controlCenter.awaitKit(task, transportWorker, load)
+		controlCenter.watch(task)
+		completed := false
+		facility := task.Facility
+		if !kitted {
+			facility = nil
+		} else if facility != nil {
+			// facility was assigned together with the taskset
+			task.enterStage(stageWorkers, controlCenter.ProgramTime.GetCurrentTime())
+		} else {
+			facility = transportWorker.request(controlCenter, task)
+		}
+		if facility != nil {
+			timing.Facility = facility.id
+			// print next facility
+			transportWorker.specialization.events.println("[", task.tasksetID, "]", "🚚: next facility of transportation worker", transportWorker.id, "is", facility.facilityType, "number", facility.id)
+			// transport, commute (sleep)
+			if load.departs() || attempt > 1 {
+				controlCenter.state.trip(load.onBoard())
+				transportWorker.commute()
+			}
+			controlCenter.state.singleLoadTrip(i > 0)
+			// notify next assigned facility and wait for task to be completed
+			if transportWorker.arrive(facility, task) {
+				completed = <-transportWorker.task_completed
+			}
+		}
+		controlCenter.unwatch(task)
+		if completed {
+			controlCenter.assemble(taskset, task)
+		}
+		controlCenter.traceAttempt(taskset, i, attempt, transportWorker, facility, started, completed)
+		if completed {
+			controlCenter.supply(taskset, task)
+			// set task as completed
+			task.completed = true
+			timing.Completed = true
+			timing.Finished = controlCenter.ProgramTime.GetCurrentTime()
+			timing.Waited = task.waited()
+			timing.Batched = task.batched
+			return true
+		}
+		reason := task.abortReason()
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			timing.Finished = controlCenter.ProgramTime.GetCurrentTime()
+			taskset.failure = fmt.Sprintf("%s (gave up after %d attempts)", reason, attempt)
+			return false
+		}
+		// print task X is retried
+		backoff := policy.backoff(attempt)
+		transportWorker.specialization.events.println("[", task.tasksetID, "]", "♻️ : task", task.description, "failed:", reason, "- retry", attempt, "in", backoff, "time units")
+		controlCenter.ProgramTime.Wait(backoff)
+		controlCenter.state.retriedTask()
+		task = task.retry()
+		if policy.DifferentStation {
+			task.avoid = facility
+		}
+		taskset.tasks[i] = task
+	}
+}
+
+// send handling request to control center and wait for next facility
+// returns nil if the task was aborted meanwhile
+func (transportWorker *Worker) request(controlCenter *ControlCenter, task *Task) *Facility {
+	if controlCenter.dispatchMode == DispatchDecentral {
+		return transportWorker.acquire(controlCenter, task)
+	}
+	sent := time.Now()
+	select {
+	case task.FacilityType.taskAssignment <- task:
+		transportWorker.specialization.state.waited(task.FacilityType.facilityType, time.Since(sent))
+	case <-task.aborted():
+		return nil
+	}
+	select {
+	case next_facility := <-transportWorker.next_facility:
+		return next_facility
+	case <-task.aborted():
+		return nil
 	}
 }
 
@@ -614,22 +1287,27 @@ func (transportWorker *Worker) RunTransportWorker(controlCenter *ControlCenter,
 func (assemblyWorker *Worker) RunAssemblyWorker(backToControl chan *Worker) {
 	for {
 		// wait for task to arrive
-		taskset := <-assemblyWorker.inbox
+		taskset, ok := assemblyWorker.nextTaskSet()
+		if !ok {
+			return
+		}
 		task := taskset.tasks[0]
 		// print task X arrived at assembly worker Y
-		fmt.Println("[", task.tasksetID, "]", "📝 ➢ 👷: task", task.description, "arrived at assembly worker", assemblyWorker.id)
+		assemblyWorker.specialization.events.println("[", task.tasksetID, "]", "📝 ➢ 👷: task", task.description, "arrived at assembly worker", assemblyWorker.id)
 		// go to assembly station, commute (sleep)
 		assemblyWorker.commute()
-		// notify assigned assembly station
-		task.Facility.workerArrival <- assemblyWorker
-		// wait for task to be completed
-		<-assemblyWorker.task_completed
+		// notify assigned assembly station and wait for task to be completed
+		if assemblyWorker.arrive(task.Facility, task) {
+			<-assemblyWorker.task_completed
+		}
 		// go back to control center, commute (sleep)
 		assemblyWorker.commute()
 		// print assembly worker Y arrived at control center
-		fmt.Println("[", task.tasksetID, "]", "🏠:", "assembly worker", assemblyWorker.id, "arrived at control center")
+		assemblyWorker.specialization.events.println("[", task.tasksetID, "]", "🏠:", "assembly worker", assemblyWorker.id, "arrived at control center")
+		// charge the battery if it runs low
+		assemblyWorker.recharge()
 		// notify control center
-		backToControl <- assemblyWorker
+		assemblyWorker.free(backToControl)
 	}
 }
 
@@ -637,22 +1315,27 @@ func (assemblyWorker *Worker) RunAssemblyWorker(backToControl chan *Worker) {
 func (weldingWorker *Worker) RunWeldingWorker(backToControl chan *Worker) {
 	for {
 		// wait for task to arrive
-		taskset := <-weldingWorker.inbox
+		taskset, ok := weldingWorker.nextTaskSet()
+		if !ok {
+			return
+		}
 		task := taskset.tasks[0]
 		// print task X arrived at welding worker Y
-		fmt.Println("[", task.tasksetID, "]", "📝 ➢ 🧑‍: task", task.description, "arrived at welding worker", weldingWorker.id)
+		weldingWorker.specialization.events.println("[", task.tasksetID, "]", "📝 ➢ 🧑‍: task", task.description, "arrived at welding worker", weldingWorker.id)
 		// go to welding station, commute (sleep)
 		weldingWorker.commute()
-		// notify assigned welding station
-		task.Facility.workerArrival <- weldingWorker
-		// wait for task to be completed
-		<-weldingWorker.task_completed
+		// notify assigned welding station and wait for task to be completed
+		if weldingWorker.arrive(task.Facility, task) {
+			<-weldingWorker.task_completed
+		}
 		// go back to control center, commute (sleep)
 		weldingWorker.commute()
 		// print welding worker Y arrived at control center
-		fmt.Println("[", task.tasksetID, "]", "🏠:", "welding worker", weldingWorker.id, "arrived at control center")
+		weldingWorker.specialization.events.println("[", task.tasksetID, "]", "🏠:", "welding worker", weldingWorker.id, "arrived at control center")
+		// charge the battery if it runs low
+		weldingWorker.recharge()
 		// notify control center
-		backToControl <- weldingWorker
+		weldingWorker.free(backToControl)
 	}
 }
 
@@ -660,25 +1343,57 @@ func (weldingWorker *Worker) RunWeldingWorker(backToControl chan *Worker) {
 func (paintingWorker *Worker) RunPaintingWorker(backToControl chan *Worker) {
 	for {
 		// wait for task to arrive
-		taskset := <-paintingWorker.inbox
+		taskset, ok := paintingWorker.nextTaskSet()
+		if !ok {
+			return
+		}
 		task := taskset.tasks[0]
 		// print task X arrived at painting worker Y
-		fmt.Println("[", task.tasksetID, "]", "📝 ➢ 🧑‍: task", task.description, "arrived at painting worker", paintingWorker.id)
+		paintingWorker.specialization.events.println("[", task.tasksetID, "]", "📝 ➢ 🧑‍: task", task.description, "arrived at painting worker", paintingWorker.id)
 		// go to painting station, commute (sleep)
 		paintingWorker.commute()
-		// notify assigned painting station
-		task.Facility.workerArrival <- paintingWorker
-		// wait for task to be completed
-		<-paintingWorker.task_completed
+		// notify assigned painting station and wait for task to be completed
+		if paintingWorker.arrive(task.Facility, task) {
+			<-paintingWorker.task_completed
+		}
 		// go back to control center, commute (sleep)
 		paintingWorker.commute()
 		// print painting worker Y arrived at control center
-		fmt.Println("[", task.tasksetID, "]", "🏠:", "painting worker", paintingWorker.id, "arrived at control center")
+		paintingWorker.specialization.events.println("[", task.tasksetID, "]", "🏠:", "painting worker", paintingWorker.id, "arrived at control center")
+		// charge the battery if it runs low
+		paintingWorker.recharge()
 		// notify control center
-		backToControl <- paintingWorker
+		paintingWorker.free(backToControl)
 	}
 }
 
+// creates a facility of a certain type that is always available
+func newFacility(id int, facilityType string, programTime *ProgramTime, state *stateStore, events *eventLog) *Facility {
+	return &Facility{id: id, facilityType: facilityType, workerArrival: make(chan Arrival), taskAssignment: make(chan *Task), programTime: programTime, state: state, events: events}
+}
+
+// ///////// Event log ///////////
+
+// events of a factory, all go routines of the factory print to the same log
+type eventLog struct {
+	mutex  sync.Mutex
+	output io.Writer
+}
+
+// print an event, the operands are formatted like fmt.Println does
+func (events *eventLog) println(a ...any) {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+	fmt.Fprintln(events.output, a...)
+}
+
+// print the events of the factory to output instead of the standard output,
+// e. g. io.Discard to keep a simulated factory quiet
+// must be called before the factory is booted
+func (controlCenter *ControlCenter) SetOutput(output io.Writer) {
+	controlCenter.events.output = output
+}
+
 // ///////// Build factory ///////////
 // construct the factory with the control center struct
 // factory has:
@@ -691,94 +1406,214 @@ func (paintingWorker *Worker) RunPaintingWorker(backToControl chan *Worker) {
 //	D facilities on drop-off stations
 func BuildFactory(pickupStations int, assemblyStations int, weldingStations int, paintingStations int, dropoffStations int, assemblyWorkers int, weldingWorkers int, paintingWorkers int, transportWorkers int, program_time *ProgramTime) ControlCenter {
 
+	// all facilities and workers report their status to the same store
+	// and print their events to the same log
+	state := newStateStore()
+	events := &eventLog{output: os.Stdout}
+
 	// Start by creating the facility sets
 
 	// Generate the pickup station set with I pickup stations
-	pickups := FacilitySet{make([]*Facility, pickupStations), "pickup", make(chan *Facility, pickupStations), make(chan *Task)}
+	pickups := FacilitySet{facilities: make([]*Facility, pickupStations), facilityType: "pickup", freeFacilities: make(chan *Facility, pickupStations), taskAssignment: make(chan *Task)}
 	for i := 0; i < pickupStations; i++ {
-		pickups.facilities[i] = &Facility{i, "pickup", make(chan *Worker), make(chan *Task)}
+		pickups.facilities[i] = newFacility(i, "pickup", program_time, state, events)
 	}
 
 	// Generate the assembly station set with A assembly stations
-	assemblies := FacilitySet{make([]*Facility, assemblyStations), "assembly", make(chan *Facility, assemblyStations), make(chan *Task)}
+	assemblies := FacilitySet{facilities: make([]*Facility, assemblyStations), facilityType: "assembly", freeFacilities: make(chan *Facility, assemblyStations), taskAssignment: make(chan *Task)}
 	for i := 0; i < assemblyStations; i++ {
-		assemblies.facilities[i] = &Facility{i, "assembly", make(chan *Worker), make(chan *Task)}
+		assemblies.facilities[i] = newFacility(i, "assembly", program_time, state, events)
 	}
 
 	// Generate the welding station set with W welding stations
-	weldings := FacilitySet{make([]*Facility, weldingStations), "welding", make(chan *Facility, weldingStations), make(chan *Task)}
+	weldings := FacilitySet{facilities: make([]*Facility, weldingStations), facilityType: "welding", freeFacilities: make(chan *Facility, weldingStations), taskAssignment: make(chan *Task)}
 	for i := 0; i < weldingStations; i++ {
-		weldings.facilities[i] = &Facility{i, "welding", make(chan *Worker), make(chan *Task)}
+		weldings.facilities[i] = newFacility(i, "welding", program_time, state, events)
 	}
 
 	// Generate the painting station set with P painting stations
-	paintings := FacilitySet{make([]*Facility, paintingStations), "painting", make(chan *Facility, paintingStations), make(chan *Task)}
+	paintings := FacilitySet{facilities: make([]*Facility, paintingStations), facilityType: "painting", freeFacilities: make(chan *Facility, paintingStations), taskAssignment: make(chan *Task)}
 	for i := 0; i < paintingStations; i++ {
-		paintings.facilities[i] = &Facility{i, "painting", make(chan *Worker), make(chan *Task)}
+		paintings.facilities[i] = newFacility(i, "painting", program_time, state, events)
 	}
 
 	// Generate the dropoff station set with D dropoff stations
-	dropoffs := FacilitySet{make([]*Facility, dropoffStations), "dropoff", make(chan *Facility, dropoffStations), make(chan *Task)}
+	dropoffs := FacilitySet{facilities: make([]*Facility, dropoffStations), facilityType: "dropoff", freeFacilities: make(chan *Facility, dropoffStations), taskAssignment: make(chan *Task)}
 	for i := 0; i < dropoffStations; i++ {
-		dropoffs.facilities[i] = &Facility{i, "dropoff", make(chan *Worker), make(chan *Task)}
+		dropoffs.facilities[i] = newFacility(i, "dropoff", program_time, state, events)
+		dropoffs.facilities[i].warehouse = newWarehouse()
 	}
 
+	// Generate the charging station set, the battery policy adds the stations
+	chargers := FacilitySet{facilityType: "charging"}
+	power := &powerSupply{stations: &chargers}
+
 	// Generate the worker sets
 
 	// Generate the assembly worker set with N assembly workers
-	assemblers := WorkerSet{make([]*Worker, assemblyWorkers), "assembly", make(chan *Worker, assemblyWorkers)}
+	assemblers := WorkerSet{workers: make([]*Worker, assemblyWorkers), specialization: "assembly", freeWorkers: make(chan *Worker, assemblyWorkers), claim: make(chan struct{}, 1), programTime: program_time, state: state, events: events, power: power}
 	for i := 0; i < assemblyWorkers; i++ {
-		assemblers.workers[i] = &Worker{i, nil, make(chan TaskSet), make(chan *Facility), make(chan bool)}
+		assemblers.workers[i] = &Worker{i, nil, make(chan TaskSet), make(chan *Facility), make(chan bool), &battery{}}
 	}
 
 	// Generate the welding worker set with N welding workers
-	welders := WorkerSet{make([]*Worker, weldingWorkers), "welding", make(chan *Worker, weldingWorkers)}
+	welders := WorkerSet{workers: make([]*Worker, weldingWorkers), specialization: "welding", freeWorkers: make(chan *Worker, weldingWorkers), claim: make(chan struct{}, 1), programTime: program_time, state: state, events: events, power: power}
 	for i := 0; i < weldingWorkers; i++ {
-		welders.workers[i] = &Worker{i, nil, make(chan TaskSet), make(chan *Facility), make(chan bool)}
+		welders.workers[i] = &Worker{i, nil, make(chan TaskSet), make(chan *Facility), make(chan bool), &battery{}}
 	}
 
 	// Generate the painting worker set with N painting workers
-	painters := WorkerSet{make([]*Worker, paintingWorkers), "painting", make(chan *Worker, paintingWorkers)}
+	painters := WorkerSet{workers: make([]*Worker, paintingWorkers), specialization: "painting", freeWorkers: make(chan *Worker, paintingWorkers), claim: make(chan struct{}, 1), programTime: program_time, state: state, events: events, power: power}
 	for i := 0; i < paintingWorkers; i++ {
-		painters.workers[i] = &Worker{i, nil, make(chan TaskSet), make(chan *Facility), make(chan bool)}
+		painters.workers[i] = &Worker{i, nil, make(chan TaskSet), make(chan *Facility), make(chan bool), &battery{}}
 	}
 
 	// Generate the transportation worker set with N transportation workers
-	transporters := WorkerSet{make([]*Worker, transportWorkers), "transport", make(chan *Worker, transportWorkers)}
+	transporters := WorkerSet{workers: make([]*Worker, transportWorkers), specialization: "transport", freeWorkers: make(chan *Worker, transportWorkers), claim: make(chan struct{}, 1), programTime: program_time, state: state, events: events, power: power}
 	for i := 0; i < transportWorkers; i++ {
-		transporters.workers[i] = &Worker{i, nil, make(chan TaskSet), make(chan *Facility), make(chan bool)}
+		transporters.workers[i] = &Worker{i, nil, make(chan TaskSet), make(chan *Facility), make(chan bool), &battery{}}
 	}
 
 	// Create the control center
-	controlCenter := ControlCenter{&pickups, &assemblies, &weldings, &paintings, &dropoffs, &assemblers, &welders, &painters, &transporters, make(chan *TaskSet), make(chan *Worker), make(chan *TaskSet), program_time, 0}
+	controlCenter := ControlCenter{
+		PickupStations:   &pickups,
+		AssemblyStations: &assemblies,
+		WeldingStations:  &weldings,
+		PaintingStations: &paintings,
+		DropoffStations:  &dropoffs,
+		ChargingStations: &chargers,
+		AssemblyWorkers:  &assemblers,
+		WeldingWorkers:   &welders,
+		PaintingWorkers:  &painters,
+		TransportWorkers: &transporters,
+		request:          make(chan *TaskSet),
+		workerArrival:    make(chan *Worker),
+		taskSetFinished:  make(chan *TaskSet),
+		ProgramTime:      program_time,
+		state:            state,
+		events:           events,
+		watched:          &watchList{tasks: make(map[*Task]bool)},
+		deadLetters:      &deadLetterQueue{},
+		orders:           newOrderBook(),
+		trace:            &traceStore{},
+		kitting:          newKittingArea(),
+		power:            power,
+		gate:             newPauseGate(),
+		notifier:         newNotifier(),
+		intake:           newIntakeQueue(),
+		dispatchMode:     defaultDispatchMode,
+	}
 	return controlCenter
 }
 
+// layout of a factory, the number of facilities and workers of each kind
+type Layout struct {
+	PickupStations   int
+	AssemblyStations int
+	WeldingStations  int
+	PaintingStations int
+	DropoffStations  int
+	AssemblyWorkers  int
+	WeldingWorkers   int
+	PaintingWorkers  int
+	TransportWorkers int
+}
+
+// construct a factory with the layout
+func (layout Layout) Build(program_time *ProgramTime) ControlCenter {
+	return BuildFactory(layout.PickupStations, layout.AssemblyStations, layout.WeldingStations, layout.PaintingStations, layout.DropoffStations, layout.AssemblyWorkers, layout.WeldingWorkers, layout.PaintingWorkers, layout.TransportWorkers, program_time)
+}
+
+// layout of the factory
+func (controlCenter *ControlCenter) Layout() Layout {
+	return Layout{
+		PickupStations:   len(controlCenter.PickupStations.facilities),
+		AssemblyStations: len(controlCenter.AssemblyStations.facilities),
+		WeldingStations:  len(controlCenter.WeldingStations.facilities),
+		PaintingStations: len(controlCenter.PaintingStations.facilities),
+		DropoffStations:  len(controlCenter.DropoffStations.facilities),
+		AssemblyWorkers:  len(controlCenter.AssemblyWorkers.workers),
+		WeldingWorkers:   len(controlCenter.WeldingWorkers.workers),
+		PaintingWorkers:  len(controlCenter.PaintingWorkers.workers),
+		TransportWorkers: len(controlCenter.TransportWorkers.workers),
+	}
+}
+
 // //////// Simple Task Set generator ///////////
 
+// creates a task for a facility of the given type
+func newTask(facilityType *FacilitySet, description string, tasksetID int) *Task {
+	return &Task{FacilityType: facilityType, description: description, tasksetID: tasksetID, watch: newTaskWatch()}
+}
+
+// copy of a task for a new attempt, without the progress of the task
+func (task *Task) clone() *Task {
+	cloned := newTask(task.FacilityType, task.description, task.tasksetID)
+	cloned.materials = task.materials
+	cloned.goods = task.goods
+	cloned.attributes = task.attributes
+	cloned.supplies = task.supplies
+	cloned.kit = task.kit
+	return cloned
+}
+
 // generates a task set with the specified id, stations and tasks
 // stations and tasks must be of the same length
 func gen_task_set(control_center *ControlCenter, id int, stations []string, tasks []string) TaskSet {
-	taskset := TaskSet{id, make([]*Task, len(tasks))}
+	taskset := TaskSet{id: id, tasks: make([]*Task, len(tasks))}
 	for i, station := range stations {
-		switch station {
-		case "pickup":
-			taskset.tasks[i] = &Task{control_center.PickupStations, nil, nil, tasks[i], nil, false, id}
-		case "welding":
-			taskset.tasks[i] = &Task{control_center.WeldingStations, nil, nil, tasks[i], nil, false, id}
-		case "assembly":
-			taskset.tasks[i] = &Task{control_center.AssemblyStations, nil, nil, tasks[i], nil, false, id}
-		case "painting":
-			taskset.tasks[i] = &Task{control_center.PaintingStations, nil, nil, tasks[i], nil, false, id}
-		case "dropoff":
-			taskset.tasks[i] = &Task{control_center.DropoffStations, nil, nil, tasks[i], nil, false, id}
-		default:
-			fmt.Println("Error: task", station, "not recognized")
+		facilitySet := control_center.facilitySet(station)
+		if facilitySet == nil {
+			control_center.events.println("Error: task", station, "not recognized")
+			continue
 		}
+		taskset.tasks[i] = newTask(facilitySet, tasks[i], id)
 	}
 	return taskset
 }
 
+// get the facility set of a station type, nil if there is no such type
+func (controlCenter *ControlCenter) facilitySet(station string) *FacilitySet {
+	switch station {
+	case "pickup":
+		return controlCenter.PickupStations
+	case "welding":
+		return controlCenter.WeldingStations
+	case "assembly":
+		return controlCenter.AssemblyStations
+	case "painting":
+		return controlCenter.PaintingStations
+	case "dropoff":
+		return controlCenter.DropoffStations
+	}
+	return nil
+}
+
+// get the worker set of a specialization, nil if there is no such specialization
+func (controlCenter *ControlCenter) workerSet(specialization string) *WorkerSet {
+	switch specialization {
+	case "assembly":
+		return controlCenter.AssemblyWorkers
+	case "welding":
+		return controlCenter.WeldingWorkers
+	case "painting":
+		return controlCenter.PaintingWorkers
+	case "transport":
+		return controlCenter.TransportWorkers
+	}
+	return nil
+}
+
+// index of the first task of the taskset that is not completed yet
+func (taskset *TaskSet) resumeAt() int {
+	for i, task := range taskset.tasks {
+		if !task.completed {
+			return i
+		}
+	}
+	return len(taskset.tasks)
+}
+
 // //////////////////// Main //////////////////////
 func main() {
 	// Start program time
@@ -791,34 +1626,251 @@ func main() {
 	I := 2 // I facilities on pick-up stations
 	D := 2 // D facilities on drop-off stations
 
+	// optional write-ahead log to recover unfinished task sets after a crash
+	journalPath := flag.String("journal", "", "journal file of the task sets, recovered on start")
+	// optional snapshot of a paused factory to continue from
+	snapshotPath := flag.String("restore", "", "snapshot file of a paused factory to continue from")
+	// optional recording and replay of the dispatch decisions
+	recordPath := flag.String("record", "", "file the dispatch decisions of the run are saved to")
+	replayPath := flag.String("replay", "", "file of recorded dispatch decisions to replay")
+	// optional capacity plan of the layout instead of a run
+	plan := flag.Bool("plan", false, "print the capacity plan of the factory for the demo task sets and exit")
+	// optional search of the cheapest layout for a service level instead of a run
+	optimize := flag.Bool("optimize", false, "print the layouts meeting the service level for the demo task sets, cheapest first, and exit")
+	throughput := flag.Float64("throughput", 0.5, "task sets per unit of program time the optimized layout has to complete")
+	latency := flag.Int("latency", 0, "p95 latency of a task set the optimized layout has to meet, 0 if not bounded")
+	// optional queueing estimates of the layout instead of a run
+	queues := flag.Bool("queues", false, "print the queueing estimates for the demo task sets arriving at the target throughput next to a simulated run and exit")
+	// optional load generator for a soak test instead of the demo task sets
+	load := flag.String("load", "", "arrival process of generated task sets: poisson, bursty, shift or a CSV trace of time,product id,quantity")
+	rate := flag.Float64("rate", 0.1, "mean rate of the generated task sets per unit of program time")
+	soak := flag.Int("soak", 600, "program time the load generator runs")
+	// optional product catalogue and orders instead of the demo ones
+	cataloguePath := flag.String("catalogue", "", "JSON file of the products and their routing recipes")
+	ordersPath := flag.String("orders", "", "JSON file of the orders submitted on a fresh start")
+	// optional batching of the painting stations
+	batchSize := flag.Int("batch", 0, "parts of the same kind a painting station paints at once, 0 paints one at a time")
+	batchWait := flag.Int("batch-wait", 2, "program time a painting station waits for its batch to fill")
+	// optional colour changeovers of the painting stations
+	changeover := flag.Int("changeover", 0, "program time a painting station needs to change the colour, 0 changes it at once")
+	groupSetups := flag.Bool("group-setups", false, "prefer painting stations already set up for the colour of a task")
+	// optional raw material inventory of the pickup stations
+	stock := flag.Int("stock", 0, "units of steel every pickup station starts with and gets every 20 time units, 0 keeps no inventory")
+	// optional capacity limits and shipments of the dropoff stations
+	ship := flag.Int("ship", 0, "program time between the shipments of the finished goods, 0 never ships")
+	shelf := flag.Int("shelf", 0, "units of each product a dropoff station holds at most, 0 is unlimited")
+	// optional traceability records of the tasks
+	tracePath := flag.String("traceability", "", "file the traceability records are saved to on exit, CSV if it ends in .csv and JSON otherwise")
+	// optional load capacity of the transportation workers
+	capacity := flag.Int("capacity", 1, "task sets a transportation worker carries at once")
+	nearest := flag.Bool("nearest", false, "route the transportation workers to the nearest station type instead of the one most parts head to")
+	// optional batteries of the workers
+	batteryCapacity := flag.Int("battery", 0, "energy of the batteries of the workers, a commute takes 1 and a task 2, 0 means no batteries")
+	chargers := flag.Int("chargers", 1, "number of charging stations, the workers charge below a quarter of their battery")
+	flag.Parse()
+
+	catalogue := DefaultCatalogue()
+	if *cataloguePath != "" {
+		var err error
+		if catalogue, err = LoadCatalogue(*cataloguePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	orders := []Order{{ID: "demo-1", Product: "bar"}, {ID: "demo-2", Product: "wool"}, {ID: "demo-3", Product: "pot"}}
+	if *ordersPath != "" {
+		var err error
+		if orders, err = LoadOrders(*ordersPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// Build the factory with specified number of facilities and workers
 	controlCenter := BuildFactory(I, A, W, P, D, N, N, N, N, programTime)
+	if *snapshotPath != "" {
+		snapshot, err := LoadSnapshot(*snapshotPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if controlCenter, err = RestoreFactory(snapshot); err != nil {
+			log.Fatal(err)
+		}
+		programTime = controlCenter.ProgramTime
+	}
+	controlCenter.PaintingStations.SetBatchPolicy(BatchPolicy{Size: *batchSize, MaxWait: *batchWait})
+	if *changeover > 0 || *groupSetups {
+		controlCenter.PaintingStations.SetSetupPolicy(SetupPolicy{Attribute: "colour", Default: *changeover, Group: *groupSetups})
+	}
+	if *capacity > 1 && *snapshotPath == "" {
+		policy := TransportPolicy{Capacity: *capacity, Reach: 1}
+		if *nearest {
+			policy.Route = RouteNearest
+		}
+		controlCenter.SetTransportPolicy(policy)
+	}
+	if *batteryCapacity > 0 && *snapshotPath == "" {
+		controlCenter.SetBatteryPolicy(BatteryPolicy{Capacity: *batteryCapacity, Commute: 1, Work: 2, Threshold: *batteryCapacity / 4, ChargeRate: 5, Stations: *chargers})
+	}
+	if *stock > 0 && *snapshotPath == "" {
+		controlCenter.PickupStations.SetInventory(InventoryPolicy{Deliveries: []Delivery{{Station: -1, Material: "steel", Quantity: *stock, Start: programTime.GetCurrentTime() + 20, Every: 20}}})
+		for _, pickupStation := range controlCenter.PickupStations.facilities {
+			pickupStation.SetStock("steel", *stock)
+		}
+	}
+	if (*ship > 0 || *shelf > 0) && *snapshotPath == "" {
+		policy := ShippingPolicy{Capacity: make(map[string]int)}
+		for id := range catalogue {
+			policy.Capacity[id] = *shelf
+		}
+		if *ship > 0 {
+			policy.Shipments = []Shipment{{Station: -1, Start: programTime.GetCurrentTime() + *ship, Every: *ship}}
+		}
+		controlCenter.DropoffStations.SetShippingPolicy(policy)
+	}
+
+	// Plan the capacity for task sets like the demo ones
+	if *plan {
+		capacity, err := PlanCapacity(controlCenter.Layout(), FactoryDurations(), OrderMix{{Route: []string{"pickup", "welding", "assembly", "painting", "dropoff"}, Share: 1}}, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(capacity)
+		return
+	}
+
+	// Search the cheapest layout for task sets like the demo ones
+	demoRoute := []string{"pickup", "welding", "assembly", "painting", "dropoff"}
+	demoMix := OrderMix{{Route: demoRoute, Share: 1, Product: "steel bar"}, {Route: demoRoute, Share: 1, Product: "steel wool"}, {Route: demoRoute, Share: 1, Product: "steel pot"}}
+	if *optimize {
+		// the events of the simulated factories are discarded, only the table is shown
+		whatIf := WhatIf{Mix: demoMix, SLA: SLA{*throughput, *latency}, Costs: DefaultUnitCosts()}
+		candidates, err := whatIf.Optimize()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(candidates)
+		return
+	}
+
+	// Estimate the queues for task sets like the demo ones and check the estimates
+	if *queues {
+		estimates, err := EstimateQueues(controlCenter.Layout(), FactoryDurations(), demoMix, *throughput)
+		if err != nil {
+			log.Fatal(err)
+		}
+		simulation, err := Simulate(controlCenter.Layout(), demoMix, *throughput, 200, time.Millisecond, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(CompareQueues(estimates, simulation))
+		return
+	}
+
+	// Recover from the journal
+	var recovered []*TaskSet
+	if *journalPath != "" {
+		journal, err := OpenJournal(*journalPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer journal.Close()
+		controlCenter.UseJournal(journal)
+		if recovered, err = controlCenter.Recover(*journalPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Replay or record the dispatch decisions
+	if *replayPath != "" {
+		decisions, err := LoadDecisions(*replayPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		controlCenter.Replay(decisions)
+	}
+	if *recordPath != "" {
+		controlCenter.RecordDecisions()
+	}
 
 	// Boot the control center
 	go controlCenter.Boot()
 
-	/////////////////////// Simple Test ///////////////////////
-	tasksetA := gen_task_set(&controlCenter, 1, []string{"pickup", "welding", "assembly", "painting", "dropoff"}, []string{"pickup steel bar", "weld steel bar", "assemble steel bar", "paint steel bar in blue", "dropoff steel bar"})
-	controlCenter.request <- &tasksetA
+	// resume the unfinished task sets of the last run
+	for _, taskset := range recovered {
+		if _, err := controlCenter.Submit(taskset); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	tasksetB := gen_task_set(&controlCenter, 2, []string{"pickup", "welding", "assembly", "painting", "dropoff"}, []string{"pickup steel wool", "weld steel wool", "assemble steel wool", "paint steel wool in red", "dropoff steel wool"})
-	controlCenter.request <- &tasksetB
+	/////////////////////// Soak Test ///////////////////////
+	// generated task sets instead of the demo ones, the handles are waited for below
+	if *load != "" {
+		arrivals, err := NewArrivalProcess(*load, *rate)
+		if err != nil {
+			log.Fatal(err)
+		}
+		generator := LoadGenerator{Catalogue: catalogue, Mix: catalogue.Mix(), Arrivals: arrivals, Seed: time.Now().UnixNano(), Duration: *soak, FirstID: controlCenter.State().CompletedTaskSets + controlCenter.State().FailedTaskSets + len(recovered) + 1}
+		if _, err := generator.Run(&controlCenter, nil); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	tasksetC := gen_task_set(&controlCenter, 3, []string{"pickup", "welding", "assembly", "painting", "dropoff"}, []string{"pickup steel pot", "weld steel pot", "assemble steel pot", "paint steel pot in green", "dropoff steel pot"})
-	controlCenter.request <- &tasksetC
+	/////////////////////// Simple Test ///////////////////////
+	// only submitted on a fresh start, otherwise they are already in the journal
+	if *load == "" && *snapshotPath == "" && len(recovered) == 0 && controlCenter.State().CompletedTaskSets+controlCenter.State().FailedTaskSets == 0 {
+		id := 1
+		for _, order := range orders {
+			tasksets, err := catalogue.Expand(&controlCenter, order, id)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for i := range tasksets {
+				if _, err := controlCenter.Submit(&tasksets[i]); err != nil {
+					log.Fatal(err)
+				}
+			}
+			id += len(tasksets)
+		}
+	}
 
 	// dummy "keep-alive-system"
 	// in the real world, the factory work "forever"
 	// and process requests as they come in
-	for programTime.GetCurrentTime() < 100 {
-		time.Sleep(1 * time.Second)
-		// if all task sets are completed wait 2 seconds
-		// for transport workers to return to control center
-		if controlCenter.CompletedTaskSets == 3 {
-			time.Sleep(2 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+	for _, handle := range controlCenter.Unfinished() {
+		if _, err := handle.Wait(ctx); err != nil {
+			fmt.Println("taskset", handle.ID(), "is not finished:", err)
 			break
 		}
 	}
+	// if all task sets are finished wait 2 seconds
+	// for transport workers to return to control center
+	time.Sleep(2 * time.Second)
+
+	// fulfilment of the customer orders
+	for _, order := range controlCenter.Fulfilment() {
+		fmt.Println("📦: order", order.Order, "is", order.Status, "with", order.Finished, "of", order.Ordered, "units finished and", order.Shipped, "shipped")
+	}
+
+	// trips of the transportation workers compared to one part per trip
+	trips := controlCenter.State().Transport
+	fmt.Printf("🚚: %d trips, %d of them empty, %.1f parts on board on average - one part per trip takes %d trips, %d of them empty\n", trips.Trips, trips.EmptyTrips, trips.MeanLoad(), trips.SingleLoadTrips, trips.SingleLoadEmptyTrips)
+
+	// charging of the batteries
+	if batteries := controlCenter.State().Batteries; controlCenter.power.policy.Capacity > 0 {
+		fmt.Println("🔋:", batteries.Charges, "charges taking", batteries.ChargingTime, "time units after waiting", batteries.Waited, "time units for a charging station,", batteries.Depleted, "batteries ran empty")
+	}
+
+	if *recordPath != "" {
+		if err := SaveDecisions(*recordPath, controlCenter.Decisions()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *tracePath != "" {
+		if err := SaveTrace(*tracePath, controlCenter.TraceRecords()); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	// program terminates
 }
@@ -15,23 +15,12 @@ import (
 
 // return a number of current free workers
 func FreeWorkersCount(controlCenter *ControlCenter) int {
-	var workers int = 0
-	workers += len(controlCenter.TransportWorkers.freeWorkers)
-	workers += len(controlCenter.AssemblyWorkers.freeWorkers)
-	workers += len(controlCenter.PaintingWorkers.freeWorkers)
-	workers += len(controlCenter.WeldingWorkers.freeWorkers)
-	return workers
+	return controlCenter.State().FreeWorkers()
 }
 
 // return a number of current free facilities
 func FreeFacilitiesCount(controlCenter *ControlCenter) int {
-	var facilities int = 0
-	facilities += len(controlCenter.PickupStations.freeFacilities)
-	facilities += len(controlCenter.DropoffStations.freeFacilities)
-	facilities += len(controlCenter.AssemblyStations.freeFacilities)
-	facilities += len(controlCenter.PaintingStations.freeFacilities)
-	facilities += len(controlCenter.WeldingStations.freeFacilities)
-	return facilities
+	return controlCenter.State().FreeFacilities()
 }
 
 ////////////////////////// Test Cases //////////////////////////
@@ -65,8 +54,8 @@ func TestNoPickup(t *testing.T) {
 	}
 
 	// task should not be completed
-	if controlCenter.CompletedTaskSets != 0 {
-		t.Errorf("Pickup station is missing, number of completed task should be 0, not %d", controlCenter.CompletedTaskSets)
+	if controlCenter.State().CompletedTaskSets != 0 {
+		t.Errorf("Pickup station is missing, number of completed task should be 0, not %d", controlCenter.State().CompletedTaskSets)
 	}
 }
 
@@ -99,8 +88,8 @@ func TestNoDropoff(t *testing.T) {
 	}
 
 	// task should not be completed
-	if controlCenter.CompletedTaskSets != 0 {
-		t.Errorf("Dropoff station is missing, number of completed task should be 0, not %d", controlCenter.CompletedTaskSets)
+	if controlCenter.State().CompletedTaskSets != 0 {
+		t.Errorf("Dropoff station is missing, number of completed task should be 0, not %d", controlCenter.State().CompletedTaskSets)
 	}
 }
 
@@ -130,15 +119,15 @@ func TestPickupAndDropoffStation(t *testing.T) {
 	// Simulate the passage of time for 10 seconds
 	for programTime.GetCurrentTime() < 10 {
 		time.Sleep(1 * time.Second)
-		if controlCenter.CompletedTaskSets == 1 {
+		if controlCenter.State().CompletedTaskSets == 1 {
 			time.Sleep(2 * time.Second)
 			break
 		}
 	}
 
 	// Check if the pickup and dropoff task is complete
-	if controlCenter.CompletedTaskSets != 1 {
-		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.CompletedTaskSets)
+	if controlCenter.State().CompletedTaskSets != 1 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.State().CompletedTaskSets)
 	}
 }
 
@@ -167,15 +156,15 @@ func TestWeldingStation(t *testing.T) {
 
 	for programTime.GetCurrentTime() < 10 {
 		time.Sleep(1 * time.Second)
-		if controlCenter.CompletedTaskSets == 1 {
+		if controlCenter.State().CompletedTaskSets == 1 {
 			time.Sleep(2 * time.Second)
 			break
 		}
 	}
 
 	// Check if the welding task is complete
-	if controlCenter.CompletedTaskSets != 1 {
-		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.CompletedTaskSets)
+	if controlCenter.State().CompletedTaskSets != 1 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.State().CompletedTaskSets)
 	}
 }
 
@@ -204,15 +193,15 @@ func TestPaintingStation(t *testing.T) {
 
 	for programTime.GetCurrentTime() < 10 {
 		time.Sleep(1 * time.Second)
-		if controlCenter.CompletedTaskSets == 1 {
+		if controlCenter.State().CompletedTaskSets == 1 {
 			time.Sleep(2 * time.Second)
 			break
 		}
 	}
 
 	// Check if the painting task is complete
-	if controlCenter.CompletedTaskSets != 1 {
-		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.CompletedTaskSets)
+	if controlCenter.State().CompletedTaskSets != 1 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.State().CompletedTaskSets)
 	}
 }
 
@@ -241,15 +230,15 @@ func TestAssemblyStation(t *testing.T) {
 
 	for programTime.GetCurrentTime() < 10 {
 		time.Sleep(1 * time.Second)
-		if controlCenter.CompletedTaskSets == 1 {
+		if controlCenter.State().CompletedTaskSets == 1 {
 			time.Sleep(2 * time.Second)
 			break
 		}
 	}
 
 	// Check if the assembly task is complete
-	if controlCenter.CompletedTaskSets != 1 {
-		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.CompletedTaskSets)
+	if controlCenter.State().CompletedTaskSets != 1 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.State().CompletedTaskSets)
 	}
 }
 
@@ -278,15 +267,15 @@ func TestFree(t *testing.T) {
 
 	for programTime.GetCurrentTime() < 20 {
 		time.Sleep(1 * time.Second)
-		if controlCenter.CompletedTaskSets == 1 {
+		if controlCenter.State().CompletedTaskSets == 1 {
 			time.Sleep(2 * time.Second)
 			break
 		}
 	}
 
 	// check if all tasks are done
-	if controlCenter.CompletedTaskSets != 1 {
-		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.CompletedTaskSets)
+	if controlCenter.State().CompletedTaskSets != 1 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.State().CompletedTaskSets)
 	}
 
 	// check if all workers are free
@@ -330,15 +319,15 @@ func TestAllCompletedTaskSets(t *testing.T) {
 
 	for programTime.GetCurrentTime() < 30 {
 		time.Sleep(1 * time.Second)
-		if controlCenter.CompletedTaskSets == 3 {
+		if controlCenter.State().CompletedTaskSets == 3 {
 			time.Sleep(2 * time.Second)
 			break
 		}
 	}
 
 	// check if all tasks are done
-	if controlCenter.CompletedTaskSets != 3 {
-		t.Errorf("Total number of tasks done in Factory is %d, want 3", controlCenter.CompletedTaskSets)
+	if controlCenter.State().CompletedTaskSets != 3 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 3", controlCenter.State().CompletedTaskSets)
 		t.Errorf("If failed, check if the program time is correct")
 	}
 
@@ -395,15 +384,15 @@ func TestComplexTasks(t *testing.T) {
 
 	for programTime.GetCurrentTime() < 50 {
 		time.Sleep(1 * time.Second)
-		if controlCenter.CompletedTaskSets == 5 {
+		if controlCenter.State().CompletedTaskSets == 5 {
 			time.Sleep(2 * time.Second)
 			break
 		}
 	}
 
 	// check if all tasks are done
-	if controlCenter.CompletedTaskSets != 5 {
-		t.Errorf("Total number of tasks done in Factory is %d, want 5", controlCenter.CompletedTaskSets)
+	if controlCenter.State().CompletedTaskSets != 5 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 5", controlCenter.State().CompletedTaskSets)
 		t.Errorf("If failed, check if the program time is correct")
 	}
 
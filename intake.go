@@ -0,0 +1,284 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the intake queue of the control center
+
+// Submitted task sets wait in the intake queue until the request handler
+// dispatches them, the one with the highest priority first and task sets
+// of the same priority in the order they were submitted. A task set whose
+// kit is not complete yet (see kitting.go) stays in the queue and the task
+// sets behind it go first, so it does not hold a transportation worker.
+// The queue is unbounded unless a capacity is set. When a bounded queue is
+// full, a new task set is handled according to the intake policy:
+//  - block: the submitter waits until there is space again
+//  - reject: the task set is rejected with ErrIntakeFull
+//  - drop lowest priority: the waiting task set with the lowest priority is
+//    dropped to make space, a new task set with the lowest priority itself
+//    is rejected with ErrIntakeFull
+// Every waiting task set has a position in the queue and an estimated
+// start, which is based on the recent rate of dispatches.
+
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// what happens to a new task set when the intake queue is full
+type IntakePolicy int
+
+const (
+	IntakeBlock IntakePolicy = iota
+	IntakeReject
+	IntakeDropLowest
+)
+
+// error of a task set that did not fit into the full intake queue
+var ErrIntakeFull = errors.New("intake queue is full")
+
+// number of recent dispatches the estimated start is based on
+const dispatchHistory = 10
+
+// position of a waiting task set in the intake queue
+type QueuedTaskSet struct {
+	ID             int
+	Priority       int
+	Position       int // 0 is the task set dispatched next
+	EstimatedStart int // estimated program time of the dispatch
+}
+
+// intake queue of the control center
+type intakeQueue struct {
+	mutex      sync.Mutex
+	capacity   int // maximum number of waiting task sets, 0 means unbounded
+	policy     IntakePolicy
+	waiting    []*TaskSet    // by priority, then in the order they were submitted
+	head       *TaskSet      // taken by the request handler, not dispatched yet
+	changed    chan struct{} // closed and replaced whenever the queue changes
+	dispatches []int         // program times of the recent dispatches
+}
+
+func newIntakeQueue() *intakeQueue {
+	return &intakeQueue{changed: make(chan struct{})}
+}
+
+// //////////////////// Configuration //////////////////////
+
+// set the priority of a task set, higher priorities are dispatched first
+// must be called before the task set is submitted
+func (taskset *TaskSet) SetPriority(priority int) {
+	taskset.priority = priority
+}
+
+// bound the intake queue and set the policy for a full queue
+// must be called before the factory is booted
+func (controlCenter *ControlCenter) SetIntake(capacity int, policy IntakePolicy) {
+	controlCenter.intake.capacity = capacity
+	controlCenter.intake.policy = policy
+}
+
+// //////////////////// Submitting //////////////////////
+
+// submit a task set and get its handle
+// depending on the intake policy, blocks while the intake queue is full or
+// returns ErrIntakeFull
+func (controlCenter *ControlCenter) Submit(taskset *TaskSet) (*TaskSetHandle, error) {
+	handle := controlCenter.notifier.open(taskset.id, true)
+	if err := controlCenter.enqueue(taskset); err != nil {
+		controlCenter.notifier.discard(handle)
+		return nil, err
+	}
+	return handle, nil
+}
+
+// take task sets sent to the request channel into the intake queue
+func (controlCenter *ControlCenter) HandleIntake() {
+	for {
+		var taskset *TaskSet
+		select {
+		case taskset = <-controlCenter.request:
+		case <-controlCenter.ProgramTime.Stopped():
+			return
+		}
+		controlCenter.notifier.open(taskset.id, false)
+		if err := controlCenter.enqueue(taskset); err != nil {
+			controlCenter.events.println("\n🚫: taskset", taskset.id, "rejected:", err, "\n ")
+			controlCenter.notifier.discard(controlCenter.Handle(taskset.id))
+		}
+	}
+}
+
+// put a task set into the intake queue
+// the task set is recorded before the request handler can take it
+func (controlCenter *ControlCenter) enqueue(taskset *TaskSet) error {
+	return controlCenter.intake.push(taskset, func(dropped *TaskSet) {
+		controlCenter.events.println("\n📨: taskset", taskset.id, "received.\n ")
+		taskset.submitted = controlCenter.ProgramTime.GetCurrentTime()
+		taskset.queued = time.Now()
+		controlCenter.state.received(taskset)
+		controlCenter.bookUnit(taskset)
+		controlCenter.journal.submitted(taskset, controlCenter.ProgramTime.GetCurrentTime())
+		if dropped != nil {
+			controlCenter.events.println("\n🗑️ : taskset", dropped.id, "dropped for taskset", taskset.id, "\n ")
+			controlCenter.state.dropped(dropped)
+			controlCenter.journal.dropped(dropped, controlCenter.ProgramTime.GetCurrentTime())
+			controlCenter.notifyDropped(dropped)
+		}
+	})
+}
+
+// add a task set to the queue according to its priority
+// admit is called with the task set dropped to make space for it, if any,
+// right before the task set is added
+func (queue *intakeQueue) push(taskset *TaskSet, admit func(dropped *TaskSet)) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	var dropped *TaskSet
+	for queue.capacity > 0 && len(queue.waiting) >= queue.capacity {
+		if queue.policy == IntakeReject {
+			return ErrIntakeFull
+		}
+		if queue.policy == IntakeDropLowest {
+			// the last waiting task set has the lowest priority
+			lowest := queue.waiting[len(queue.waiting)-1]
+			if lowest.priority >= taskset.priority {
+				return ErrIntakeFull
+			}
+			queue.waiting = queue.waiting[:len(queue.waiting)-1]
+			dropped = lowest
+			break
+		}
+		changed := queue.changed
+		queue.mutex.Unlock()
+		<-changed
+		queue.mutex.Lock()
+	}
+	admit(dropped)
+	i := len(queue.waiting)
+	for i > 0 && queue.waiting[i-1].priority < taskset.priority {
+		i--
+	}
+	queue.waiting = append(queue.waiting, nil)
+	copy(queue.waiting[i+1:], queue.waiting[i:])
+	queue.waiting[i] = taskset
+	queue.notify()
+	return nil
+}
+
+// //////////////////// Dispatching //////////////////////
+
+// take the next task set that is ready out of the queue
+// returns nil if abort or stop is closed before a task set is ready
+func (queue *intakeQueue) pop(ready func(*TaskSet) bool, abort, stop <-chan struct{}) *TaskSet {
+	for {
+		queue.mutex.Lock()
+		for i, taskset := range queue.waiting {
+			if !ready(taskset) {
+				continue
+			}
+			queue.head = taskset
+			queue.waiting = append(queue.waiting[:i:i], queue.waiting[i+1:]...)
+			queue.notify()
+			queue.mutex.Unlock()
+			return queue.head
+		}
+		changed := queue.changed
+		queue.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-abort:
+			return nil
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// take up to n waiting task sets that match out of the queue, in the order
+// they are dispatched, without waiting for them
+func (queue *intakeQueue) take(n int, match func(*TaskSet) bool) []*TaskSet {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	var taken, kept []*TaskSet
+	for _, taskset := range queue.waiting {
+		if len(taken) < n && match(taskset) {
+			taken = append(taken, taskset)
+		} else {
+			kept = append(kept, taskset)
+		}
+	}
+	if len(taken) > 0 {
+		queue.waiting = kept
+		queue.notify()
+	}
+	return taken
+}
+
+// the task set taken out of the queue was dispatched
+func (queue *intakeQueue) dispatched(now int) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.head = nil
+	queue.dispatches = append(queue.dispatches, now)
+	if len(queue.dispatches) > dispatchHistory {
+		queue.dispatches = queue.dispatches[1:]
+	}
+}
+
+// wake up everybody waiting for a change of the queue
+// must be called with the mutex held
+func (queue *intakeQueue) notify() {
+	close(queue.changed)
+	queue.changed = make(chan struct{})
+}
+
+// wake up the request handler when a waiting task set may have become ready
+func (queue *intakeQueue) wake() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.notify()
+}
+
+// //////////////////// Queries //////////////////////
+
+// get all waiting task sets in the order they are dispatched
+func (controlCenter *ControlCenter) Queue() []QueuedTaskSet {
+	queue := controlCenter.intake
+	now := controlCenter.ProgramTime.GetCurrentTime()
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	// the task sets are dispatched at the mean rate of the recent dispatches
+	span, dispatches := 0, 1
+	if n := len(queue.dispatches); n > 1 {
+		span, dispatches = queue.dispatches[n-1]-queue.dispatches[0], n-1
+	}
+	var queued []QueuedTaskSet
+	for i, taskset := range queue.contents() {
+		queued = append(queued, QueuedTaskSet{taskset.id, taskset.priority, i, now + i*span/dispatches})
+	}
+	return queued
+}
+
+// get the position and estimated start of a waiting task set
+// false if the task set is not waiting
+func (controlCenter *ControlCenter) QueuePosition(id int) (QueuedTaskSet, bool) {
+	for _, queued := range controlCenter.Queue() {
+		if queued.ID == id {
+			return queued, true
+		}
+	}
+	return QueuedTaskSet{}, false
+}
+
+// the task set taken by the request handler and the waiting task sets
+// must be called with the mutex held
+func (queue *intakeQueue) contents() []*TaskSet {
+	var contents []*TaskSet
+	if queue.head != nil {
+		contents = append(contents, queue.head)
+	}
+	return append(contents, queue.waiting...)
+}
@@ -0,0 +1,115 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the intake queue
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test that a full intake queue rejects new task sets
+func TestIntakeReject(t *testing.T) {
+	// the factory is not booted, so nothing leaves the queue
+	controlCenter := BuildFactory(1, 0, 0, 0, 1, 1, 1, 1, 1, StartProgramTime())
+	controlCenter.SetIntake(2, IntakeReject)
+
+	for id := 1; id <= 3; id++ {
+		taskset := gen_task_set(&controlCenter, id, []string{"pickup", "dropoff"}, []string{"pickup steel bar", "dropoff steel bar"})
+		_, err := controlCenter.Submit(&taskset)
+		if id <= 2 && err != nil {
+			t.Errorf("Taskset %d was rejected: %v", id, err)
+		}
+		if id == 3 && err != ErrIntakeFull {
+			t.Errorf("Taskset 3 was submitted with %v, want %v", err, ErrIntakeFull)
+		}
+	}
+	if queued, ok := controlCenter.QueuePosition(2); !ok || queued.Position != 1 {
+		t.Errorf("Taskset 2 is at %+v, want position 1", queued)
+	}
+	if _, ok := controlCenter.QueuePosition(3); ok || controlCenter.Handle(3) != nil {
+		t.Errorf("Rejected taskset 3 is in the queue")
+	}
+}
+
+// Test that a full intake queue drops the task set with the lowest priority
+func TestIntakeDropLowest(t *testing.T) {
+	// the factory is not booted, so nothing leaves the queue
+	controlCenter := BuildFactory(1, 0, 0, 0, 1, 1, 1, 1, 1, StartProgramTime())
+	controlCenter.SetIntake(2, IntakeDropLowest)
+
+	var handles []*TaskSetHandle
+	for id, priority := range []int{0, 1, 2, 0} {
+		taskset := gen_task_set(&controlCenter, id+1, []string{"pickup", "dropoff"}, []string{"pickup steel bar", "dropoff steel bar"})
+		taskset.SetPriority(priority)
+		handle, err := controlCenter.Submit(&taskset)
+		if id == 3 {
+			if err != ErrIntakeFull {
+				t.Errorf("Taskset 4 with the lowest priority was submitted with %v, want %v", err, ErrIntakeFull)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Taskset %d was rejected: %v", id+1, err)
+		}
+		handles = append(handles, handle)
+	}
+
+	// taskset 1 was dropped for taskset 3
+	if result, finished := handles[0].Result(); !finished || result.Status != taskSetDropped {
+		t.Errorf("Result of taskset 1 is %+v, want dropped", result)
+	}
+	queue := controlCenter.Queue()
+	if len(queue) != 2 || queue[0].ID != 3 || queue[1].ID != 2 {
+		t.Errorf("Queue is %+v, want tasksets 3 and 2", queue)
+	}
+	if status, _ := controlCenter.State().TaskSet(1); status.Status != taskSetDropped {
+		t.Errorf("Status of taskset 1 is %q, want dropped", status.Status)
+	}
+}
+
+// Test that submitters block while the intake queue is full
+func TestIntakeBlock(t *testing.T) {
+	programTime := StartProgramTime()
+
+	// Build the factory with 1 pickup and 1 dropoff station and 1 transport worker
+	controlCenter := BuildFactory(1, 0, 0, 0, 1, 1, 1, 1, 1, programTime)
+	controlCenter.SetIntake(1, IntakeBlock)
+
+	// Boot the control center
+	go controlCenter.Boot()
+
+	// all submissions go through, but each waits for space in the queue
+	var handles []*TaskSetHandle
+	for id := 1; id <= 4; id++ {
+		taskset := gen_task_set(&controlCenter, id, []string{"pickup", "dropoff"}, []string{"pickup steel bar", "dropoff steel bar"})
+		handle, err := controlCenter.Submit(&taskset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handles = append(handles, handle)
+		if queue := controlCenter.Queue(); len(queue) > 2 {
+			t.Errorf("Queue holds %d task sets, want at most 2", len(queue))
+		}
+	}
+	if programTime.GetCurrentTime() < 2 {
+		t.Errorf("Submissions did not wait for the full queue")
+	}
+
+	// the dispatches so far give an estimated start in the future
+	if queue := controlCenter.Queue(); len(queue) == 2 && queue[1].EstimatedStart <= programTime.GetCurrentTime() {
+		t.Errorf("Estimated start of the last task set is %d at program time %d", queue[1].EstimatedStart, programTime.GetCurrentTime())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, handle := range handles {
+		if result, err := handle.Wait(ctx); err != nil || result.Status != taskSetCompleted {
+			t.Errorf("Taskset %d finished with %+v, %v", handle.ID(), result, err)
+		}
+	}
+}
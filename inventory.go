@@ -0,0 +1,289 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the raw material inventory of the pickup stations
+
+// Pickup stations with an inventory hold a stock of raw materials, e. g.
+// 10 units of steel. A task set takes the materials of its product at its
+// pickup (see catalogue.go), all of them or none. If the stock of a
+// material is too low, the pickup has a stockout and depending on the
+// inventory policy of the pickup stations
+//  - block: waits at the station until a delivery brings enough material
+//    or the watchdog aborts it (see watchdog.go)
+//  - fail: fails and is retried according to the retry policy of the
+//    pickup stations (see retry.go)
+// Deliveries replenish the stock on a schedule in program time, either of
+// one station or of all pickup stations. Task sets without materials and
+// stations without an inventory never run out of stock.
+// Inventory returns the stock levels and the number of stockouts so far.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// behaviour of a pickup on a stockout
+const (
+	StockoutBlock = "block" // the pickup waits for the next delivery
+	StockoutFail  = "fail"  // the pickup fails and is retried
+)
+
+// inventory policy of a facility type, all times are in program time
+type InventoryPolicy struct {
+	Stockout   string     // StockoutBlock or StockoutFail, blocks if empty
+	Deliveries []Delivery // replenishment schedule
+}
+
+// scheduled delivery of raw material
+type Delivery struct {
+	Station  int // id of the pickup station, -1 for all of them
+	Material string
+	Quantity int
+	Start    int // program time of the first delivery
+	Every    int // program time between deliveries, 0 delivers only once
+}
+
+// stock level of one material at a station
+type StockLevel struct {
+	Station   int
+	Material  string
+	Quantity  int // units in stock
+	Delivered int // units delivered so far
+	Consumed  int // units taken by pickups so far
+	Stockouts int // pickups that found too little of the material so far
+}
+
+// stock of a station
+type inventory struct {
+	mutex     sync.Mutex
+	levels    map[string]*StockLevel
+	restocked chan struct{} // closed and replaced whenever the stock grows
+}
+
+func newInventory() *inventory {
+	return &inventory{levels: make(map[string]*StockLevel), restocked: make(chan struct{})}
+}
+
+// //////////////////// Configuration //////////////////////
+
+// set the inventory policy of a facility type, all its stations start
+// with an empty stock
+// must be called before the factory is booted
+func (facilitySet *FacilitySet) SetInventory(policy InventoryPolicy) {
+	facilitySet.inventoryPolicy = &policy
+	for _, facility := range facilitySet.facilities {
+		facility.inventory = newInventory()
+	}
+}
+
+// set the stock of a material at the station, the station keeps an
+// inventory from then on
+// must be called before the factory is booted
+func (facility *Facility) SetStock(material string, quantity int) {
+	if facility.inventory == nil {
+		facility.inventory = newInventory()
+	}
+	facility.inventory.level(facility.id, material).Quantity = quantity
+}
+
+// restore the stock levels of the station from a snapshot
+func (facility *Facility) restock(levels []StockLevel) {
+	if facility.inventory == nil {
+		facility.inventory = newInventory()
+	}
+	for _, level := range levels {
+		restored := level
+		restored.Station = facility.id
+		facility.inventory.levels[level.Material] = &restored
+	}
+}
+
+// stock level of a material, the inventory must be locked
+func (inventory *inventory) level(station int, material string) *StockLevel {
+	level, known := inventory.levels[material]
+	if !known {
+		level = &StockLevel{Station: station, Material: material}
+		inventory.levels[material] = level
+	}
+	return level
+}
+
+// //////////////////// Pickups //////////////////////
+
+// take the materials of the task from the stock of the station
+// returns false if the pickup fails on a stockout or is aborted while it
+// waits for a delivery
+func (facility *Facility) withdraw(task *Task) bool {
+	inventory := facility.inventory
+	if inventory == nil || len(task.materials) == 0 {
+		return true
+	}
+	for stockout := false; ; stockout = true {
+		inventory.mutex.Lock()
+		missing := ""
+		for material, quantity := range task.materials {
+			if inventory.level(facility.id, material).Quantity < quantity {
+				missing = material
+				break
+			}
+		}
+		if missing == "" {
+			for material, quantity := range task.materials {
+				level := inventory.level(facility.id, material)
+				level.Quantity -= quantity
+				level.Consumed += quantity
+			}
+			inventory.mutex.Unlock()
+			return true
+		}
+		// a pickup counts as one stockout however long it waits
+		if !stockout {
+			inventory.level(facility.id, missing).Stockouts++
+		}
+		restocked := inventory.restocked
+		inventory.mutex.Unlock()
+
+		reason := fmt.Sprintf("stockout of %s at %s station %d", missing, facility.facilityType, facility.id)
+		if !stockout {
+			facility.events.println("[", task.tasksetID, "]", "📉:", reason)
+		}
+		if policy := task.FacilityType.inventoryPolicy; policy != nil && policy.Stockout == StockoutFail {
+			task.cancel(reason)
+			return false
+		}
+		select {
+		case <-restocked:
+		case <-task.aborted():
+			return false
+		}
+	}
+}
+
+// put the materials of a failed pickup back into the stock of the station
+func (facility *Facility) putBack(task *Task) {
+	inventory := facility.inventory
+	if inventory == nil || len(task.materials) == 0 {
+		return
+	}
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	for material, quantity := range task.materials {
+		level := inventory.level(facility.id, material)
+		level.Quantity += quantity
+		level.Consumed -= quantity
+	}
+	close(inventory.restocked)
+	inventory.restocked = make(chan struct{})
+}
+
+// //////////////////// Deliveries //////////////////////
+
+// deliver the raw materials to the stations of the facility set on their schedule
+func (controlCenter *ControlCenter) RunDeliveries(facilitySet *FacilitySet) {
+	policy := facilitySet.inventoryPolicy
+	if policy == nil || len(policy.Deliveries) == 0 {
+		return
+	}
+	// the deliveries due since the last check, starting with those due now
+	checked := controlCenter.ProgramTime.GetCurrentTime() - 1
+	for {
+		now := controlCenter.ProgramTime.GetCurrentTime()
+		pending := false
+		for _, delivery := range policy.Deliveries {
+			if due := delivery.due(now) - delivery.due(checked); due > 0 {
+				facilitySet.deliver(delivery, due*delivery.Quantity)
+			}
+			pending = pending || !over(delivery.Start, delivery.Every, now)
+		}
+		// all deliveries that are only made once are made
+		if !pending {
+			return
+		}
+		checked = now
+		if !controlCenter.ProgramTime.WaitRunning(1) {
+			return
+		}
+	}
+}
+
+// number of deliveries due until the given program time
+func (delivery Delivery) due(time int) int {
+	return scheduled(delivery.Start, delivery.Every, time)
+}
+
+// number of times a schedule starting at start and repeating every so often
+// is due until the given program time, a schedule without repetitions is
+// due once
+func scheduled(start, every, time int) int {
+	switch {
+	case time < start:
+		return 0
+	case every <= 0:
+		return 1
+	}
+	return (time-start)/every + 1
+}
+
+// check if a schedule is never due again after the given program time
+func over(start, every, time int) bool {
+	return every <= 0 && time >= start
+}
+
+// add the quantity of a delivery to the stock of its stations
+func (facilitySet *FacilitySet) deliver(delivery Delivery, quantity int) {
+	for _, facility := range facilitySet.facilities {
+		if delivery.Station >= 0 && facility.id != delivery.Station {
+			continue
+		}
+		if facility.inventory == nil {
+			continue
+		}
+		inventory := facility.inventory
+		inventory.mutex.Lock()
+		level := inventory.level(facility.id, delivery.Material)
+		level.Quantity += quantity
+		level.Delivered += quantity
+		close(inventory.restocked)
+		inventory.restocked = make(chan struct{})
+		inventory.mutex.Unlock()
+		facility.events.println("🚛:", quantity, "units of", delivery.Material, "delivered to", facility.facilityType, "station", facility.id)
+	}
+}
+
+// //////////////////// Reporting //////////////////////
+
+// stock levels of the station, nil if it has no inventory
+func (facility *Facility) stock() []StockLevel {
+	if facility.inventory == nil {
+		return nil
+	}
+	facility.inventory.mutex.Lock()
+	defer facility.inventory.mutex.Unlock()
+	levels := make([]StockLevel, 0, len(facility.inventory.levels))
+	for _, level := range facility.inventory.levels {
+		levels = append(levels, *level)
+	}
+	return levels
+}
+
+// stock levels of the stations of a facility set
+func (facilitySet *FacilitySet) stock() []StockLevel {
+	var levels []StockLevel
+	for _, facility := range facilitySet.facilities {
+		levels = append(levels, facility.stock()...)
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		a, b := levels[i], levels[j]
+		return a.Station < b.Station || a.Station == b.Station && a.Material < b.Material
+	})
+	return levels
+}
+
+// get the stock levels of the pickup stations by station and material
+func (controlCenter *ControlCenter) Inventory() []StockLevel {
+	return controlCenter.PickupStations.stock()
+}
@@ -0,0 +1,131 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the raw material inventory
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// catalogue of steel plates
+var plates = Catalogue{"plate": {ID: "plate", Name: "steel plate", Recipe: []RecipeStep{
+	{Station: "pickup", Action: "pickup {product}"},
+	{Station: "dropoff", Action: "dropoff {product}"},
+}, Materials: map[string]int{"steel": 1}}}
+
+// submit orders of steel plates and wait for their task sets
+func plateOrder(t *testing.T, controlCenter *ControlCenter, orders ...Order) []TaskSetResult {
+	var handles []*TaskSetHandle
+	id := 1
+	for _, order := range orders {
+		order.Product = "plate"
+		tasksets, err := plates.Expand(controlCenter, order, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range tasksets {
+			handle, err := controlCenter.Submit(&tasksets[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			handles = append(handles, handle)
+		}
+		id += len(tasksets)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var results []TaskSetResult
+	for _, handle := range handles {
+		result, err := handle.Wait(ctx)
+		if err != nil {
+			t.Fatalf("Taskset %d did not finish: %v", handle.ID(), err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Test that a pickup on a stockout waits for the next delivery
+func TestStockoutBlock(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 0, 0, 0, 1, 0, 0, 0, 2, programTime)
+	controlCenter.PickupStations.SetInventory(InventoryPolicy{Deliveries: []Delivery{{Station: -1, Material: "steel", Quantity: 2, Start: 40}}})
+	controlCenter.PickupStations.facilities[0].SetStock("steel", 1)
+	go controlCenter.Boot()
+
+	results := plateOrder(t, &controlCenter, Order{Quantity: 2})
+	latest := 0
+	for _, result := range results {
+		if result.Status != taskSetCompleted {
+			t.Fatalf("Taskset %d finished with %+v", result.ID, result)
+		}
+		latest = max(latest, result.Tasks[0].Finished)
+	}
+	// one of the plates is picked up after the delivery
+	if latest < 40 {
+		t.Errorf("Both plates were picked up by %d, before the delivery", latest)
+	}
+	want := StockLevel{Station: 0, Material: "steel", Quantity: 1, Delivered: 2, Consumed: 2, Stockouts: 1}
+	if levels := controlCenter.Inventory(); len(levels) != 1 || levels[0] != want {
+		t.Errorf("Inventory is %+v, want %+v", levels, want)
+	}
+}
+
+// Test that a pickup on a stockout fails and is retried with the fail policy
+func TestStockoutFail(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 0, 0, 0, 1, 0, 0, 0, 1, programTime)
+	controlCenter.PickupStations.SetInventory(InventoryPolicy{Stockout: StockoutFail})
+	controlCenter.PickupStations.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, Backoff: 1})
+	go controlCenter.Boot()
+
+	results := plateOrder(t, &controlCenter, Order{})
+	if results[0].Status != taskSetFailed {
+		t.Errorf("Taskset finished with %+v, want it to fail", results[0])
+	}
+	// every attempt ran out of stock
+	if levels := controlCenter.Inventory(); len(levels) != 1 || levels[0].Stockouts != 2 || levels[0].Consumed != 0 {
+		t.Errorf("Inventory is %+v, want 2 stockouts", levels)
+	}
+}
+
+// Test that the materials of a rejected pickup go back into the stock
+func TestRejectedPickup(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 0, 0, 0, 1, 0, 0, 0, 1, programTime)
+	controlCenter.PickupStations.SetInventory(InventoryPolicy{})
+	controlCenter.PickupStations.facilities[0].SetStock("steel", 1)
+	controlCenter.PickupStations.SetQualityCheck(1)
+	controlCenter.PickupStations.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, Backoff: 1})
+	go controlCenter.Boot()
+
+	results := plateOrder(t, &controlCenter, Order{})
+	if results[0].Status != taskSetFailed {
+		t.Errorf("Taskset finished with %+v, want it to fail", results[0])
+	}
+	// both attempts took the steel and put it back
+	want := StockLevel{Station: 0, Material: "steel", Quantity: 1}
+	if levels := controlCenter.Inventory(); len(levels) != 1 || levels[0] != want {
+		t.Errorf("Inventory is %+v, want %+v", levels, want)
+	}
+}
+
+// Test the schedule of the deliveries
+func TestDeliverySchedule(t *testing.T) {
+	once := Delivery{Start: 10}
+	every := Delivery{Start: 10, Every: 5}
+	for _, tc := range []struct {
+		delivery Delivery
+		time     int
+		want     int
+	}{{once, 9, 0}, {once, 10, 1}, {once, 100, 1}, {every, 9, 0}, {every, 10, 1}, {every, 14, 1}, {every, 15, 2}, {every, 32, 5}} {
+		if got := tc.delivery.due(tc.time); got != tc.want {
+			t.Errorf("%+v has %d deliveries due at %d, want %d", tc.delivery, got, tc.time, tc.want)
+		}
+	}
+}
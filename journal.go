@@ -0,0 +1,271 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the write-ahead log of the control center
+
+// The journal is an append-only file with one JSON entry per line.
+// The control center appends an entry when
+//  - it receives a task set (submit, with all its steps)
+//  - a transportation worker completes a task of a task set (complete)
+//  - a task set is completed or fails (finish)
+//  - a task set is dropped from the full intake queue (drop)
+// Every entry is synced to disk before the factory goes on.
+// After a crash, Recover reads the journal, restores the counters, the
+// dead-letter queue and the kitting area (see kitting.go) of the control
+// center and returns every unfinished task set, which resumes at its first
+// incomplete task once submitted.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// kinds of journal entries
+const (
+	journalSubmit   = "submit"
+	journalComplete = "complete"
+	journalFinish   = "finish"
+	journalDrop     = "drop"
+)
+
+// one line of the journal
+type JournalEntry struct {
+	Kind     string        `json:"kind"`
+	TaskSet  int           `json:"taskset"`
+	Task     int           `json:"task,omitempty"`     // index of the completed task
+	Priority int           `json:"priority,omitempty"` // priority of a submitted task set
+	Steps    []JournalStep `json:"steps,omitempty"`    // steps of a submitted task set
+	Failure  string        `json:"failure,omitempty"`  // reason of a failed task set
+	Time     int           `json:"time"`               // program time of the entry
+}
+
+// one task of a submitted task set
+type JournalStep struct {
+	Station     string          `json:"station"`
+	Description string          `json:"description"`
+	Completed   bool            `json:"completed,omitempty"`
+	Materials   map[string]int  `json:"materials,omitempty"`
+	Goods       *Goods          `json:"goods,omitempty"`
+	Attributes  *TaskAttributes `json:"attributes,omitempty"`
+	Supplies    *KitSupply      `json:"supplies,omitempty"`
+	Kit         string          `json:"kit,omitempty"`
+}
+
+// append-only journal file
+type Journal struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// //////////////////// Writing //////////////////////
+
+// open the journal at path, new entries are appended to existing ones
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{file: file}, nil
+}
+
+// close the journal, later entries are dropped
+func (journal *Journal) Close() error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	err := journal.file.Close()
+	journal.file = nil
+	return err
+}
+
+// use the journal for all task sets of the factory
+// must be called before the factory is booted
+func (controlCenter *ControlCenter) UseJournal(journal *Journal) {
+	controlCenter.journal = journal
+}
+
+// append an entry and sync it to disk
+// a factory without journal does not record anything
+func (journal *Journal) append(entry JournalEntry) {
+	if journal == nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		fmt.Println("📒: could not encode journal entry:", err)
+		return
+	}
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	if journal.file == nil {
+		return
+	}
+	if _, err := journal.file.Write(append(line, '\n')); err != nil {
+		fmt.Println("📒: could not write journal entry:", err)
+		return
+	}
+	if err := journal.file.Sync(); err != nil {
+		fmt.Println("📒: could not sync journal:", err)
+	}
+}
+
+// record a task set received by the control center
+func (journal *Journal) submitted(taskset *TaskSet, now int) {
+	journal.append(JournalEntry{Kind: journalSubmit, TaskSet: taskset.id, Steps: taskset.steps(), Priority: taskset.priority, Time: now})
+}
+
+// steps of a task set as they are recorded
+func (taskset *TaskSet) steps() []JournalStep {
+	steps := make([]JournalStep, len(taskset.tasks))
+	for i, task := range taskset.tasks {
+		steps[i] = JournalStep{task.FacilityType.facilityType, task.description, task.completed, task.materials, task.goods, task.attributes.typed(), task.supplies, task.kit}
+	}
+	return steps
+}
+
+// rebuild a task set from its recorded steps
+func (controlCenter *ControlCenter) rebuildTaskSet(id int, steps []JournalStep) (*TaskSet, error) {
+	taskset := TaskSet{id: id, tasks: make([]*Task, len(steps))}
+	for i, step := range steps {
+		facilitySet := controlCenter.facilitySet(step.Station)
+		if facilitySet == nil {
+			return nil, fmt.Errorf("taskset %d has unknown station %q", id, step.Station)
+		}
+		taskset.tasks[i] = newTask(facilitySet, step.Description, id)
+		taskset.tasks[i].completed = step.Completed
+		taskset.tasks[i].materials = step.Materials
+		taskset.tasks[i].goods = step.Goods
+		taskset.tasks[i].supplies = step.Supplies
+		taskset.tasks[i].kit = step.Kit
+		if step.Attributes != nil {
+			taskset.tasks[i].attributes = *step.Attributes
+		}
+	}
+	return &taskset, nil
+}
+
+// record a completed task of a task set
+func (journal *Journal) completed(taskset *TaskSet, task int, now int) {
+	journal.append(JournalEntry{Kind: journalComplete, TaskSet: taskset.id, Task: task, Time: now})
+}
+
+// record a task set dropped from the intake queue
+func (journal *Journal) dropped(taskset *TaskSet, now int) {
+	journal.append(JournalEntry{Kind: journalDrop, TaskSet: taskset.id, Time: now})
+}
+
+// record a completed or failed task set
+func (journal *Journal) finished(taskset *TaskSet, now int) {
+	journal.append(JournalEntry{Kind: journalFinish, TaskSet: taskset.id, Failure: taskset.failure, Time: now})
+}
+
+// //////////////////// Recovery //////////////////////
+
+// read all entries of the journal at path
+func ReadJournal(path string) ([]JournalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// a torn last line is what a crash during a write leaves behind
+			fmt.Println("📒: skipping unreadable journal entry:", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// rebuild the state of the control center from the journal at path
+// restores the counters, the dead-letter queue and the kitting area and
+// returns the unfinished task sets, which resume at their first incomplete
+// task once they are sent to the control center
+// must be called before the factory is booted, a missing journal is empty
+func (controlCenter *ControlCenter) Recover(path string) ([]*TaskSet, error) {
+	entries, err := ReadJournal(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// replay the journal, the latest submission of a task set wins
+	tasksets := make(map[int]*TaskSet)
+	var order []int
+	completed, failed := 0, 0
+	for _, entry := range entries {
+		switch entry.Kind {
+		case journalSubmit:
+			taskset, err := controlCenter.rebuildTaskSet(entry.TaskSet, entry.Steps)
+			if err != nil {
+				return nil, fmt.Errorf("journal: %v", err)
+			}
+			taskset.priority = entry.Priority
+			if _, known := tasksets[entry.TaskSet]; !known {
+				order = append(order, entry.TaskSet)
+			}
+			tasksets[entry.TaskSet] = taskset
+			// a resubmitted dead letter is no longer in the dead-letter queue
+			letters := controlCenter.deadLetters.letters[:0]
+			for _, letter := range controlCenter.deadLetters.letters {
+				if letter.TaskSet.id != entry.TaskSet {
+					letters = append(letters, letter)
+				}
+			}
+			controlCenter.deadLetters.letters = letters
+		case journalComplete:
+			taskset := tasksets[entry.TaskSet]
+			if taskset == nil || entry.Task >= len(taskset.tasks) {
+				return nil, fmt.Errorf("journal: completion of unknown task %d of taskset %d", entry.Task, entry.TaskSet)
+			}
+			taskset.tasks[entry.Task].completed = true
+			controlCenter.kitting.replay(taskset, taskset.tasks[entry.Task], entry.Time)
+		case journalDrop:
+			delete(tasksets, entry.TaskSet)
+		case journalFinish:
+			taskset := tasksets[entry.TaskSet]
+			if taskset == nil {
+				return nil, fmt.Errorf("journal: unknown taskset %d finished", entry.TaskSet)
+			}
+			delete(tasksets, entry.TaskSet)
+			if entry.Failure == "" {
+				completed++
+				continue
+			}
+			failed++
+			taskset.failure = entry.Failure
+			controlCenter.deadLetters.letters = append(controlCenter.deadLetters.letters, DeadLetter{taskset, entry.Failure, entry.Time})
+		}
+	}
+	// unfinished task sets in the order they were submitted
+	var unfinished []*TaskSet
+	for _, id := range order {
+		taskset := tasksets[id]
+		if taskset == nil {
+			continue
+		}
+		delete(tasksets, id)
+		if taskset.resumeAt() == len(taskset.tasks) {
+			// crashed right before the task set was finished
+			completed++
+			controlCenter.journal.finished(taskset, controlCenter.ProgramTime.GetCurrentTime())
+			continue
+		}
+		unfinished = append(unfinished, taskset)
+	}
+	controlCenter.state.setCounters(completed, failed, 0)
+	controlCenter.events.println("📒: recovered", completed, "completed,", failed, "failed and", len(unfinished), "unfinished task sets")
+	return unfinished, nil
+}
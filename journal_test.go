@@ -0,0 +1,131 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the journal and crash recovery
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test that a run records submissions, completed tasks and finished task sets
+func TestJournalRecordsRun(t *testing.T) {
+	programTime := StartProgramTime()
+	path := filepath.Join(t.TempDir(), "journal")
+
+	// Build the factory with 1 pickup and 1 dropoff station
+	controlCenter := BuildFactory(1, 0, 0, 0, 1, 1, 1, 1, 1, programTime)
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	controlCenter.UseJournal(journal)
+
+	// Boot the control center
+	go controlCenter.Boot()
+
+	taskset := gen_task_set(&controlCenter, 1, []string{"pickup", "dropoff"}, []string{"pickup steel bar", "dropoff steel bar"})
+	controlCenter.request <- &taskset
+
+	for programTime.GetCurrentTime() < 10 {
+		time.Sleep(1 * time.Second)
+		if controlCenter.State().CompletedTaskSets == 1 {
+			break
+		}
+	}
+
+	entries, err := ReadJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := []string{journalSubmit, journalComplete, journalComplete, journalFinish}
+	if len(entries) != len(kinds) {
+		t.Fatalf("Journal contains %d entries, want %d", len(entries), len(kinds))
+	}
+	for i, entry := range entries {
+		if entry.Kind != kinds[i] || entry.TaskSet != 1 {
+			t.Errorf("Journal entry %d is %s of taskset %d, want %s of taskset 1", i, entry.Kind, entry.TaskSet, kinds[i])
+		}
+	}
+	if len(entries[0].Steps) != 2 || entries[0].Steps[1].Station != "dropoff" {
+		t.Errorf("Submitted steps are %v", entries[0].Steps)
+	}
+}
+
+// Test that an unfinished task set resumes at its first incomplete task after a crash
+func TestJournalRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	// journal of a crashed run: taskset 1 completed, taskset 2 welded, taskset 3 failed
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed := BuildFactory(1, 0, 1, 0, 1, 2, 2, 2, 2, &ProgramTime{})
+	tasksetA := gen_task_set(&crashed, 1, []string{"pickup", "dropoff"}, []string{"pickup steel bar", "dropoff steel bar"})
+	tasksetB := gen_task_set(&crashed, 2, []string{"pickup", "welding", "dropoff"}, []string{"pickup steel wool", "weld steel wool", "dropoff steel wool"})
+	tasksetC := gen_task_set(&crashed, 3, []string{"pickup", "dropoff"}, []string{"pickup steel pot", "dropoff steel pot"})
+	journal.submitted(&tasksetA, 0)
+	journal.submitted(&tasksetB, 0)
+	journal.submitted(&tasksetC, 1)
+	journal.completed(&tasksetA, 0, 2)
+	journal.completed(&tasksetB, 0, 3)
+	journal.completed(&tasksetA, 1, 4)
+	journal.finished(&tasksetA, 4)
+	journal.completed(&tasksetB, 1, 6)
+	tasksetC.failure = "fault at pickup station 0"
+	journal.finished(&tasksetC, 7)
+	journal.Close()
+
+	// restart the factory from the journal
+	programTime := StartProgramTime()
+	controlCenter := BuildFactory(1, 0, 1, 0, 1, 2, 2, 2, 2, programTime)
+	journal, err = OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	controlCenter.UseJournal(journal)
+	recovered, err := controlCenter.Recover(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// check the rebuilt state of the control center
+	if controlCenter.State().CompletedTaskSets != 1 || controlCenter.State().FailedTaskSets != 1 {
+		t.Errorf("Recovered %d completed and %d failed task sets, want 1 and 1", controlCenter.State().CompletedTaskSets, controlCenter.State().FailedTaskSets)
+	}
+	if deadLetters := controlCenter.DeadLetters(); len(deadLetters) != 1 || deadLetters[0].TaskSet.id != 3 {
+		t.Errorf("Dead-letter queue after recovery is %v, want taskset 3", deadLetters)
+	}
+	if len(recovered) != 1 || recovered[0].id != 2 {
+		t.Fatalf("Recovered %d unfinished task sets, want taskset 2", len(recovered))
+	}
+	if recovered[0].resumeAt() != 2 {
+		t.Errorf("Taskset 2 resumes at task %d, want 2", recovered[0].resumeAt())
+	}
+
+	// resume the unfinished task set
+	go controlCenter.Boot()
+	controlCenter.request <- recovered[0]
+
+	for programTime.GetCurrentTime() < 10 {
+		time.Sleep(1 * time.Second)
+		if controlCenter.State().CompletedTaskSets == 2 {
+			break
+		}
+	}
+
+	if controlCenter.State().CompletedTaskSets != 2 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 2", controlCenter.State().CompletedTaskSets)
+	}
+	// the resumed task set must not have been picked up again
+	if recovered[0].tasks[0].Facility != nil || recovered[0].tasks[1].Facility != nil {
+		t.Errorf("Completed tasks of the resumed task set were carried out again")
+	}
+}
@@ -0,0 +1,240 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the kitting area of the assembly stations
+
+// An assembly task can join components that come from other task sets,
+// e. g. a frame, a motor and a housing. The task names its kit and the
+// components of the kit are the components of its typed attributes (see
+// attributes.go). The last task of a task set that supplies a component
+// names the kit and the component, once it is completed the part waits in
+// the kitting area. A task set with an assembly whose kit is not complete
+// stays in the intake queue (see intake.go) and is only dispatched or
+// loaded once its kits are complete, so it does not hold a transportation
+// worker. Should the kit of a dispatched assembly still be incomplete, its
+// transportation worker waits in the kitting area before it requests an
+// assembly station, parked on the pause gate while the factory is paused
+// (see snapshot.go), the wait does not count towards the timeouts of the
+// watchdog (see watchdog.go). A completed assembly consumes the parts of
+// the kit and produces a new component that is tracked with its inputs,
+// the genealogy of a task set is the tree of the assemblies it was built
+// from. A failed assembly leaves the parts in the kitting area for the
+// next attempt.
+// The catalogue (see catalogue.go) expands a product with a kit into a
+// task set for each component followed by the task set of the product,
+// whose first assembly step assembles the kit.
+// The kitting area is kept in snapshots (see snapshot.go) and rebuilt from
+// the completed tasks in the journal (see journal.go).
+
+package main
+
+import (
+	"slices"
+	"sync"
+)
+
+// component a task set supplies to a kit
+type KitSupply struct {
+	Kit       string `json:"kit"`
+	Component string `json:"component"`
+}
+
+// part waiting in the kitting area
+type KitPart struct {
+	Kit       string
+	Component string
+	TaskSet   int // task set that supplied the part
+	Time      int // program time the part arrived
+}
+
+// component produced by an assembly from a kit
+type Assembly struct {
+	Kit     string
+	TaskSet int // task set of the assembly
+	Product string
+	Inputs  []KitPart // consumed parts
+	Time    int       // program time the assembly was completed
+}
+
+// parts waiting for their kits and the assemblies so far
+type kittingArea struct {
+	mutex      sync.Mutex
+	parts      []KitPart
+	assemblies []Assembly
+	arrived    chan struct{} // closed and replaced whenever a part arrives
+}
+
+func newKittingArea() *kittingArea {
+	return &kittingArea{arrived: make(chan struct{})}
+}
+
+// //////////////////// Kits //////////////////////
+
+// put the part a completed task supplies into the kitting area
+func (controlCenter *ControlCenter) supply(taskset *TaskSet, task *Task) {
+	if task.supplies == nil {
+		return
+	}
+	area := controlCenter.kitting
+	part := KitPart{Kit: task.supplies.Kit, Component: task.supplies.Component, TaskSet: taskset.id, Time: controlCenter.ProgramTime.GetCurrentTime()}
+	area.mutex.Lock()
+	area.parts = append(area.parts, part)
+	close(area.arrived)
+	area.arrived = make(chan struct{})
+	area.mutex.Unlock()
+	controlCenter.intake.wake()
+	// print component C of kit K arrived in the kitting area
+	controlCenter.events.println("[", taskset.id, "]", "🧩: component", part.Component, "of kit", part.Kit, "arrived in the kitting area")
+}
+
+// parts of the kitting area that complete the kit, nil if it is not
+// complete, the area must be locked
+func (area *kittingArea) kit(kit string, components []string) []int {
+	var taken []int
+	for _, component := range components {
+		found := false
+		for i, part := range area.parts {
+			if part.Kit == kit && part.Component == component && !slices.Contains(taken, i) {
+				taken = append(taken, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return taken
+}
+
+// check if the kit of the task is complete, a task without a kit is always ready
+func (controlCenter *ControlCenter) ready(task *Task) bool {
+	if task.kit == "" {
+		return true
+	}
+	controlCenter.kitting.mutex.Lock()
+	defer controlCenter.kitting.mutex.Unlock()
+	return controlCenter.kitting.kit(task.kit, task.attributes.Components) != nil
+}
+
+// check if the kits of the remaining tasks of a task set are complete
+func (controlCenter *ControlCenter) kitted(taskset *TaskSet) bool {
+	for _, task := range taskset.tasks[taskset.resumeAt():] {
+		if !controlCenter.ready(task) {
+			return false
+		}
+	}
+	return true
+}
+
+// wait until the kit of the task is complete
+// the transportation worker is parked with its load while the factory is paused
+// returns false if the task is aborted meanwhile
+func (controlCenter *ControlCenter) awaitKit(task *Task, transportWorker *Worker, load *transportLoad) bool {
+	if task.kit == "" {
+		return true
+	}
+	area := controlCenter.kitting
+	for waiting := false; ; waiting = true {
+		area.mutex.Lock()
+		complete := area.kit(task.kit, task.attributes.Components) != nil
+		arrived := area.arrived
+		area.mutex.Unlock()
+		if complete {
+			return true
+		}
+		if !waiting {
+			controlCenter.events.println("[", task.tasksetID, "]", "🧩: task", task.description, "waits for kit", task.kit, "in the kitting area")
+		}
+		select {
+		case <-arrived:
+		case <-controlCenter.gate.pausing():
+			controlCenter.gate.parkTransporter(transportWorker, load)
+		case <-task.aborted():
+			return false
+		}
+	}
+}
+
+// consume the kit of a completed assembly task and track the new component
+func (controlCenter *ControlCenter) assemble(taskset *TaskSet, task *Task) {
+	if task.kit == "" {
+		return
+	}
+	area := controlCenter.kitting
+	area.mutex.Lock()
+	defer area.mutex.Unlock()
+	task.consumed = area.consume(taskset, task, controlCenter.ProgramTime.GetCurrentTime())
+}
+
+// take the kit of an assembly task out of the kitting area and record the
+// assembly, the area must be locked
+// returns the consumed parts
+func (area *kittingArea) consume(taskset *TaskSet, task *Task, time int) []KitPart {
+	taken := area.kit(task.kit, task.attributes.Components)
+	assembly := Assembly{Kit: task.kit, TaskSet: taskset.id, Product: task.attributes.Product, Time: time}
+	var kept []KitPart
+	for i, part := range area.parts {
+		if slices.Contains(taken, i) {
+			assembly.Inputs = append(assembly.Inputs, part)
+		} else {
+			kept = append(kept, part)
+		}
+	}
+	area.parts = kept
+	area.assemblies = append(area.assemblies, assembly)
+	return assembly.Inputs
+}
+
+// //////////////////// Recovery //////////////////////
+
+// replay a task completed before a crash in the kitting area, the part it
+// supplies arrives and the kit it assembles is consumed at the program time
+// of the completion
+func (area *kittingArea) replay(taskset *TaskSet, task *Task, time int) {
+	area.mutex.Lock()
+	defer area.mutex.Unlock()
+	if task.supplies != nil {
+		area.parts = append(area.parts, KitPart{Kit: task.supplies.Kit, Component: task.supplies.Component, TaskSet: taskset.id, Time: time})
+	}
+	if task.kit != "" {
+		task.consumed = area.consume(taskset, task, time)
+	}
+}
+
+// //////////////////// Reporting //////////////////////
+
+// get the parts waiting in the kitting area in the order they arrived
+func (controlCenter *ControlCenter) KittingArea() []KitPart {
+	controlCenter.kitting.mutex.Lock()
+	defer controlCenter.kitting.mutex.Unlock()
+	return append([]KitPart(nil), controlCenter.kitting.parts...)
+}
+
+// get the assemblies in the order they were completed
+func (controlCenter *ControlCenter) Assemblies() []Assembly {
+	controlCenter.kitting.mutex.Lock()
+	defer controlCenter.kitting.mutex.Unlock()
+	return append([]Assembly(nil), controlCenter.kitting.assemblies...)
+}
+
+// get the genealogy of a task set, its assemblies and those of their inputs
+func (controlCenter *ControlCenter) Genealogy(id int) []Assembly {
+	assemblies := controlCenter.Assemblies()
+	var genealogy []Assembly
+	next := []int{id}
+	for len(next) > 0 {
+		id, next = next[0], next[1:]
+		for _, assembly := range assemblies {
+			if assembly.TaskSet != id {
+				continue
+			}
+			genealogy = append(genealogy, assembly)
+			for _, input := range assembly.Inputs {
+				next = append(next, input.TaskSet)
+			}
+		}
+	}
+	return genealogy
+}
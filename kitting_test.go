@@ -0,0 +1,303 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the kitting area of the assembly stations
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Test that an assembly waits for its kit and consumes it
+func TestKitting(t *testing.T) {
+	// a single transport worker is not held by the assembly waiting for its kit
+	for _, transporters := range []int{3, 1} {
+		programTime := StartSimulatedTime(0, 5*time.Millisecond)
+		controlCenter := BuildFactory(1, 1, 1, 0, 1, 1, 2, 0, transporters, programTime)
+		go controlCenter.Boot()
+
+		scooter, err := TypedTaskSet(&controlCenter, 3, []TypedTask{
+			{"pickup", TaskAttributes{Product: "housing"}},
+			{"assembly", TaskAttributes{Product: "scooter", Components: []string{"frame", "motor"}}},
+			{"dropoff", TaskAttributes{Product: "scooter"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		scooter.tasks[1].kit = "scooter-3"
+		// the assembly is submitted first and waits for its kit
+		handle, err := controlCenter.Submit(&scooter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, component := range []string{"frame", "motor"} {
+			id := i + 1
+			taskset, err := TypedTaskSet(&controlCenter, id, []TypedTask{{"pickup", TaskAttributes{Product: component}}, {"welding", TaskAttributes{Product: component}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			taskset.tasks[1].supplies = &KitSupply{Kit: "scooter-3", Component: component}
+			runTaskSet(t, &controlCenter, taskset)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if result, err := handle.Wait(ctx); err != nil || result.Status != taskSetCompleted {
+			t.Fatalf("Taskset 3 finished with %+v, %v with %d transport workers", result, err, transporters)
+		}
+
+		assemblies := controlCenter.Assemblies()
+		if len(assemblies) != 1 || assemblies[0].TaskSet != 3 || assemblies[0].Product != "scooter" || len(assemblies[0].Inputs) != 2 {
+			t.Fatalf("Assemblies are %+v", assemblies)
+		}
+		inputs := []int{assemblies[0].Inputs[0].TaskSet, assemblies[0].Inputs[1].TaskSet}
+		if !slices.Equal(inputs, []int{1, 2}) {
+			t.Errorf("Assembly consumed the parts of the task sets %v", inputs)
+		}
+		if parts := controlCenter.KittingArea(); len(parts) != 0 {
+			t.Errorf("Parts %+v are left in the kitting area", parts)
+		}
+		assembled := controlCenter.TraceStation("assembly", 0)
+		if len(assembled) != 1 || !slices.Equal(assembled[0].Inputs, []int{1, 2}) {
+			t.Fatalf("Assembly station has the records %+v", assembled)
+		}
+		if assembled[0].Arrived < assemblies[0].Inputs[1].Time {
+			t.Errorf("Assembly started at %d before the motor arrived at %d", assembled[0].Arrived, assemblies[0].Inputs[1].Time)
+		}
+	}
+}
+
+// Test that the factory pauses while an assembly waits for its kit
+func TestKittingPause(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 1, 1, 0, 1, 1, 2, 0, 1, programTime)
+	go controlCenter.Boot()
+	defer controlCenter.Shutdown()
+
+	scooter, err := TypedTaskSet(&controlCenter, 2, []TypedTask{
+		{"pickup", TaskAttributes{Product: "housing"}},
+		{"assembly", TaskAttributes{Product: "scooter", Components: []string{"frame"}}},
+		{"dropoff", TaskAttributes{Product: "scooter"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scooter.tasks[1].kit = "scooter-2"
+	handle, err := controlCenter.Submit(&scooter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	programTime.Wait(5)
+
+	paused := make(chan struct{})
+	go func() {
+		controlCenter.Pause()
+		close(paused)
+	}()
+	select {
+	case <-paused:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Factory did not pause while the assembly waits for its kit")
+	}
+	// the assembly waits in the intake queue, no transport worker carries it
+	snapshot, err := controlCenter.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.TaskSets) != 0 || len(snapshot.Pending) != 1 || snapshot.Pending[0].ID != 2 {
+		t.Errorf("Snapshot carries %+v and keeps %+v pending", snapshot.TaskSets, snapshot.Pending)
+	}
+	controlCenter.Resume()
+
+	frame, err := TypedTaskSet(&controlCenter, 1, []TypedTask{{"pickup", TaskAttributes{Product: "frame"}}, {"welding", TaskAttributes{Product: "frame"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame.tasks[1].supplies = &KitSupply{Kit: "scooter-2", Component: "frame"}
+	runTaskSet(t, &controlCenter, frame)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if result, err := handle.Wait(ctx); err != nil || result.Status != taskSetCompleted {
+		t.Fatalf("Taskset 2 finished with %+v, %v", result, err)
+	}
+}
+
+// Test that a task set failing after its assembly is resubmitted without
+// waiting for its consumed kit again
+func TestKittingResubmit(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 1, 1, 1, 1, 1, 2, 1, 1, programTime)
+	// every painting is rejected and not retried
+	controlCenter.PaintingStations.SetQualityCheck(1)
+	controlCenter.PaintingStations.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+	go controlCenter.Boot()
+	defer controlCenter.Shutdown()
+
+	frame, err := TypedTaskSet(&controlCenter, 1, []TypedTask{{"pickup", TaskAttributes{Product: "frame"}}, {"welding", TaskAttributes{Product: "frame"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame.tasks[1].supplies = &KitSupply{Kit: "scooter-2", Component: "frame"}
+	runTaskSet(t, &controlCenter, frame)
+	scooter, err := TypedTaskSet(&controlCenter, 2, []TypedTask{
+		{"pickup", TaskAttributes{Product: "housing"}},
+		{"assembly", TaskAttributes{Product: "scooter", Components: []string{"frame"}}},
+		{"painting", TaskAttributes{Product: "scooter", Colour: "red"}},
+		{"dropoff", TaskAttributes{Product: "scooter"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scooter.tasks[1].kit = "scooter-2"
+	if result := runTaskSet(t, &controlCenter, scooter); result.Status != taskSetFailed {
+		t.Fatalf("Taskset 2 finished with %+v, want it to fail at the painting", result)
+	}
+
+	// the painting is fixed, the kit was consumed by the first assembly
+	controlCenter.PaintingStations.SetQualityCheck(0)
+	if err := controlCenter.Resubmit(2); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if result, err := controlCenter.Handle(2).Wait(ctx); err != nil || result.Status != taskSetCompleted {
+		t.Fatalf("Resubmitted taskset 2 finished with %+v, %v", result, err)
+	}
+	if assemblies := controlCenter.Assemblies(); len(assemblies) != 1 || len(assemblies[0].Inputs) != 1 {
+		t.Errorf("Assemblies are %+v, want the first one only", assemblies)
+	}
+}
+
+// Test that the kitting area is rebuilt from the journal after a crash
+func TestKittingRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	// journal of a crashed run: the frames of two scooters arrived, one of them was assembled
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed := BuildFactory(1, 1, 1, 0, 1, 1, 2, 0, 1, &ProgramTime{})
+	var frames []TaskSet
+	for id := 1; id <= 2; id++ {
+		frame, err := TypedTaskSet(&crashed, id, []TypedTask{{"pickup", TaskAttributes{Product: "frame"}}, {"welding", TaskAttributes{Product: "frame"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame.tasks[1].supplies = &KitSupply{Kit: fmt.Sprintf("scooter-%d", id+2), Component: "frame"}
+		frames = append(frames, frame)
+	}
+	scooter, err := TypedTaskSet(&crashed, 3, []TypedTask{
+		{"pickup", TaskAttributes{Product: "housing"}},
+		{"assembly", TaskAttributes{Product: "scooter", Components: []string{"frame"}}},
+		{"dropoff", TaskAttributes{Product: "scooter"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scooter.tasks[1].kit = "scooter-3"
+	for i := range frames {
+		journal.submitted(&frames[i], 0)
+		journal.completed(&frames[i], 0, 1)
+		journal.completed(&frames[i], 1, 3+i)
+		journal.finished(&frames[i], 3+i)
+	}
+	journal.submitted(&scooter, 0)
+	journal.completed(&scooter, 0, 2)
+	journal.completed(&scooter, 1, 6)
+	journal.Close()
+
+	programTime := StartProgramTime()
+	controlCenter := BuildFactory(1, 1, 1, 0, 1, 1, 2, 0, 1, programTime)
+	recovered, err := controlCenter.Recover(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovered) != 1 || recovered[0].resumeAt() != 2 {
+		t.Fatalf("Recovered %d unfinished task sets, want taskset 3 after its assembly", len(recovered))
+	}
+	assemblies := controlCenter.Assemblies()
+	if len(assemblies) != 1 || assemblies[0].TaskSet != 3 || len(assemblies[0].Inputs) != 1 || assemblies[0].Inputs[0] != (KitPart{"scooter-3", "frame", 1, 3}) || assemblies[0].Time != 6 {
+		t.Errorf("Assemblies after recovery are %+v", assemblies)
+	}
+	if parts := controlCenter.KittingArea(); len(parts) != 1 || parts[0] != (KitPart{"scooter-4", "frame", 2, 4}) {
+		t.Errorf("Kitting area after recovery has the parts %+v", parts)
+	}
+}
+
+// Test that a product with a kit expands into task sets for its components
+func TestExpandKit(t *testing.T) {
+	programTime := StartProgramTime()
+	controlCenter := BuildFactory(1, 1, 1, 1, 1, 1, 2, 1, 1, programTime)
+	tasksets, err := DefaultCatalogue().Expand(&controlCenter, Order{ID: "A", Product: "scooter", Quantity: 2, Priority: 1}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasksets) != 6 {
+		t.Fatalf("Order expanded into %d task sets, want 6", len(tasksets))
+	}
+	for unit := 0; unit < 2; unit++ {
+		frame, motor, scooter := tasksets[3*unit], tasksets[3*unit+1], tasksets[3*unit+2]
+		kit := scooter.tasks[1].kit
+		if scooter.id != 3*unit+3 || kit != fmt.Sprintf("scooter-%d", scooter.id) || scooter.tasks[1].description != "assemble scooter from frame, motor" {
+			t.Errorf("Scooter %d has the kit %q and the tasks %v", scooter.id, kit, descriptions(scooter))
+		}
+		for component, taskset := range map[string]TaskSet{"frame": frame, "motor": motor} {
+			supplies := taskset.tasks[len(taskset.tasks)-1].supplies
+			if supplies == nil || *supplies != (KitSupply{kit, component}) || taskset.priority != 1 {
+				t.Errorf("Taskset %d of the %s supplies %+v with priority %d", taskset.id, component, supplies, taskset.priority)
+			}
+		}
+	}
+	// only the scooters are booked for the order once they are submitted
+	if booked := controlCenter.orders.booked(); len(booked) != 0 {
+		t.Errorf("Units %v are booked before the order is submitted", booked)
+	}
+	for i := range tasksets {
+		if _, err := controlCenter.Submit(&tasksets[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if booked := controlCenter.orders.booked(); booked["A"] != 2 || len(booked) != 1 {
+		t.Errorf("Booked units are %v", booked)
+	}
+
+	// a kit that contains the product, a kit without an assembly and an unknown component
+	lid := Product{ID: "lid", Recipe: []RecipeStep{{Station: "pickup"}}}
+	for _, catalogue := range []Catalogue{
+		{"box": {ID: "box", Recipe: []RecipeStep{{Station: "assembly"}}, Kit: []string{"box"}}},
+		{"box": {ID: "box", Recipe: []RecipeStep{{Station: "pickup"}}, Kit: []string{"lid"}}, "lid": lid},
+		{"box": {ID: "box", Recipe: []RecipeStep{{Station: "assembly"}}, Kit: []string{"lid"}}},
+	} {
+		if _, err := catalogue.Expand(&controlCenter, Order{Product: "box"}, 1); err == nil {
+			t.Errorf("Box of %+v was expanded", catalogue)
+		}
+	}
+}
+
+// Test that the genealogy follows the inputs of the assemblies
+func TestGenealogy(t *testing.T) {
+	programTime := StartProgramTime()
+	controlCenter := BuildFactory(1, 1, 0, 0, 1, 1, 0, 0, 1, programTime)
+	controlCenter.kitting.assemblies = []Assembly{
+		{Kit: "motor-3", TaskSet: 3, Product: "motor", Inputs: []KitPart{{"motor-3", "stator", 1, 4}, {"motor-3", "rotor", 2, 5}}},
+		{Kit: "scooter-5", TaskSet: 5, Product: "scooter", Inputs: []KitPart{{"scooter-5", "frame", 4, 6}, {"scooter-5", "motor", 3, 8}}},
+		{Kit: "cart-7", TaskSet: 7, Product: "cart", Inputs: []KitPart{{"cart-7", "wheel", 6, 9}}},
+	}
+	var products []string
+	for _, assembly := range controlCenter.Genealogy(5) {
+		products = append(products, assembly.Product)
+	}
+	if !slices.Equal(products, []string{"scooter", "motor"}) {
+		t.Errorf("Genealogy of taskset 5 has the assemblies %v", products)
+	}
+	if genealogy := controlCenter.Genealogy(4); len(genealogy) != 0 {
+		t.Errorf("Taskset 4 without an assembly has the genealogy %+v", genealogy)
+	}
+}
@@ -0,0 +1,325 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the load generator of the factory
+
+// The load generator sends task sets to the request channel of the control
+// center for as long as a soak test runs. Every arrival is an order of a
+// product of the catalogue (see catalogue.go), expanded into task sets by
+// the routing recipe of the product. The products come from a product mix,
+// the moments they arrive from an arrival process:
+//  - poisson: task sets arrive at random at a constant rate
+//  - bursty: calm phases alternate with bursts at a higher rate, the length
+//    of both is random
+//  - shift: the rate follows a daily profile, e. g. busy mornings, a lunch
+//    break and no orders at night
+//  - trace: historical orders replayed from a CSV file with the columns
+//    time, product id and optionally quantity
+// All times are in program time, all random draws come from the seed of
+// the generator, so a generator with the same seed produces the same load.
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// one arrival of an order
+type OrderArrival struct {
+	At       float64 // program time, relative to the start of the generator
+	Product  string  // id of the product, drawn from the product mix for every unit if empty
+	Quantity int     // number of units ordered
+}
+
+// share of a product of the catalogue in the load
+type ProductShare struct {
+	Product string // id of the product
+	Share   float64
+}
+
+// products of the load and their shares
+type ProductMix []ProductShare
+
+// arrival process of the load generator
+type ArrivalProcess interface {
+	// next arrival after the given program time, false if there are no more
+	Next(after float64, random *rand.Rand) (OrderArrival, bool)
+}
+
+// //////////////////// Arrival processes //////////////////////
+
+// task sets arriving at random at a constant rate
+type Poisson struct {
+	Rate float64 // task sets per unit of program time
+}
+
+func (poisson Poisson) Next(after float64, random *rand.Rand) (OrderArrival, bool) {
+	if poisson.Rate <= 0 {
+		return OrderArrival{}, false
+	}
+	return OrderArrival{At: after + random.ExpFloat64()/poisson.Rate, Quantity: 1}, true
+}
+
+// calm phases alternating with bursts
+type Bursty struct {
+	Rate      float64 // task sets per unit of program time while calm
+	BurstRate float64 // task sets per unit of program time during a burst
+	Calm      float64 // mean length of a calm phase
+	Burst     float64 // mean length of a burst
+	bursting  bool
+	phaseEnd  float64
+}
+
+func (bursty *Bursty) Next(after float64, random *rand.Rand) (OrderArrival, bool) {
+	for {
+		// enter the next phase once the current one is over
+		for after >= bursty.phaseEnd {
+			bursty.bursting = !bursty.bursting && bursty.phaseEnd > 0
+			length := bursty.Calm
+			if bursty.bursting {
+				length = bursty.Burst
+			}
+			if length <= 0 {
+				return OrderArrival{}, false
+			}
+			bursty.phaseEnd = after + random.ExpFloat64()*length
+		}
+		rate := bursty.Rate
+		if bursty.bursting {
+			rate = bursty.BurstRate
+		}
+		// no arrival before the end of the phase, the draw starts anew in the next phase
+		if rate > 0 {
+			if at := after + random.ExpFloat64()/rate; at < bursty.phaseEnd {
+				return OrderArrival{At: at, Quantity: 1}, true
+			}
+		}
+		after = bursty.phaseEnd
+	}
+}
+
+// rates following a daily profile
+type ShiftProfile struct {
+	Rates []float64 // task sets per unit of program time in each slot of the day, e. g. 24 hours
+	Slot  int       // program time of one slot
+}
+
+func (shift ShiftProfile) Next(after float64, random *rand.Rand) (OrderArrival, bool) {
+	if shift.Slot <= 0 || len(shift.Rates) == 0 {
+		return OrderArrival{}, false
+	}
+	// a day without any orders would never end the search
+	busy := false
+	for _, rate := range shift.Rates {
+		busy = busy || rate > 0
+	}
+	if !busy {
+		return OrderArrival{}, false
+	}
+	for {
+		slot := int(after / float64(shift.Slot))
+		end := float64((slot + 1) * shift.Slot)
+		// no arrival before the end of the slot, the draw starts anew in the next slot
+		if rate := shift.Rates[slot%len(shift.Rates)]; rate > 0 {
+			if at := after + random.ExpFloat64()/rate; at < end {
+				return OrderArrival{At: at, Quantity: 1}, true
+			}
+		}
+		after = end
+	}
+}
+
+// historical orders replayed in the order of their times
+type Trace struct {
+	Orders []OrderArrival
+	next   int
+}
+
+func (trace *Trace) Next(after float64, random *rand.Rand) (OrderArrival, bool) {
+	if trace.next >= len(trace.Orders) {
+		return OrderArrival{}, false
+	}
+	trace.next++
+	return trace.Orders[trace.next-1], true
+}
+
+// load a trace of historical orders from a CSV file
+// with the columns time, product id and optionally quantity, a header is skipped
+func LoadTrace(path string) (*Trace, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("trace: %v", err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	trace := &Trace{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("trace: %v", err)
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("trace: line %d has %d columns, want time, product and quantity", line, len(record))
+		}
+		at, err := strconv.ParseFloat(strings.TrimSpace(record[0]), 64)
+		if err != nil {
+			if line == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("trace: line %d: invalid time %q", line, record[0])
+		}
+		order := OrderArrival{At: at, Product: strings.TrimSpace(record[1]), Quantity: 1}
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			if order.Quantity, err = strconv.Atoi(strings.TrimSpace(record[2])); err != nil || order.Quantity < 1 {
+				return nil, fmt.Errorf("trace: line %d: invalid quantity %q", line, record[2])
+			}
+		}
+		trace.Orders = append(trace.Orders, order)
+	}
+	sort.SliceStable(trace.Orders, func(i, j int) bool { return trace.Orders[i].At < trace.Orders[j].At })
+	return trace, nil
+}
+
+// arrival process by name: poisson, bursty or shift at the given mean rate,
+// or the path of a CSV trace
+func NewArrivalProcess(name string, rate float64) (ArrivalProcess, error) {
+	switch name {
+	case "poisson":
+		return Poisson{Rate: rate}, nil
+	case "bursty":
+		// bursts at 4 times the rate a sixth of the time, so the mean rate is the given rate
+		return &Bursty{Rate: 0.4 * rate, BurstRate: 4 * rate, Calm: 100, Burst: 20}, nil
+	case "shift":
+		// two shifts from 6 to 22 o'clock with a peak in the morning and a lunch break,
+		// one hour lasts 60 units of program time
+		profile := []float64{0, 0, 0, 0, 0, 0, 1, 1.5, 1.5, 1.2, 1, 1, 0.3, 1, 1, 1, 1, 0.8, 0.8, 0.7, 0.6, 0.5, 0, 0}
+		sum := 0.0
+		for _, share := range profile {
+			sum += share
+		}
+		// the mean rate over the day is the given rate
+		for i := range profile {
+			profile[i] *= rate * float64(len(profile)) / sum
+		}
+		return ShiftProfile{Rates: profile, Slot: 60}, nil
+	}
+	if strings.HasSuffix(name, ".csv") {
+		return LoadTrace(name)
+	}
+	return nil, fmt.Errorf("unknown arrival process %q, want poisson, bursty, shift or a CSV trace", name)
+}
+
+// //////////////////// Generator //////////////////////
+
+// load generator of a soak test
+type LoadGenerator struct {
+	Catalogue Catalogue      // routing recipes of the products
+	Mix       ProductMix     // products and their shares
+	Arrivals  ArrivalProcess // moments the orders arrive
+	Seed      int64
+	Duration  int // program time the generator runs at most, 0 until the arrivals end
+	FirstID   int // id of the first task set, 1 if 0
+}
+
+// send task sets to the request channel of the control center until the
+// arrivals end, the duration is over or stop is closed
+// returns the number of task sets sent
+func (generator *LoadGenerator) Run(controlCenter *ControlCenter, stop <-chan struct{}) (int, error) {
+	total := 0.0
+	for _, share := range generator.Mix {
+		if _, known := generator.Catalogue[share.Product]; !known {
+			return 0, fmt.Errorf("load: product %q of the mix is not in the catalogue", share.Product)
+		}
+		total += share.Share
+	}
+	if total <= 0 {
+		return 0, errors.New("load: empty product mix")
+	}
+	random := rand.New(rand.NewSource(generator.Seed))
+	id := max(generator.FirstID, 1)
+	start := controlCenter.ProgramTime.GetCurrentTime()
+	sent := 0
+	for after := 0.0; ; {
+		arrival, ok := generator.Arrivals.Next(after, random)
+		if !ok || generator.Duration > 0 && arrival.At >= float64(generator.Duration) {
+			return sent, nil
+		}
+		after = arrival.At
+		// an order of the product, or one order of a drawn product for every unit
+		orders := []Order{{Product: arrival.Product, Quantity: arrival.Quantity}}
+		if arrival.Product == "" {
+			orders = make([]Order, arrival.Quantity)
+			for i := range orders {
+				orders[i] = Order{Product: generator.Mix.draw(random, total).Product, Quantity: 1}
+			}
+		}
+		// wait for the arrival
+		for float64(controlCenter.ProgramTime.GetCurrentTime()-start) < arrival.At {
+			select {
+			case <-stop:
+				return sent, nil
+			case <-controlCenter.ProgramTime.After(1):
+			}
+		}
+		for _, order := range orders {
+			tasksets, err := generator.Catalogue.Expand(controlCenter, order, id)
+			if err != nil {
+				return sent, fmt.Errorf("load: %v", err)
+			}
+			for i := range tasksets {
+				select {
+				case controlCenter.request <- &tasksets[i]:
+				case <-stop:
+					return sent, nil
+				}
+				sent++
+			}
+			id += len(tasksets)
+		}
+	}
+}
+
+// draw a product of the mix at random according to the shares
+func (mix ProductMix) draw(random *rand.Rand, total float64) ProductShare {
+	x := random.Float64() * total
+	for _, share := range mix {
+		if x < share.Share {
+			return share
+		}
+		x -= share.Share
+	}
+	return mix[len(mix)-1]
+}
+
+// mix of the products of the catalogue with equal shares, without the
+// products that are only components of the kits of others
+func (catalogue Catalogue) Mix() ProductMix {
+	components := make(map[string]bool)
+	for _, product := range catalogue {
+		for _, component := range product.Kit {
+			components[component] = true
+		}
+	}
+	var mix ProductMix
+	for id := range catalogue {
+		if !components[id] {
+			mix = append(mix, ProductShare{Product: id, Share: 1})
+		}
+	}
+	slices.SortFunc(mix, func(a, b ProductShare) int { return strings.Compare(a.Product, b.Product) })
+	return mix
+}
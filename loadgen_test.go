@@ -0,0 +1,181 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the load generator
+
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// count the arrivals of a process until the end
+func countArrivals(process ArrivalProcess, seed int64, end float64) []OrderArrival {
+	random := rand.New(rand.NewSource(seed))
+	var arrivals []OrderArrival
+	for after := 0.0; ; {
+		arrival, ok := process.Next(after, random)
+		if !ok || arrival.At >= end {
+			return arrivals
+		}
+		arrivals = append(arrivals, arrival)
+		after = arrival.At
+	}
+}
+
+// Test that the arrival processes keep their mean rate
+func TestArrivalProcesses(t *testing.T) {
+	const rate, end = 0.5, 24 * 60 * 20
+	for _, name := range []string{"poisson", "bursty", "shift"} {
+		process, err := NewArrivalProcess(name, rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		arrivals := countArrivals(process, 1, end)
+		if mean := float64(len(arrivals)) / end; math.Abs(mean-rate) > 0.05*rate {
+			t.Errorf("Mean rate of the %s arrivals is %.3f, want %.3f", name, mean, rate)
+		}
+		for i := 1; i < len(arrivals); i++ {
+			if arrivals[i].At < arrivals[i-1].At || arrivals[i].Quantity != 1 {
+				t.Fatalf("Arrival %d of the %s process is %+v after %+v", i, name, arrivals[i], arrivals[i-1])
+			}
+		}
+	}
+
+	// no orders at night in the shift profile
+	process, _ := NewArrivalProcess("shift", rate)
+	for _, arrival := range countArrivals(process, 2, end) {
+		if hour := int(arrival.At/60) % 24; hour < 6 || hour >= 22 {
+			t.Fatalf("Shift arrival at %.1f is at %d o'clock", arrival.At, hour)
+		}
+	}
+
+	// the same seed gives the same arrivals
+	first := countArrivals(&Bursty{Rate: 0.2, BurstRate: 2, Calm: 100, Burst: 20}, 7, 1000)
+	second := countArrivals(&Bursty{Rate: 0.2, BurstRate: 2, Calm: 100, Burst: 20}, 7, 1000)
+	if len(first) == 0 || len(first) != len(second) || first[len(first)-1] != second[len(second)-1] {
+		t.Errorf("Arrivals with the same seed differ: %d and %d", len(first), len(second))
+	}
+
+	if _, err := NewArrivalProcess("uniform", rate); err == nil {
+		t.Errorf("Unknown arrival process was accepted")
+	}
+}
+
+// Test that a trace is read from a CSV file
+func TestLoadTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.csv")
+	if err := os.WriteFile(path, []byte("time,product,quantity\n30,steel pot,2\n10, steel bar ,\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	process, err := NewArrivalProcess(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arrivals := countArrivals(process, 1, math.Inf(1))
+	want := []OrderArrival{{At: 10, Product: "steel bar", Quantity: 1}, {At: 30, Product: "steel pot", Quantity: 2}}
+	if len(arrivals) != len(want) || arrivals[0] != want[0] || arrivals[1] != want[1] {
+		t.Errorf("Trace is %+v, want %+v", arrivals, want)
+	}
+
+	for _, content := range []string{"10\n", "10,steel bar\nlater,steel pot\n", "10,steel bar,none\n"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadTrace(path); err == nil {
+			t.Errorf("Trace %q was accepted", content)
+		}
+	}
+}
+
+// Test that the generated orders are expanded by the catalogue and processed by the factory
+func TestLoadGenerator(t *testing.T) {
+	programTime := StartSimulatedTime(0, time.Millisecond)
+	controlCenter := BuildFactory(1, 0, 1, 0, 1, 0, 2, 0, 2, programTime)
+	go controlCenter.Boot()
+
+	path := filepath.Join(t.TempDir(), "orders.csv")
+	if err := os.WriteFile(path, []byte("5,bar,2\n20,pot,1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	trace, err := LoadTrace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipe := []RecipeStep{{Station: "pickup", Action: "pickup {product}"}, {Station: "welding", Action: "weld {product} with a {weld_spec} joint"}, {Station: "dropoff", Action: "dropoff {product}"}}
+	catalogue := Catalogue{
+		"bar": {ID: "bar", Name: "steel bar", Recipe: recipe, Parameters: map[string]string{"material": "steel", "weld_spec": "butt"}},
+		"pot": {ID: "pot", Name: "steel pot", Recipe: recipe, Parameters: map[string]string{"material": "steel", "weld_spec": "fillet"}},
+	}
+	generator := LoadGenerator{Catalogue: catalogue, Mix: catalogue.Mix(), Arrivals: trace, Seed: 1}
+	start := programTime.GetCurrentTime()
+	sent, err := generator.Run(&controlCenter, nil)
+	if err != nil || sent != 3 {
+		t.Fatalf("Generator sent %d task sets, %v, want 3", sent, err)
+	}
+	if elapsed := programTime.GetCurrentTime() - start; elapsed < 20 {
+		t.Errorf("Generator finished after %d time units, before the last arrival", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for id, product := range map[int]string{1: "steel bar", 2: "steel bar", 3: "steel pot"} {
+		// the intake opens the handle just after it took the task set
+		handle := controlCenter.Handle(id)
+		for wait := 0; handle == nil && wait < 10; wait++ {
+			programTime.Wait(1)
+			handle = controlCenter.Handle(id)
+		}
+		if handle == nil {
+			t.Fatalf("Taskset %d was not received", id)
+		}
+		result, err := handle.Wait(ctx)
+		if err != nil || result.Status != taskSetCompleted {
+			t.Errorf("Taskset %d finished with %+v, %v", id, result, err)
+		} else if welding := result.Tasks[1].Description; !strings.HasPrefix(welding, "weld "+product+" with") {
+			t.Errorf("Taskset %d welds %q, want the %s of the recipe", id, welding, product)
+		}
+	}
+
+	// products outside the catalogue are rejected
+	generator = LoadGenerator{Catalogue: catalogue, Mix: catalogue.Mix(), Arrivals: &Trace{Orders: []OrderArrival{{Product: "steel wool", Quantity: 1}}}, FirstID: 10}
+	if _, err := generator.Run(&controlCenter, nil); err == nil {
+		t.Errorf("Generator sent a product outside the catalogue")
+	}
+	generator = LoadGenerator{Catalogue: catalogue, Mix: ProductMix{{Product: "wool", Share: 1}}, Arrivals: Poisson{Rate: 1}}
+	if _, err := generator.Run(&controlCenter, nil); err == nil {
+		t.Errorf("Generator drew from a product outside the catalogue")
+	}
+}
+
+// Test that the products of the mix are drawn by their shares and the
+// components of kits are left out of the mix of a catalogue
+func TestProductMix(t *testing.T) {
+	mix := DefaultCatalogue().Mix()
+	var products []string
+	for _, share := range mix {
+		products = append(products, share.Product)
+	}
+	if want := []string{"bar", "pot", "scooter", "wool"}; !slices.Equal(products, want) {
+		t.Errorf("Mix of the default catalogue has the products %v, want %v", products, want)
+	}
+
+	random := rand.New(rand.NewSource(1))
+	drawn := make(map[string]int)
+	weighted := ProductMix{{Product: "bar", Share: 3}, {Product: "pot", Share: 1}}
+	for i := 0; i < 4000; i++ {
+		drawn[weighted.draw(random, 4).Product]++
+	}
+	if math.Abs(float64(drawn["bar"])/4000-0.75) > 0.03 {
+		t.Errorf("Drawn products are %v, want 3 bars for every pot", drawn)
+	}
+}
@@ -0,0 +1,180 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the maintenance and fault handling of the stations
+
+// Stations can be taken out of service in two ways:
+//  - scheduled maintenance windows, either calendar based (every X units
+//    of program time) or usage based (after every N tasks). A station
+//    finishes its current job and is then withheld from the free
+//    facilities of its facility set for the duration of the window.
+//  - unscheduled faults, which happen randomly while a task is processed.
+//    The task is aborted, the assigned workers are released and the
+//    transportation worker requeues the task to another station of the
+//    same facility set. The faulty station is repaired before it is
+//    free again.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// maintenance plan of a facility, all times are in program time
+// a zero value plan never takes the facility out of service
+type MaintenancePlan struct {
+	Start      int     // program time of the first calendar based window
+	Interval   int     // program time between calendar based windows, 0 disables them
+	EveryTasks int     // number of tasks between usage based windows, 0 disables them
+	Duration   int     // length of a maintenance window
+	FaultRate  float64 // probability that a task is aborted by a station fault
+	RepairTime int     // time needed to repair a station after a fault
+}
+
+// //////////////////// Configuration //////////////////////
+
+// set the maintenance plan of a facility
+// must be called before the factory is booted
+func (facility *Facility) SetMaintenance(plan MaintenancePlan) {
+	facility.maintenance = plan
+	facility.nextMaintenance = plan.Start
+	facility.tasksDone = 0
+}
+
+// set the same maintenance plan for all facilities of a facility set
+// must be called before the factory is booted
+func (facilitySet *FacilitySet) SetMaintenance(plan MaintenancePlan) {
+	for _, facility := range facilitySet.facilities {
+		facility.SetMaintenance(plan)
+	}
+}
+
+// //////////////////// Maintenance windows //////////////////////
+
+// check if a maintenance window of the facility is due
+// the counters are read under the status mutex, the station may update them
+func (facility *Facility) maintenanceDue() bool {
+	facility.statusMutex.Lock()
+	defer facility.statusMutex.Unlock()
+	plan := facility.maintenance
+	if plan.EveryTasks > 0 && facility.tasksDone >= plan.EveryTasks {
+		return true
+	}
+	return plan.Interval > 0 && facility.programTime.GetCurrentTime() >= facility.nextMaintenance
+}
+
+// withhold the facility for the duration of a maintenance window
+func (facility *Facility) maintain() {
+	facility.events.println("🔧: maintenance of", facility.facilityType, "station", facility.id, "started")
+	facility.state.facility(facility, statusMaintenance, 0)
+	facility.outOfService(facility.maintenance.Duration)
+	facility.statusMutex.Lock()
+	facility.maintenances++
+	facility.tasksDone = 0
+	if facility.maintenance.Interval > 0 {
+		// skip windows that were missed while the station was busy
+		now := facility.programTime.GetCurrentTime()
+		for facility.nextMaintenance <= now {
+			facility.nextMaintenance += facility.maintenance.Interval
+		}
+	}
+	facility.state.serviced(facility, facility.tasksDone, facility.maintenances, facility.faults)
+	facility.statusMutex.Unlock()
+	facility.events.println("🔧: maintenance of", facility.facilityType, "station", facility.id, "finished")
+}
+
+// take the facility out of service for the given amount of program time
+func (facility *Facility) outOfService(duration int) {
+	facility.statusMutex.Lock()
+	facility.availableAt = facility.programTime.GetCurrentTime() + duration
+	facility.statusMutex.Unlock()
+	facility.programTime.Wait(duration)
+}
+
+// make the facility available when the factory is booted
+// a facility restored from a snapshot may still be out of service for a while
+func (facility *Facility) makeAvailable(freeFacilities chan *Facility) {
+	remaining := facility.availableAt - facility.programTime.GetCurrentTime()
+	if remaining <= 0 {
+		facility.free(freeFacilities)
+		return
+	}
+	facility.state.facility(facility, statusMaintenance, 0)
+	go func() {
+		facility.outOfService(remaining)
+		facility.free(freeFacilities)
+	}()
+}
+
+// get a free facility of the set
+// facilities that became due for maintenance while they were idle
+// are sent to maintenance first and only return once it is done
+// the facility to avoid is only taken if the set has no other facility
+// returns nil if abort is closed before a facility is free
+func (facilitySet *FacilitySet) acquire(abort <-chan struct{}, avoid *Facility) *Facility {
+	// the avoided facility is held back until another one is free
+	var held *Facility
+	defer func() {
+		if held != nil {
+			facilitySet.freeFacilities <- held
+		}
+	}()
+	for {
+		var facility *Facility
+		select {
+		case facility = <-facilitySet.freeFacilities:
+		case <-abort:
+			return nil
+		}
+		if facility == avoid && len(facilitySet.facilities) > 1 {
+			held = facility
+			continue
+		}
+		if !facility.maintenanceDue() {
+			return facility
+		}
+		go func() {
+			facility.maintain()
+			facility.free(facilitySet.freeFacilities)
+		}()
+	}
+}
+
+// free the facility after it finished its current job
+// a due maintenance window is carried out before
+func (facility *Facility) release(freeFacilities chan *Facility) {
+	facility.statusMutex.Lock()
+	facility.tasksDone++
+	facility.state.serviced(facility, facility.tasksDone, facility.maintenances, facility.faults)
+	facility.statusMutex.Unlock()
+	if facility.maintenanceDue() {
+		facility.maintain()
+	}
+	facility.free(freeFacilities)
+}
+
+// //////////////////// Faults //////////////////////
+
+// check if the task at the facility is aborted by a station fault
+func (facility *Facility) faulted(task *Task) bool {
+	if facility.maintenance.FaultRate == 0 || rand.Float64() >= facility.maintenance.FaultRate {
+		return false
+	}
+	facility.statusMutex.Lock()
+	facility.faults++
+	facility.state.serviced(facility, facility.tasksDone, facility.maintenances, facility.faults)
+	facility.statusMutex.Unlock()
+	task.cancel(fmt.Sprintf("fault at %s station %d", facility.facilityType, facility.id))
+	facility.events.println("[", task.tasksetID, "]", "💥: fault at", facility.facilityType, "station", facility.id, ", task", task.description, "aborted")
+	return true
+}
+
+// repair the facility after a fault and free it again
+func (facility *Facility) repair(freeFacilities chan *Facility) {
+	facility.state.facility(facility, statusRepair, 0)
+	facility.outOfService(facility.maintenance.RepairTime)
+	facility.events.println("🔧: repair of", facility.facilityType, "station", facility.id, "finished")
+	facility.free(freeFacilities)
+}
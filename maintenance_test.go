@@ -0,0 +1,99 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for station maintenance and faults
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that a task aborted by a station fault is requeued to another station
+func TestStationFaultRequeue(t *testing.T) {
+	programTime := StartProgramTime()
+
+	N := 1 // N robots of each kind
+	W := 0 // W facilities on welding stations
+	P := 2 // P facilities on painting stations
+	A := 0 // A facilities on assembly stations
+	I := 1 // I facilities on pick-up stations
+	D := 1 // D facilities on drop-off stations
+
+	// Build the factory with specified number of facilities and workers
+	controlCenter := BuildFactory(I, A, W, P, D, N, N, N, N, programTime)
+
+	// painting station 0 always faults and is never repaired in time
+	controlCenter.PaintingStations.facilities[0].SetMaintenance(MaintenancePlan{FaultRate: 1, RepairTime: 100})
+
+	// Boot the control center
+	go controlCenter.Boot()
+
+	// Create a task set for painting station
+	paintingTask := gen_task_set(&controlCenter, 1, []string{"pickup", "painting", "dropoff"}, []string{"pickup component", "paint component", "dropoff component"})
+	controlCenter.request <- &paintingTask
+
+	for programTime.GetCurrentTime() < 15 {
+		time.Sleep(1 * time.Second)
+		if controlCenter.State().CompletedTaskSets == 1 {
+			break
+		}
+	}
+
+	// Check if the painting task is complete
+	if controlCenter.State().CompletedTaskSets != 1 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.State().CompletedTaskSets)
+	}
+
+	// Check that the task was painted at the working station
+	if paintingTask.tasks[1].Facility.id != 1 {
+		t.Errorf("Painting task was completed at station %d, want 1", paintingTask.tasks[1].Facility.id)
+	}
+}
+
+// Test that a usage based maintenance window withholds the station
+func TestMaintenanceEveryNTasks(t *testing.T) {
+	programTime := StartProgramTime()
+
+	N := 2 // N robots of each kind
+	W := 0 // W facilities on welding stations
+	P := 0 // P facilities on painting stations
+	A := 0 // A facilities on assembly stations
+	I := 1 // I facilities on pick-up stations
+	D := 1 // D facilities on drop-off stations
+
+	// Build the factory with specified number of facilities and workers
+	controlCenter := BuildFactory(I, A, W, P, D, N, N, N, N, programTime)
+
+	// the pickup station is maintained after every task
+	controlCenter.PickupStations.SetMaintenance(MaintenancePlan{EveryTasks: 1, Duration: 2})
+
+	// Boot the control center
+	go controlCenter.Boot()
+
+	tasksetA := gen_task_set(&controlCenter, 1, []string{"pickup", "dropoff"}, []string{"pickup steel bar", "dropoff steel bar"})
+	controlCenter.request <- &tasksetA
+
+	tasksetB := gen_task_set(&controlCenter, 2, []string{"pickup", "dropoff"}, []string{"pickup steel wool", "dropoff steel wool"})
+	controlCenter.request <- &tasksetB
+
+	for programTime.GetCurrentTime() < 20 {
+		time.Sleep(1 * time.Second)
+		if controlCenter.State().CompletedTaskSets == 2 {
+			time.Sleep(2 * time.Second)
+			break
+		}
+	}
+
+	// Check if both task sets are complete
+	if controlCenter.State().CompletedTaskSets != 2 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 2", controlCenter.State().CompletedTaskSets)
+	}
+
+	// Check that the pickup station was maintained after each task
+	if pickup, _ := controlCenter.State().Facility("pickup", 0); pickup.Maintenances != 2 {
+		t.Errorf("Pickup station was maintained %d times, want 2", pickup.Maintenances)
+	}
+}
@@ -0,0 +1,220 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the completion notifications of task sets
+
+// Every task set received by the control center gets a handle, which is
+// resolved once the task set is completed or failed. Submit returns the
+// handle, so callers wait for it instead of polling the state.
+// The control center also notifies subscribers about every finished task
+// set, either callbacks in the program or webhooks, which get the result
+// posted as JSON.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// final result of a task set
+type TaskSetResult struct {
+	ID        int          `json:"taskset"`
+	Status    string       `json:"status"` // completed, failed or dropped
+	Failure   string       `json:"failure,omitempty"`
+	Tasks     []TaskTiming `json:"tasks"`
+	Submitted int          `json:"submitted"` // program time the task set was received
+	Time      int          `json:"time"`      // program time the task set finished
+}
+
+// timing of one task of a task set, all times are in program time
+// tasks completed before a recovery or restore have no timing
+type TaskTiming struct {
+	Station     string          `json:"station"`
+	Description string          `json:"description"`
+	Facility    int             `json:"facility"`             // id of the facility of the last attempt, -1 if none
+	Attempts    int             `json:"attempts"`             // number of attempts, 0 if not carried out
+	Started     int             `json:"started"`              // program time of the first attempt
+	Finished    int             `json:"finished"`             // program time the task was completed or given up
+	Waited      int             `json:"waited"`               // program time the completed attempt waited for its facility and workers
+	Batched     int             `json:"batched,omitempty"`    // number of tasks processed in the same cycle if the station batches them
+	Attributes  *TaskAttributes `json:"attributes,omitempty"` // typed attributes of the task, see attributes.go
+	Completed   bool            `json:"completed"`
+}
+
+// handle of a submitted task set
+type TaskSetHandle struct {
+	id     int
+	done   chan struct{}
+	result TaskSetResult
+}
+
+// handles and subscribers of the control center
+type notifier struct {
+	mutex       sync.Mutex
+	handles     map[int]*TaskSetHandle
+	subscribers []func(TaskSetResult)
+}
+
+func newNotifier() *notifier {
+	return &notifier{handles: make(map[int]*TaskSetHandle)}
+}
+
+// //////////////////// Handles //////////////////////
+
+// get the handle of the latest submission of a task set, nil if it was never received
+func (controlCenter *ControlCenter) Handle(id int) *TaskSetHandle {
+	controlCenter.notifier.mutex.Lock()
+	defer controlCenter.notifier.mutex.Unlock()
+	return controlCenter.notifier.handles[id]
+}
+
+// get the handles of all task sets that are not finished yet, ordered by id
+func (controlCenter *ControlCenter) Unfinished() []*TaskSetHandle {
+	controlCenter.notifier.mutex.Lock()
+	defer controlCenter.notifier.mutex.Unlock()
+	var unfinished []*TaskSetHandle
+	for _, handle := range controlCenter.notifier.handles {
+		if _, finished := handle.Result(); !finished {
+			unfinished = append(unfinished, handle)
+		}
+	}
+	sort.Slice(unfinished, func(i, j int) bool { return unfinished[i].id < unfinished[j].id })
+	return unfinished
+}
+
+// id of the task set
+func (handle *TaskSetHandle) ID() int {
+	return handle.id
+}
+
+// channel that is closed once the task set is completed or failed
+func (handle *TaskSetHandle) Done() <-chan struct{} {
+	return handle.done
+}
+
+// wait until the task set is completed or failed
+// returns the error of the context if it is done before
+func (handle *TaskSetHandle) Wait(ctx context.Context) (TaskSetResult, error) {
+	select {
+	case <-handle.done:
+		return handle.result, nil
+	case <-ctx.Done():
+		return TaskSetResult{}, ctx.Err()
+	}
+}
+
+// get the result of the task set, false if it is not finished yet
+func (handle *TaskSetHandle) Result() (TaskSetResult, bool) {
+	select {
+	case <-handle.done:
+		return handle.result, true
+	default:
+		return TaskSetResult{}, false
+	}
+}
+
+// open a handle for a task set
+// an open handle of the task set is kept unless a new one is forced
+func (notifier *notifier) open(id int, force bool) *TaskSetHandle {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if handle, known := notifier.handles[id]; known && !force {
+		if _, finished := handle.Result(); !finished {
+			return handle
+		}
+	}
+	handle := &TaskSetHandle{id: id, done: make(chan struct{})}
+	notifier.handles[id] = handle
+	return handle
+}
+
+// forget the handle of a task set that was not accepted
+func (notifier *notifier) discard(handle *TaskSetHandle) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if notifier.handles[handle.id] == handle {
+		delete(notifier.handles, handle.id)
+	}
+}
+
+// //////////////////// Subscribers //////////////////////
+
+// call the function for every completed or failed task set
+// the functions of one task set are called one after the other in their
+// own go routine, so a slow subscriber does not hold up the factory
+func (controlCenter *ControlCenter) Subscribe(subscriber func(TaskSetResult)) {
+	controlCenter.notifier.mutex.Lock()
+	defer controlCenter.notifier.mutex.Unlock()
+	controlCenter.notifier.subscribers = append(controlCenter.notifier.subscribers, subscriber)
+}
+
+// post the result of every completed or failed task set as JSON to the url
+func (controlCenter *ControlCenter) AddWebhook(url string) {
+	client := http.Client{Timeout: 5 * time.Second}
+	controlCenter.Subscribe(func(result TaskSetResult) {
+		body, err := json.Marshal(result)
+		if err != nil {
+			controlCenter.events.println("🔔: could not encode result of taskset", result.ID, ":", err)
+			return
+		}
+		response, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			controlCenter.events.println("🔔: webhook", url, "failed:", err)
+			return
+		}
+		response.Body.Close()
+		if response.StatusCode >= 300 {
+			controlCenter.events.println("🔔: webhook", url, "answered", response.Status)
+		}
+	})
+}
+
+// resolve the handle of a finished task set and notify the subscribers
+func (controlCenter *ControlCenter) notifyFinished(taskset *TaskSet) {
+	result := TaskSetResult{ID: taskset.id, Status: taskSetCompleted, Failure: taskset.failure, Tasks: taskset.timings, Submitted: taskset.submitted, Time: controlCenter.ProgramTime.GetCurrentTime()}
+	if taskset.failure != "" {
+		result.Status = taskSetFailed
+	}
+	controlCenter.resolve(result)
+}
+
+// resolve the handle of a task set dropped from the intake queue and notify the subscribers
+func (controlCenter *ControlCenter) notifyDropped(taskset *TaskSet) {
+	controlCenter.resolve(TaskSetResult{ID: taskset.id, Status: taskSetDropped, Failure: "dropped from the full intake queue", Submitted: taskset.submitted, Time: controlCenter.ProgramTime.GetCurrentTime()})
+}
+
+// resolve the handle of a task set and notify the subscribers
+func (controlCenter *ControlCenter) resolve(result TaskSetResult) {
+	handle := controlCenter.notifier.open(result.ID, false)
+	controlCenter.notifier.mutex.Lock()
+	subscribers := make([]func(TaskSetResult), len(controlCenter.notifier.subscribers))
+	copy(subscribers, controlCenter.notifier.subscribers)
+	controlCenter.notifier.mutex.Unlock()
+	handle.result = result
+	close(handle.done)
+	go func() {
+		for _, subscriber := range subscribers {
+			subscriber(result)
+		}
+	}()
+}
+
+// //////////////////// Timings //////////////////////
+
+// start the timings of a task set carried by a transportation worker
+func (taskset *TaskSet) startTimings() {
+	if taskset.timings != nil {
+		return
+	}
+	taskset.timings = make([]TaskTiming, len(taskset.tasks))
+	for i, task := range taskset.tasks {
+		taskset.timings[i] = TaskTiming{Station: task.FacilityType.facilityType, Description: task.description, Attributes: task.attributes.typed(), Facility: -1, Completed: task.completed}
+	}
+}
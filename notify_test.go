@@ -0,0 +1,115 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the completion notifications
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that handles, subscribers and webhooks report completed and failed task sets
+func TestTaskSetHandles(t *testing.T) {
+	programTime := StartProgramTime()
+
+	// Build the factory with 1 pickup, 1 painting and 1 dropoff station
+	controlCenter := BuildFactory(1, 0, 0, 1, 1, 1, 1, 1, 2, programTime)
+
+	// every painting is rejected and not retried
+	controlCenter.PaintingStations.SetQualityCheck(1)
+	controlCenter.PaintingStations.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+
+	// collect the results of the subscriber and the webhook
+	var mutex sync.Mutex
+	subscribed := make(map[int]string)
+	controlCenter.Subscribe(func(result TaskSetResult) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		subscribed[result.ID] = result.Status
+	})
+	posted := make(chan TaskSetResult, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result TaskSetResult
+		if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+			t.Errorf("Webhook got invalid result: %v", err)
+		}
+		posted <- result
+	}))
+	defer server.Close()
+	controlCenter.AddWebhook(server.URL)
+
+	// Boot the control center
+	go controlCenter.Boot()
+
+	tasksetA := gen_task_set(&controlCenter, 1, []string{"pickup", "dropoff"}, []string{"pickup steel bar", "dropoff steel bar"})
+	tasksetB := gen_task_set(&controlCenter, 2, []string{"pickup", "painting", "dropoff"}, []string{"pickup steel pot", "paint steel pot", "dropoff steel pot"})
+	handleA, err := controlCenter.Submit(&tasksetA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleB, err := controlCenter.Submit(&tasksetB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a task set is not finished right after its submission
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := handleA.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Waiting for taskset 1 returned %v, want deadline exceeded", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	resultA, err := handleA.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resultB, err := handleB.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check the results and timings
+	if resultA.Status != taskSetCompleted || len(resultA.Tasks) != 2 {
+		t.Errorf("Result of taskset 1 is %+v, want completed with 2 tasks", resultA)
+	}
+	for i, timing := range resultA.Tasks {
+		if !timing.Completed || timing.Attempts != 1 || timing.Facility != 0 || timing.Finished < timing.Started {
+			t.Errorf("Timing of task %d of taskset 1 is %+v", i, timing)
+		}
+	}
+	if resultB.Status != taskSetFailed || resultB.Failure == "" || resultB.Tasks[1].Completed || resultB.Tasks[2].Attempts != 0 {
+		t.Errorf("Result of taskset 2 is %+v, want failed at the painting", resultB)
+	}
+	select {
+	case <-handleB.Done():
+	default:
+		t.Errorf("Done channel of taskset 2 is not closed")
+	}
+
+	// Check the notifications of the subscriber and the webhook
+	for i := 0; i < 2; i++ {
+		select {
+		case result := <-posted:
+			if want := map[int]string{1: taskSetCompleted, 2: taskSetFailed}[result.ID]; result.Status != want {
+				t.Errorf("Webhook got status %q of taskset %d, want %q", result.Status, result.ID, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Webhook got %d results, want 2", i)
+		}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if subscribed[1] != taskSetCompleted || subscribed[2] != taskSetFailed {
+		t.Errorf("Subscriber got %v", subscribed)
+	}
+}
@@ -0,0 +1,193 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the queueing estimator of the factory
+
+// Every facility type is modelled as a queue with several servers (M/M/c):
+// a task waits until a facility and all workers it requires are free, so a
+// server is a facility together with its workers, e. g. a welding station
+// and 2 welders. Whichever of the two is scarcer limits the servers:
+//  - c facilities, each occupied commute + work per task
+//  - c teams of workers, each occupied commute + work + commute per task
+// The task sets themselves wait in the dispatch queue for a transportation
+// worker and a pickup station, a transportation worker is occupied for the
+// whole task set (see capacity.go).
+// From the arrival rate λ and the service time S of a queue with c servers
+// follow the offered load a = λS, the utilization ρ = a/c, the probability
+// to wait (Erlang C), the mean waiting time Wq = C(c, a) S / (c - a) and the
+// mean queue length Lq = λ Wq. A queue with ρ >= 1 grows without limit.
+// The model assumes random arrivals and service times, the factory has fixed
+// durations, and it leaves out that transportation workers wait at the
+// stations, so it is only a first estimate. CompareQueues puts the estimates
+// next to the values measured in a simulated run to check it.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// estimate of one queue of the factory
+type QueueEstimate struct {
+	Queue           string  // facility type, dispatch for the task sets
+	Limit           string  // resource limiting the servers, e. g. welding worker
+	Servers         int     // number of tasks served at the same time
+	ArrivalRate     float64 // tasks per unit of program time
+	ServiceTime     float64 // program time a server is occupied per task
+	Utilization     float64 // share of the time the servers are busy
+	WaitProbability float64 // probability that a task has to wait (Erlang C)
+	Wait            float64 // mean waiting time in program time, +Inf if the queue grows without limit
+	QueueLength     float64 // mean number of waiting tasks, +Inf if the queue grows without limit
+}
+
+// estimate and measured values of one queue
+type QueueComparison struct {
+	QueueEstimate
+	MeasuredWait        float64
+	MeasuredQueueLength float64
+	MeasuredUtilization float64 // of the limiting resource
+}
+
+// estimates and measured values of all queues
+type QueueComparisons []QueueComparison
+
+// estimate the queues of the layout for the order mix arriving at the rate,
+// in the order of the station types and the dispatch queue first
+func EstimateQueues(layout Layout, durations Durations, mix OrderMix, rate float64) ([]QueueEstimate, error) {
+	if rate <= 0 {
+		return nil, errors.New("queues: need a positive rate")
+	}
+	plan, err := PlanCapacity(layout, durations, mix, rate)
+	if err != nil {
+		return nil, err
+	}
+	units := layout.units()
+	commute := float64(durations.Commute)
+
+	// the dispatch queue is limited by the transportation workers or the pickup stations
+	transport := 0.0
+	for _, load := range plan.Resources {
+		if load.Resource == "transport worker" {
+			transport = load.Demand
+		}
+	}
+	estimates := []QueueEstimate{erlangQueue(dispatchStation, rate, []queueServer{
+		{"transport worker", layout.TransportWorkers, transport},
+		{"pickup station", layout.PickupStations, commute + float64(durations.work("pickup"))},
+	})}
+
+	// tasks per task set at every station type
+	total := 0.0
+	for _, share := range mix {
+		total += share.Share
+	}
+	visits := make(map[string]float64)
+	for _, share := range mix {
+		for _, station := range share.Route {
+			visits[station] += share.Share / total
+		}
+	}
+	for _, station := range []string{"welding", "assembly", "painting", "dropoff"} {
+		if visits[station] == 0 {
+			continue
+		}
+		work := float64(durations.work(station))
+		servers := []queueServer{{station + " station", *units[station+" station"], commute + work}}
+		if required := stationWorkers[station]; required.n > 0 {
+			resource := required.specialization + " worker"
+			servers = append(servers, queueServer{resource, *units[resource] / required.n, 2*commute + work})
+		}
+		estimates = append(estimates, erlangQueue(station, rate*visits[station], servers))
+	}
+	return estimates, nil
+}
+
+// servers a queue could be limited by
+type queueServer struct {
+	resource string
+	servers  int
+	service  float64
+}
+
+// estimate a queue limited by the server with the lowest capacity
+func erlangQueue(queue string, arrivalRate float64, servers []queueServer) QueueEstimate {
+	limit := servers[0]
+	for _, server := range servers[1:] {
+		if float64(server.servers)/server.service < float64(limit.servers)/limit.service {
+			limit = server
+		}
+	}
+	estimate := QueueEstimate{Queue: queue, Limit: limit.resource, Servers: limit.servers, ArrivalRate: arrivalRate, ServiceTime: limit.service}
+	load := arrivalRate * limit.service
+	if load >= float64(limit.servers) {
+		estimate.Utilization = math.Inf(1)
+		if limit.servers > 0 {
+			estimate.Utilization = load / float64(limit.servers)
+		}
+		estimate.WaitProbability = 1
+		estimate.Wait, estimate.QueueLength = math.Inf(1), math.Inf(1)
+		return estimate
+	}
+	estimate.Utilization = load / float64(limit.servers)
+	estimate.WaitProbability = erlangC(limit.servers, load)
+	estimate.Wait = estimate.WaitProbability * limit.service / (float64(limit.servers) - load)
+	estimate.QueueLength = arrivalRate * estimate.Wait
+	return estimate
+}
+
+// probability that a task has to wait in a queue with c servers and the
+// offered load a < c, computed from the Erlang B recursion
+func erlangC(c int, a float64) float64 {
+	b := 1.0
+	for k := 1; k <= c; k++ {
+		b = a * b / (float64(k) + a*b)
+	}
+	return float64(c) * b / (float64(c) - a*(1-b))
+}
+
+// put the estimates next to the values measured in the simulation
+// the measured queue length is the total waiting time divided by the length of the run
+func CompareQueues(estimates []QueueEstimate, simulation Simulation) QueueComparisons {
+	waited := make(map[string]float64)
+	tasks := make(map[string]int)
+	for _, result := range simulation.Results {
+		if len(result.Tasks) > 0 {
+			waited[dispatchStation] += float64(result.Tasks[0].Started - result.Submitted)
+			tasks[dispatchStation]++
+		}
+		for _, timing := range result.Tasks {
+			if timing.Completed {
+				waited[timing.Station] += float64(timing.Waited)
+				tasks[timing.Station]++
+			}
+		}
+	}
+	comparisons := make(QueueComparisons, 0, len(estimates))
+	for _, estimate := range estimates {
+		comparison := QueueComparison{QueueEstimate: estimate, MeasuredUtilization: simulation.Utilization[estimate.Limit]}
+		if tasks[estimate.Queue] > 0 {
+			comparison.MeasuredWait = waited[estimate.Queue] / float64(tasks[estimate.Queue])
+		}
+		if simulation.Elapsed > 0 {
+			comparison.MeasuredQueueLength = waited[estimate.Queue] / float64(simulation.Elapsed)
+		}
+		comparisons = append(comparisons, comparison)
+	}
+	return comparisons
+}
+
+// table of the estimates and measured values
+func (comparisons QueueComparisons) String() string {
+	var table strings.Builder
+	fmt.Fprintf(&table, "%-9s %-17s %7s %7s %7s %17s %8s %17s %17s\n", "queue", "limit", "servers", "arrival", "service", "utilization", "P(wait)", "wait", "queue length")
+	fmt.Fprintf(&table, "%-9s %-17s %7s %7s %7s %8s %8s %8s %8s %8s %8s %8s\n", "", "", "", "", "", "model", "measured", "model", "model", "measured", "model", "measured")
+	for _, comparison := range comparisons {
+		fmt.Fprintf(&table, "%-9s %-17s %7d %7.3f %7.2f %7.0f%% %7.0f%% %8.3f %8.2f %8.2f %8.2f %8.2f\n", comparison.Queue, comparison.Limit, comparison.Servers, comparison.ArrivalRate, comparison.ServiceTime,
+			100*comparison.Utilization, 100*comparison.MeasuredUtilization, comparison.WaitProbability, comparison.Wait, comparison.MeasuredWait, comparison.QueueLength, comparison.MeasuredQueueLength)
+	}
+	return table.String()
+}
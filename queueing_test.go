@@ -0,0 +1,97 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the queueing estimator
+
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// Test the Erlang C formula against known values
+func TestErlangC(t *testing.T) {
+	for _, test := range []struct {
+		c    int
+		a    float64
+		want float64
+	}{
+		{1, 0.5, 0.5},         // a single server is busy with probability ρ
+		{2, 1, 1.0 / 3},       // 2 servers at half load
+		{3, 2, 4.0 / 9},       // 3 servers at two thirds load
+		{10, 5, 0.0361053592}, // 10 servers at half load
+	} {
+		if got := erlangC(test.c, test.a); math.Abs(got-test.want) > 1e-6 {
+			t.Errorf("Erlang C of %d servers with load %v is %v, want %v", test.c, test.a, got, test.want)
+		}
+	}
+}
+
+// Test the estimates of the queues of the demo factory
+func TestEstimateQueues(t *testing.T) {
+	mix := OrderMix{{Route: []string{"pickup", "welding", "assembly", "painting", "dropoff"}, Share: 1}}
+	estimates, err := EstimateQueues(Layout{2, 2, 2, 2, 2, 2, 2, 2, 2}, FactoryDurations(), mix, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byQueue := make(map[string]QueueEstimate)
+	for _, estimate := range estimates {
+		byQueue[estimate.Queue] = estimate
+	}
+
+	// 2 welders make 1 team, which is busy 3 time units per task set (M/M/1)
+	welding := byQueue["welding"]
+	if welding.Limit != "welding worker" || welding.Servers != 1 || math.Abs(welding.Utilization-0.3) > 1e-9 || math.Abs(welding.Wait-0.3*3/0.7) > 1e-9 {
+		t.Errorf("Estimate of the welding queue is %+v, want 1 team of welders busy 30 percent of the time", welding)
+	}
+	// the task sets wait for 1 of 2 transport workers, each busy 11 time units per task set
+	dispatch := byQueue[dispatchStation]
+	if dispatch.Limit != "transport worker" || dispatch.Servers != 2 || math.Abs(dispatch.Utilization-0.55) > 1e-9 || math.Abs(dispatch.QueueLength-0.1*dispatch.Wait) > 1e-9 {
+		t.Errorf("Estimate of the dispatch queue is %+v, want 2 transport workers busy 55 percent of the time", dispatch)
+	}
+	if _, known := byQueue["pickup"]; known || len(estimates) != 5 {
+		t.Errorf("Estimates are %+v, want the dispatch queue and 4 station types", estimates)
+	}
+
+	// more task sets than the transport workers can carry
+	estimates, err = EstimateQueues(Layout{2, 2, 2, 2, 2, 2, 2, 2, 2}, FactoryDurations(), mix, 0.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(estimates[0].Wait, 1) || estimates[0].Utilization <= 1 {
+		t.Errorf("Estimate of the overloaded dispatch queue is %+v", estimates[0])
+	}
+}
+
+// Test that the estimates are compared with the measured values of a run
+func TestCompareQueues(t *testing.T) {
+	layout := Layout{2, 2, 2, 2, 2, 2, 2, 2, 2}
+	mix := OrderMix{{Route: []string{"pickup", "welding", "assembly", "painting", "dropoff"}, Share: 1}}
+	estimates, err := EstimateQueues(layout, FactoryDurations(), mix, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulation, err := Simulate(layout, mix, 0.1, 60, 5*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comparisons := CompareQueues(estimates, simulation)
+	t.Logf("\n%v", comparisons)
+
+	if len(comparisons) != len(estimates) {
+		t.Fatalf("Comparison has %d queues, want %d", len(comparisons), len(estimates))
+	}
+	for _, comparison := range comparisons {
+		// the servers are busy about as long as the model says, the transport
+		// workers a little longer as they also wait at the stations
+		if math.Abs(comparison.MeasuredUtilization-comparison.Utilization) > 0.25 {
+			t.Errorf("Measured utilization of the %s queue is %.2f, estimated %.2f", comparison.Queue, comparison.MeasuredUtilization, comparison.Utilization)
+		}
+		if comparison.MeasuredWait < 0 || comparison.MeasuredQueueLength < 0 {
+			t.Errorf("Measured values of the %s queue are %+v", comparison.Queue, comparison)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the recorder and the replay of dispatch decisions
+
+// Which facility and which workers come out of the free channels first
+// depends on the scheduling of the go routines, so two runs of the same
+// task sets take different paths through the factory.
+// The recorder logs every dispatch decision of the control center:
+//  - which pickup station and transportation worker a task set got (dispatch)
+//  - which facility and workers each assignment handler picked for a task
+// A decision is identified by the task set, the station type and the number
+// of assignments of the task set at that station type before, so retries
+// of a task are decisions of their own.
+// In replay mode the control center waits for exactly the recorded facility
+// and workers instead of taking the first free ones. Decisions that were not
+// recorded are made as usual.
+// Faults, quality checks and breakdowns are drawn at random and are not part
+// of the recording, a run using them is only reproduced if their rates are 0 or 1.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// station type of the decisions made when a task set is dispatched
+const dispatchStation = "dispatch"
+
+// one dispatch decision of the control center
+type Decision struct {
+	TaskSet  int
+	Station  string // station type of the assignment, "dispatch" for the transportation worker
+	Seq      int    // number of decisions for the task set at this station type before
+	Facility int    // id of the picked facility, -1 if none
+	Workers  []int  // ids of the picked workers
+	Time     int    // program time of the decision
+}
+
+type decisionKey struct {
+	taskset int
+	station string
+	seq     int
+}
+
+// decisions recorded and to be replayed by the control center
+type decisionLog struct {
+	mutex    sync.Mutex
+	recorded []Decision
+	counts   map[decisionKey]int // number of decisions per task set and station type, seq is 0
+	replay   map[decisionKey]Decision
+}
+
+// a decision in the making
+type decision struct {
+	log    *decisionLog
+	forced *Decision // recorded decision to replay, nil if free
+	made   Decision
+}
+
+// //////////////////// Recording //////////////////////
+
+// record all dispatch decisions of the factory
+// must be called before the factory is booted
+func (controlCenter *ControlCenter) RecordDecisions() {
+	if controlCenter.decisions == nil {
+		controlCenter.decisions = &decisionLog{counts: make(map[decisionKey]int)}
+	}
+}
+
+// force the recorded decisions on the factory, the replayed run is recorded again
+// must be called before the factory is booted
+func (controlCenter *ControlCenter) Replay(decisions []Decision) {
+	controlCenter.RecordDecisions()
+	controlCenter.decisions.replay = make(map[decisionKey]Decision)
+	for _, decision := range decisions {
+		controlCenter.decisions.replay[decisionKey{decision.TaskSet, decision.Station, decision.Seq}] = decision
+	}
+}
+
+// get the recorded decisions in the order they were made
+func (controlCenter *ControlCenter) Decisions() []Decision {
+	if controlCenter.decisions == nil {
+		return nil
+	}
+	controlCenter.decisions.mutex.Lock()
+	defer controlCenter.decisions.mutex.Unlock()
+	return append([]Decision(nil), controlCenter.decisions.recorded...)
+}
+
+// save decisions to a file
+func SaveDecisions(path string, decisions []Decision) error {
+	data, err := json.MarshalIndent(decisions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// load decisions from a file
+func LoadDecisions(path string) ([]Decision, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var decisions []Decision
+	if err := json.Unmarshal(data, &decisions); err != nil {
+		return nil, err
+	}
+	return decisions, nil
+}
+
+// //////////////////// Deciding //////////////////////
+
+// start the next decision for a task set at a station type
+func (controlCenter *ControlCenter) decide(taskset int, station string) *decision {
+	recorder := controlCenter.decisions
+	if recorder == nil {
+		return &decision{}
+	}
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	key := decisionKey{taskset, station, 0}
+	seq := recorder.counts[key]
+	recorder.counts[key]++
+	made := &decision{log: recorder, made: Decision{TaskSet: taskset, Station: station, Seq: seq, Facility: -1, Time: controlCenter.ProgramTime.GetCurrentTime()}}
+	if forced, recorded := recorder.replay[decisionKey{taskset, station, seq}]; recorded {
+		made.forced = &forced
+	}
+	return made
+}
+
+// pick a facility of the set
+// returns nil if abort is closed before the facility is free
+func (decision *decision) facility(facilitySet *FacilitySet, abort <-chan struct{}, avoid *Facility) *Facility {
+	var facility *Facility
+	if decision.forced != nil && decision.forced.Facility >= 0 && decision.forced.Facility < len(facilitySet.facilities) {
+		facility = facilitySet.acquireID(decision.forced.Facility, abort)
+	} else {
+		facility = facilitySet.acquire(abort, avoid)
+	}
+	if facility != nil {
+		decision.made.Facility = facility.id
+	}
+	return facility
+}
+
+// pick the next worker of the set
+// returns nil if abort is closed before the worker is free
+func (decision *decision) worker(workerSet *WorkerSet, abort <-chan struct{}) *Worker {
+	var worker *Worker
+	n := len(decision.made.Workers)
+	if decision.forced != nil && n < len(decision.forced.Workers) && decision.forced.Workers[n] < len(workerSet.workers) {
+		worker = workerSet.acquireID(decision.forced.Workers[n], abort)
+	} else {
+		worker = workerSet.acquire(abort)
+	}
+	if worker != nil {
+		decision.made.Workers = append(decision.made.Workers, worker.id)
+	}
+	return worker
+}
+
+// record the decision
+func (decision *decision) record() {
+	if decision.log == nil {
+		return
+	}
+	decision.log.mutex.Lock()
+	defer decision.log.mutex.Unlock()
+	decision.log.recorded = append(decision.log.recorded, decision.made)
+}
+
+// drop a decision that was interrupted before anything was picked for good,
+// the next decision for the task set at the station type takes its place
+func (decision *decision) drop() {
+	if decision.log == nil {
+		return
+	}
+	decision.log.mutex.Lock()
+	defer decision.log.mutex.Unlock()
+	decision.log.counts[decisionKey{decision.made.TaskSet, decision.made.Station, 0}]--
+}
+
+// get the facility with the given id once it is free
+// other free facilities are put back for the other handlers
+func (facilitySet *FacilitySet) acquireID(id int, abort <-chan struct{}) *Facility {
+	for {
+		facility := facilitySet.acquire(abort, nil)
+		if facility == nil || facility.id == id {
+			return facility
+		}
+		facilitySet.freeFacilities <- facility
+		select {
+		case <-time.After(time.Millisecond):
+		case <-abort:
+			return nil
+		}
+	}
+}
+
+// get the worker with the given id once it is free
+// other free workers are put back for the other handlers
+func (workerSet *WorkerSet) acquireID(id int, abort <-chan struct{}) *Worker {
+	for {
+		worker := workerSet.acquire(abort)
+		if worker == nil || worker.id == id {
+			return worker
+		}
+		workerSet.freeWorkers <- worker
+		select {
+		case <-time.After(time.Millisecond):
+		case <-abort:
+			return nil
+		}
+	}
+}
+
+// print a decision
+func (decision Decision) String() string {
+	return fmt.Sprintf("taskset %d %s #%d: facility %d, workers %v", decision.TaskSet, decision.Station, decision.Seq, decision.Facility, decision.Workers)
+}
@@ -0,0 +1,79 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for recording and replaying dispatch decisions
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// run three task sets on a factory with two stations and workers of each kind
+func runDecisions(t *testing.T, replay []Decision) []Decision {
+	programTime := StartProgramTime()
+
+	// Build the factory with specified number of facilities and workers
+	controlCenter := BuildFactory(2, 0, 2, 0, 2, 2, 4, 2, 2, programTime)
+	if replay != nil {
+		controlCenter.Replay(replay)
+	} else {
+		controlCenter.RecordDecisions()
+	}
+
+	// Boot the control center
+	go controlCenter.Boot()
+
+	for id := 1; id <= 3; id++ {
+		taskset := gen_task_set(&controlCenter, id, []string{"pickup", "welding", "dropoff"}, []string{"pickup steel bar", "weld steel bar", "dropoff steel bar"})
+		controlCenter.request <- &taskset
+	}
+
+	for programTime.GetCurrentTime() < 20 {
+		time.Sleep(1 * time.Second)
+		if controlCenter.State().CompletedTaskSets == 3 {
+			break
+		}
+	}
+	if controlCenter.State().CompletedTaskSets != 3 {
+		t.Fatalf("Total number of tasks done in Factory is %d, want 3", controlCenter.State().CompletedTaskSets)
+	}
+	return controlCenter.Decisions()
+}
+
+// Test that a replayed run makes the recorded decisions
+func TestReplayDecisions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.json")
+
+	recorded := runDecisions(t, nil)
+	// 3 dispatches and 3 assignments at welding and dropoff stations
+	if len(recorded) != 9 {
+		t.Fatalf("Recorded %d decisions, want 9", len(recorded))
+	}
+	if err := SaveDecisions(path, recorded); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDecisions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := runDecisions(t, loaded)
+
+	// compare the picked facilities and workers of every decision
+	picks := func(decisions []Decision) map[decisionKey]Decision {
+		picks := make(map[decisionKey]Decision)
+		for _, decision := range decisions {
+			decision.Time = 0
+			picks[decisionKey{decision.TaskSet, decision.Station, decision.Seq}] = decision
+		}
+		return picks
+	}
+	if want, got := picks(recorded), picks(replayed); !reflect.DeepEqual(want, got) {
+		t.Errorf("Replayed decisions %v, want %v", replayed, recorded)
+	}
+}
@@ -0,0 +1,154 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the retry handling of failed tasks
+
+// An attempt to carry out a task fails if
+//  - the station faults while processing it (see maintenance.go)
+//  - one of the workers breaks down on the way to the station
+//  - the quality check of the station rejects the result
+//  - the watchdog aborts it because it got stuck (see watchdog.go)
+// The transportation worker retries a failed task according to the retry
+// policy of the facility type. A task set whose task exhausted all its
+// attempts is moved to the dead-letter queue of the control center, where
+// it can be inspected and resubmitted.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// retry policy of a facility type, all times are in program time
+// the zero value retries immediately and without limit
+type RetryPolicy struct {
+	MaxAttempts      int  // attempts of a task before its task set fails, 0 means unlimited
+	Backoff          int  // time to wait before the first retry
+	BackoffFactor    int  // the backoff is multiplied by this factor for every further retry, 0 keeps it constant
+	DifferentStation bool // retry on another station of the same type if the set has more than one
+}
+
+// time to wait before retrying after the given number of failed attempts
+func (policy RetryPolicy) backoff(attempt int) int {
+	backoff := policy.Backoff
+	for i := 1; i < attempt && policy.BackoffFactor > 1; i++ {
+		backoff *= policy.BackoffFactor
+	}
+	return backoff
+}
+
+// a task set that exhausted the retries of one of its tasks
+type DeadLetter struct {
+	TaskSet *TaskSet
+	Reason  string
+	Time    int // program time the task set failed
+}
+
+// dead-letter queue of the control center
+type deadLetterQueue struct {
+	mutex   sync.Mutex
+	letters []DeadLetter
+}
+
+// //////////////////// Configuration //////////////////////
+
+// set the retry policy for the tasks of a facility type
+// must be called before the factory is booted
+func (facilitySet *FacilitySet) SetRetryPolicy(policy RetryPolicy) {
+	facilitySet.retryPolicy = policy
+}
+
+// set the probability that the quality check of the stations rejects a task
+// must not be called while tasks of the facility type are processed
+func (facilitySet *FacilitySet) SetQualityCheck(rejectRate float64) {
+	facilitySet.rejectRate = rejectRate
+}
+
+// set the probability that a worker breaks down on the way to a facility
+// and the program time it takes to repair it
+// must be called before the factory is booted
+func (workerSet *WorkerSet) SetBreakdowns(rate float64, repairTime int) {
+	workerSet.breakdownRate = rate
+	workerSet.breakdownRepair = repairTime
+}
+
+// //////////////////// Failures //////////////////////
+
+// check if the quality check of the facility rejects the task
+func (facility *Facility) rejected(task *Task) bool {
+	rejectRate := task.FacilityType.rejectRate
+	if rejectRate == 0 || rand.Float64() >= rejectRate {
+		return false
+	}
+	task.cancel(fmt.Sprintf("task %s rejected by quality check at %s station %d", task.description, facility.facilityType, facility.id))
+	facility.events.println("[", task.tasksetID, "]", "🔍: task", task.description, "rejected by quality check at", facility.facilityType, "station", facility.id)
+	return true
+}
+
+// check if the worker breaks down on the way to the facility
+// a broken worker aborts the task and is repaired before it can go on
+func (worker *Worker) brokeDown(facility *Facility, task *Task) bool {
+	workerSet := worker.specialization
+	if workerSet.breakdownRate == 0 || rand.Float64() >= workerSet.breakdownRate {
+		return false
+	}
+	task.cancel(fmt.Sprintf("%s worker %d broke down on the way to %s station %d", workerSet.specialization, worker.id, facility.facilityType, facility.id))
+	worker.specialization.events.println("[", task.tasksetID, "]", "🪫:", workerSet.specialization, "worker", worker.id, "broke down on the way to", facility.facilityType, "station", facility.id)
+	workerSet.state.worker(worker, statusRepair, task.tasksetID)
+	workerSet.programTime.Wait(workerSet.breakdownRepair)
+	return true
+}
+
+// //////////////////// Dead-letter queue //////////////////////
+
+// move a failed task set to the dead-letter queue
+func (controlCenter *ControlCenter) deadLetter(taskset *TaskSet) {
+	controlCenter.deadLetters.mutex.Lock()
+	defer controlCenter.deadLetters.mutex.Unlock()
+	controlCenter.deadLetters.letters = append(controlCenter.deadLetters.letters, DeadLetter{taskset, taskset.failure, controlCenter.ProgramTime.GetCurrentTime()})
+	controlCenter.events.println("[", taskset.id, "]", "📭: taskset", taskset.id, "moved to dead-letter queue")
+}
+
+// get the task sets in the dead-letter queue, oldest first
+func (controlCenter *ControlCenter) DeadLetters() []DeadLetter {
+	controlCenter.deadLetters.mutex.Lock()
+	defer controlCenter.deadLetters.mutex.Unlock()
+	return append([]DeadLetter(nil), controlCenter.deadLetters.letters...)
+}
+
+// remove a task set from the dead-letter queue and submit it again
+// the whole task set is carried out again, starting with its pickup
+// depending on the intake policy, blocks while the intake queue is full or
+// returns ErrIntakeFull
+func (controlCenter *ControlCenter) Resubmit(id int) error {
+	controlCenter.deadLetters.mutex.Lock()
+	var taskset *TaskSet
+	for i, letter := range controlCenter.deadLetters.letters {
+		if letter.TaskSet.id == id {
+			taskset = letter.TaskSet
+			controlCenter.deadLetters.letters = append(controlCenter.deadLetters.letters[:i], controlCenter.deadLetters.letters[i+1:]...)
+			break
+		}
+	}
+	controlCenter.deadLetters.mutex.Unlock()
+	if taskset == nil {
+		return fmt.Errorf("taskset %d is not in the dead-letter queue", id)
+	}
+	resubmitted := TaskSet{id: taskset.id, tasks: make([]*Task, len(taskset.tasks))}
+	for i, task := range taskset.tasks {
+		resubmitted.tasks[i] = task.clone()
+		// the kit of a completed assembly is consumed already, the assembly
+		// is carried out again without waiting for another kit
+		if task.completed {
+			resubmitted.tasks[i].kit = ""
+		}
+	}
+	resubmitted.priority = taskset.priority
+	resubmitted.booked = taskset.booked
+	controlCenter.events.println("[", taskset.id, "]", "📬: taskset", taskset.id, "resubmitted")
+	_, err := controlCenter.Submit(&resubmitted)
+	return err
+}
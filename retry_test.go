@@ -0,0 +1,131 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for retries and the dead-letter queue
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that a task set exhausting its retries is dead-lettered and can be resubmitted
+func TestDeadLetterAndResubmit(t *testing.T) {
+	programTime := StartProgramTime()
+
+	N := 1 // N robots of each kind
+	W := 0 // W facilities on welding stations
+	P := 1 // P facilities on painting stations
+	A := 0 // A facilities on assembly stations
+	I := 1 // I facilities on pick-up stations
+	D := 1 // D facilities on drop-off stations
+
+	// Build the factory with specified number of facilities and workers
+	controlCenter := BuildFactory(I, A, W, P, D, N, N, N, N, programTime)
+
+	// every painting is rejected, give up after two attempts
+	controlCenter.PaintingStations.SetQualityCheck(1)
+	controlCenter.PaintingStations.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, Backoff: 1})
+
+	// Boot the control center
+	go controlCenter.Boot()
+
+	// Create a task set for painting station
+	paintingTask := gen_task_set(&controlCenter, 1, []string{"pickup", "painting", "dropoff"}, []string{"pickup component", "paint component", "dropoff component"})
+	controlCenter.request <- &paintingTask
+
+	for programTime.GetCurrentTime() < 20 {
+		time.Sleep(1 * time.Second)
+		if controlCenter.State().FailedTaskSets == 1 {
+			time.Sleep(2 * time.Second)
+			break
+		}
+	}
+
+	// Check that the task set is in the dead-letter queue
+	deadLetters := controlCenter.DeadLetters()
+	if len(deadLetters) != 1 {
+		t.Fatalf("Dead-letter queue contains %d task sets, want 1", len(deadLetters))
+	}
+	if !strings.Contains(deadLetters[0].Reason, "rejected by quality check") || !strings.Contains(deadLetters[0].Reason, "2 attempts") {
+		t.Errorf("Unexpected reason %q", deadLetters[0].Reason)
+	}
+
+	// Resubmit the task set once the quality problem is fixed
+	controlCenter.PaintingStations.SetQualityCheck(0)
+	if err := controlCenter.Resubmit(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := controlCenter.Resubmit(1); err == nil {
+		t.Errorf("Task set 1 was resubmitted twice")
+	}
+
+	for programTime.GetCurrentTime() < 40 {
+		time.Sleep(1 * time.Second)
+		if controlCenter.State().CompletedTaskSets == 1 {
+			break
+		}
+	}
+
+	// Check if the resubmitted task set is complete
+	if controlCenter.State().CompletedTaskSets != 1 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.State().CompletedTaskSets)
+	}
+	if len(controlCenter.DeadLetters()) != 0 {
+		t.Errorf("Dead-letter queue is not empty after resubmission")
+	}
+}
+
+// Test that a failed task is retried on another station if the policy asks for it
+func TestRetryOnDifferentStation(t *testing.T) {
+	programTime := StartProgramTime()
+
+	N := 1 // N robots of each kind
+	W := 0 // W facilities on welding stations
+	P := 2 // P facilities on painting stations
+	A := 0 // A facilities on assembly stations
+	I := 1 // I facilities on pick-up stations
+	D := 1 // D facilities on drop-off stations
+
+	// Build the factory with specified number of facilities and workers
+	controlCenter := BuildFactory(I, A, W, P, D, N, N, N, N, programTime)
+
+	// painting station 0 always faults but is repaired immediately
+	controlCenter.PaintingStations.facilities[0].SetMaintenance(MaintenancePlan{FaultRate: 1})
+	controlCenter.PaintingStations.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, DifferentStation: true})
+
+	// Boot the control center
+	go controlCenter.Boot()
+
+	// Create a task set for painting station
+	paintingTask := gen_task_set(&controlCenter, 1, []string{"pickup", "painting", "dropoff"}, []string{"pickup component", "paint component", "dropoff component"})
+	controlCenter.request <- &paintingTask
+
+	for programTime.GetCurrentTime() < 15 {
+		time.Sleep(1 * time.Second)
+		if controlCenter.State().CompletedTaskSets+controlCenter.State().FailedTaskSets == 1 {
+			break
+		}
+	}
+
+	// Check if the painting task is complete
+	if controlCenter.State().CompletedTaskSets != 1 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.State().CompletedTaskSets)
+	}
+}
+
+// Test the exponential backoff of a retry policy
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{Backoff: 2, BackoffFactor: 3}
+	for attempt, want := range []int{2, 6, 18} {
+		if got := policy.backoff(attempt + 1); got != want {
+			t.Errorf("Backoff after attempt %d is %d, want %d", attempt+1, got, want)
+		}
+	}
+	if got := (RetryPolicy{Backoff: 2}).backoff(3); got != 2 {
+		t.Errorf("Constant backoff is %d, want 2", got)
+	}
+}
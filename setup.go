@@ -0,0 +1,195 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the setup times of the stations
+
+// A station of a facility type with a setup policy is set up for one value
+// of a task attribute at a time, e. g. a painting station for one colour.
+// A task that needs another setup waits for the changeover before it is
+// processed, the time of a changeover depends on the setup before and the
+// one after it and comes from the changeover matrix of the policy, or its
+// default time if the matrix has no entry. A station starts without any
+// setup, the first setup takes the time of the changeover from "" if the
+// matrix has one and no time otherwise. A task without the attribute keeps
+// the current setup.
+// With grouping, the control center prefers a free station that is already
+// set up for a task, then one without any setup, over the one it got first,
+// so the tasks of a setup are grouped on the same stations and fewer
+// changeovers are needed. Replayed
+// dispatch decisions (see replay.go) keep their stations.
+// A changeover counts as processing for the watchdog (see watchdog.go), an
+// aborted changeover leaves the station in its old setup.
+
+package main
+
+import (
+	"strings"
+)
+
+// setup policy of a facility type, all times are in program time
+// the zero value never changes over
+// a station changes over every time its setup changes, the setup time
+// includes the first setup
+type SetupPolicy struct {
+	Attribute   string       // task attribute the setup depends on, e. g. colour, empty disables setups
+	Changeovers []Changeover // changeover matrix
+	Default     int          // time of a changeover that is not in the matrix
+	Group       bool         // prefer free stations already set up for a task
+}
+
+// time to change the setup of a station
+type Changeover struct {
+	From string
+	To   string
+	Time int
+}
+
+// //////////////////// Configuration //////////////////////
+
+// set the setup policy of a facility type
+// must be called before the factory is booted
+func (facilitySet *FacilitySet) SetSetupPolicy(policy SetupPolicy) {
+	facilitySet.setupPolicy = policy
+}
+
+// time to change the setup of a station from one value to another
+func (policy SetupPolicy) changeover(from, to string) int {
+	for _, changeover := range policy.Changeovers {
+		if changeover.From == from && changeover.To == to {
+			return changeover.Time
+		}
+	}
+	if from == "" || from == to {
+		return 0
+	}
+	return policy.Default
+}
+
+// //////////////////// Setups //////////////////////
+
+// value of an attribute of the task, empty if the task does not have it
+// tasks without typed attributes (see attributes.go) derive the colour from
+// their description, e. g. paint steel bar in blue
+func (task *Task) attribute(name string) string {
+	if value := task.attributes.value(name); value != "" {
+		return value
+	}
+	if task.attributes.typed() != nil {
+		return ""
+	}
+	switch name {
+	case AttributeColour:
+		if i := strings.LastIndex(task.description, " in "); i >= 0 {
+			return task.description[i+len(" in "):]
+		}
+	}
+	return ""
+}
+
+// setup the task needs at a station of its type, empty if any setup will do
+func (task *Task) setup() string {
+	if task.FacilityType.setupPolicy.Attribute == "" {
+		return ""
+	}
+	return task.attribute(task.FacilityType.setupPolicy.Attribute)
+}
+
+// current setup of the facility
+func (facility *Facility) currentSetup() string {
+	facility.statusMutex.Lock()
+	defer facility.statusMutex.Unlock()
+	return facility.setup
+}
+
+// change the setup of the facility for the task
+// returns false if the task is aborted during the changeover
+func (facility *Facility) changeOver(task *Task) bool {
+	to := task.setup()
+	from := facility.currentSetup()
+	if to == "" || to == from {
+		return true
+	}
+	duration := task.FacilityType.setupPolicy.changeover(from, to)
+	if duration > 0 {
+		// print facility Y changes over from A to B
+		facility.events.println("[", task.tasksetID, "]", "🔄:", facility.facilityType, "station", facility.id, "changes over from", from, "to", to, "in", duration, "time units")
+		select {
+		case <-facility.programTime.After(duration):
+		case <-task.aborted():
+			return false
+		}
+	}
+	facility.statusMutex.Lock()
+	facility.setup = to
+	if from != "" {
+		facility.changeovers++
+	}
+	facility.setupTime += duration
+	changeovers, setupTime := facility.changeovers, facility.setupTime
+	facility.statusMutex.Unlock()
+	facility.state.setup(facility, to, changeovers, setupTime)
+	return true
+}
+
+// //////////////////// Grouping //////////////////////
+
+// pick a facility for the task, with grouping a free facility that is
+// already set up for the task or without any setup is preferred over the
+// first free one
+// returns nil if abort is closed before a facility is free
+func (decision *decision) facilityFor(task *Task, abort <-chan struct{}) *Facility {
+	facility := decision.facility(task.FacilityType, abort, task.avoid)
+	if facility == nil || decision.forced != nil || !task.FacilityType.setupPolicy.Group {
+		return facility
+	}
+	if grouped := task.FacilityType.setUpFor(task, facility); grouped != facility {
+		decision.made.Facility = grouped.id
+		facility = grouped
+	}
+	return facility
+}
+
+// swap the facility for a free one of the set that is set up for the task,
+// or one without any setup, the facilities that are not taken are free again
+func (facilitySet *FacilitySet) setUpFor(task *Task, facility *Facility) *Facility {
+	setup := task.setup()
+	if setup == "" || facility.currentSetup() == setup {
+		return facility
+	}
+	var others []*Facility
+take:
+	for {
+		select {
+		case other := <-facilitySet.freeFacilities:
+			others = append(others, other)
+		default:
+			break take
+		}
+	}
+	// rank of a facility, lower is better
+	rank := func(candidate *Facility) int {
+		switch candidate.currentSetup() {
+		case setup:
+			return 0
+		case "":
+			return 1
+		}
+		return 2
+	}
+	chosen := facility
+	for _, other := range others {
+		if other != task.avoid && !other.maintenanceDue() && rank(other) < rank(chosen) {
+			chosen = other
+		}
+	}
+	for _, other := range append(others, facility) {
+		if other != chosen {
+			facilitySet.freeFacilities <- other
+		}
+	}
+	if chosen != facility {
+		chosen.events.println("[", task.tasksetID, "]", "🔄:", facilitySet.facilityType, "station", chosen.id, "is taken instead of station", facility.id, "to save a changeover")
+	}
+	return chosen
+}
@@ -0,0 +1,111 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the setup times of the stations
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// orders of one sign each in the given colours
+func colourOrders(colours ...string) []Order {
+	orders := make([]Order, len(colours))
+	for i, colour := range colours {
+		orders[i] = Order{Product: "sign", Parameters: map[string]string{"colour": colour}}
+	}
+	return orders
+}
+
+// status of the painting stations
+func paintingStatus(controlCenter *ControlCenter) []FacilityStatus {
+	var stations []FacilityStatus
+	for _, status := range controlCenter.State().Facilities {
+		if status.Type == "painting" {
+			stations = append(stations, status)
+		}
+	}
+	return stations
+}
+
+// Test that a painting station changes over between colours
+func TestChangeover(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	// a single transport worker carries the signs one after the other
+	controlCenter := BuildFactory(1, 0, 0, 1, 1, 0, 0, 1, 1, programTime)
+	controlCenter.PaintingStations.SetSetupPolicy(SetupPolicy{Attribute: "colour", Default: 10, Changeovers: []Changeover{{From: "red", To: "blue", Time: 20}}})
+	go controlCenter.Boot()
+
+	results := paintOrder(t, &controlCenter, colourOrders("blue", "red", "red", "blue"))
+
+	// blue to red takes the default time, red to blue the time of the matrix
+	station := paintingStatus(&controlCenter)[0]
+	if station.Setup != "blue" || station.Changeovers != 2 || station.SetupTime != 30 {
+		t.Errorf("Painting station is %+v, want 2 changeovers in 30 time units", station)
+	}
+	// the changeover is part of the painting, give or take a few time units
+	painted := func(i int) int { return results[i].Tasks[1].Finished - results[i].Tasks[1].Started }
+	if painted(1) < painted(2)+8 || painted(3) < painted(2)+18 {
+		t.Errorf("Painting took %d, %d and %d time units with and without a changeover", painted(1), painted(2), painted(3))
+	}
+}
+
+// Test that grouping the tasks by setup saves changeovers
+func TestGroupSetups(t *testing.T) {
+	changeovers := make(map[bool]int)
+	for _, group := range []bool{false, true} {
+		programTime := StartSimulatedTime(0, 5*time.Millisecond)
+		controlCenter := BuildFactory(1, 0, 0, 2, 1, 0, 0, 2, 1, programTime)
+		controlCenter.PaintingStations.SetSetupPolicy(SetupPolicy{Attribute: "colour", Default: 2, Group: group})
+		go controlCenter.Boot()
+
+		paintOrder(t, &controlCenter, colourOrders("blue", "blue", "red", "red", "blue", "blue", "red", "red"))
+		for _, station := range paintingStatus(&controlCenter) {
+			changeovers[group] += station.Changeovers
+		}
+	}
+	// one station keeps blue, the other one red
+	if changeovers[true] != 0 || changeovers[false] == 0 {
+		t.Errorf("Painting stations changed over %d times with and %d times without grouping", changeovers[true], changeovers[false])
+	}
+}
+
+// Test that grouping the tasks by setup passes over stations due for maintenance
+func TestGroupSetupsMaintenance(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 0, 0, 2, 1, 0, 0, 2, 2, programTime)
+	controlCenter.PaintingStations.SetSetupPolicy(SetupPolicy{Attribute: "colour", Default: 2, Group: true})
+	controlCenter.PaintingStations.SetMaintenance(MaintenancePlan{EveryTasks: 1, Duration: 2})
+	go controlCenter.Boot()
+	defer controlCenter.Shutdown()
+
+	paintOrder(t, &controlCenter, colourOrders("blue", "red", "blue", "red", "blue", "red"))
+	// every painting is followed by a maintenance window
+	maintenances := 0
+	for _, station := range paintingStatus(&controlCenter) {
+		maintenances += station.Maintenances
+	}
+	if maintenances != 6 {
+		t.Errorf("Painting stations were maintained %d times, want 6", maintenances)
+	}
+}
+
+// Test that tasks without the attribute keep the setup
+func TestSetupAttribute(t *testing.T) {
+	programTime := StartProgramTime()
+	controlCenter := BuildFactory(1, 1, 1, 1, 1, 1, 2, 1, 1, programTime)
+	controlCenter.PaintingStations.SetSetupPolicy(SetupPolicy{Attribute: "colour"})
+	taskset := gen_task_set(&controlCenter, 1, []string{"welding", "painting", "painting"}, []string{"weld steel bar", "paint steel bar in blue", "paint steel bar"})
+	for i, want := range []string{"", "blue", ""} {
+		if got := taskset.tasks[i].setup(); got != want {
+			t.Errorf("Task %q needs the setup %q, want %q", taskset.tasks[i].description, got, want)
+		}
+	}
+	policy := SetupPolicy{Default: 4, Changeovers: []Changeover{{From: "", To: "blue", Time: 1}}}
+	if policy.changeover("", "red") != 0 || policy.changeover("", "blue") != 1 || policy.changeover("red", "blue") != 4 || policy.changeover("red", "red") != 0 {
+		t.Errorf("Changeover times of %+v are wrong", policy)
+	}
+}
@@ -0,0 +1,408 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the finished goods of the dropoff stations and their shipping
+
+// A task set expanded from an order of the catalogue (see catalogue.go)
+// leaves one unit of its product at the dropoff station of its last
+// dropoff, the unit belongs to the customer order if the order has an id.
+// Every dropoff station keeps its finished goods until a shipment collects
+// them. The shipping policy of the dropoff stations limits the units of a
+// product a station holds, a dropoff of a product whose limit is reached
+// waits at the station until a shipment makes room or the watchdog aborts
+// it (see watchdog.go). Shipments collect the goods on a schedule in
+// program time, the oldest units first, either of one station or of all
+// dropoff stations, and either of one product or of all of them.
+// The control center books the unit of a task set for its order, if the
+// order has an id, once the intake queue takes the task set. A task set the
+// intake queue rejects is not booked, a resubmitted one is not booked again.
+// The fulfilment of an order is
+//  - open: not all of its units are finished yet
+//  - finished: all of its units are finished, some are still in stock
+//  - shipped: all of its units are shipped
+// A failed task set leaves its order open until it is resubmitted (see
+// retry.go). Task sets that are not expanded from an order leave no goods.
+
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// fulfilment of a customer order
+const (
+	OrderOpen     = "open"
+	OrderFinished = "finished"
+	OrderShipped  = "shipped"
+)
+
+// shipping policy of a facility type, all times are in program time
+type ShippingPolicy struct {
+	Capacity  map[string]int // units of a product a station holds at most, unlimited if missing or 0
+	Shipments []Shipment     // collection schedule
+}
+
+// scheduled shipment of finished goods
+type Shipment struct {
+	Station  int    // id of the dropoff station, -1 for all of them
+	Product  string // id of the product, empty for all of them
+	Quantity int    // units collected per station at most, 0 collects all
+	Start    int    // program time of the first shipment
+	Every    int    // program time between shipments, 0 ships only once
+}
+
+// product and customer order of the unit a task drops off
+type Goods struct {
+	Product string `json:"product"`
+	Order   string `json:"order,omitempty"`
+}
+
+// one unit of finished goods at a dropoff station
+type FinishedUnit struct {
+	Station int
+	Product string
+	Order   string `json:",omitempty"`
+	TaskSet int
+	Time    int // program time the unit was dropped off
+}
+
+// finished goods of a station, as they are kept in snapshots
+type FinishedGoods struct {
+	Units    []FinishedUnit // units in stock, the oldest first
+	Received map[string]int // units dropped off so far by product
+	Shipped  map[string]int // units shipped so far by product
+	Orders   map[string]int // units shipped so far by order
+}
+
+// finished goods of a product at a station
+type GoodsLevel struct {
+	Station  int
+	Product  string
+	Quantity int // units in stock
+	Capacity int // units the station holds at most, 0 if unlimited
+	Received int // units dropped off so far
+	Shipped  int // units shipped so far
+}
+
+// fulfilment of a customer order
+type OrderStatus struct {
+	Order    string
+	Ordered  int // units booked when the intake queue took their task sets
+	Finished int // units dropped off, shipped or not
+	Shipped  int
+	Status   string // OrderOpen, OrderFinished or OrderShipped
+}
+
+// finished goods of a dropoff station
+type warehouse struct {
+	mutex   sync.Mutex
+	goods   FinishedGoods
+	shipped chan struct{} // closed and replaced on every shipment
+}
+
+func newWarehouse() *warehouse {
+	return &warehouse{goods: FinishedGoods{Received: make(map[string]int), Shipped: make(map[string]int), Orders: make(map[string]int)}, shipped: make(chan struct{})}
+}
+
+// units booked for the customer orders
+type orderBook struct {
+	mutex   sync.Mutex
+	ordered map[string]int
+}
+
+func newOrderBook() *orderBook {
+	return &orderBook{ordered: make(map[string]int)}
+}
+
+// //////////////////// Configuration //////////////////////
+
+// set the shipping policy of a facility type
+// must be called before the factory is booted
+func (facilitySet *FacilitySet) SetShippingPolicy(policy ShippingPolicy) {
+	facilitySet.shippingPolicy = policy
+}
+
+// book units of a customer order, orders without an id are not booked
+func (book *orderBook) book(order string, units int) {
+	if order == "" {
+		return
+	}
+	book.mutex.Lock()
+	defer book.mutex.Unlock()
+	book.ordered[order] += units
+}
+
+// book the unit a received task set leaves for its customer order
+func (controlCenter *ControlCenter) bookUnit(taskset *TaskSet) {
+	if taskset.booked {
+		return
+	}
+	taskset.booked = true
+	for _, task := range taskset.tasks {
+		if task.goods != nil {
+			controlCenter.orders.book(task.goods.Order, 1)
+		}
+	}
+}
+
+// units booked so far by order, nil if none
+func (book *orderBook) booked() map[string]int {
+	book.mutex.Lock()
+	defer book.mutex.Unlock()
+	if len(book.ordered) == 0 {
+		return nil
+	}
+	ordered := make(map[string]int, len(book.ordered))
+	for order, units := range book.ordered {
+		ordered[order] = units
+	}
+	return ordered
+}
+
+// //////////////////// Dropoffs //////////////////////
+
+// wait until the station has room for the unit of the task
+// returns false if the task is aborted meanwhile
+func (facility *Facility) makeRoom(task *Task) bool {
+	if facility.warehouse == nil || task.goods == nil {
+		return true
+	}
+	capacity := task.FacilityType.shippingPolicy.Capacity[task.goods.Product]
+	if capacity <= 0 {
+		return true
+	}
+	for full := false; ; full = true {
+		facility.warehouse.mutex.Lock()
+		room := facility.warehouse.inStock(task.goods.Product) < capacity
+		shipped := facility.warehouse.shipped
+		facility.warehouse.mutex.Unlock()
+		if room {
+			return true
+		}
+		if !full {
+			facility.events.println("[", task.tasksetID, "]", "📦:", facility.facilityType, "station", facility.id, "is full of", task.goods.Product, ", the dropoff waits for a shipment")
+		}
+		select {
+		case <-shipped:
+		case <-task.aborted():
+			return false
+		}
+	}
+}
+
+// keep the unit of the task at the station
+func (facility *Facility) store(task *Task) {
+	if facility.warehouse == nil || task.goods == nil {
+		return
+	}
+	unit := FinishedUnit{Station: facility.id, Product: task.goods.Product, Order: task.goods.Order, TaskSet: task.tasksetID, Time: facility.programTime.GetCurrentTime()}
+	facility.warehouse.mutex.Lock()
+	defer facility.warehouse.mutex.Unlock()
+	facility.warehouse.goods.Units = append(facility.warehouse.goods.Units, unit)
+	facility.warehouse.goods.Received[unit.Product]++
+}
+
+// units of a product in stock, the warehouse must be locked
+func (warehouse *warehouse) inStock(product string) int {
+	n := 0
+	for _, unit := range warehouse.goods.Units {
+		if unit.Product == product {
+			n++
+		}
+	}
+	return n
+}
+
+// //////////////////// Shipments //////////////////////
+
+// ship the finished goods of the stations of the facility set on their schedule
+func (controlCenter *ControlCenter) RunShipments(facilitySet *FacilitySet) {
+	shipments := facilitySet.shippingPolicy.Shipments
+	if len(shipments) == 0 {
+		return
+	}
+	// the shipments due since the last check, starting with those due now
+	checked := controlCenter.ProgramTime.GetCurrentTime() - 1
+	for {
+		now := controlCenter.ProgramTime.GetCurrentTime()
+		pending := false
+		for _, shipment := range shipments {
+			for due := scheduled(shipment.Start, shipment.Every, now) - scheduled(shipment.Start, shipment.Every, checked); due > 0; due-- {
+				facilitySet.ship(shipment)
+			}
+			pending = pending || !over(shipment.Start, shipment.Every, now)
+		}
+		// all shipments that only ship once are shipped
+		if !pending {
+			return
+		}
+		checked = now
+		if !controlCenter.ProgramTime.WaitRunning(1) {
+			return
+		}
+	}
+}
+
+// collect the goods of a shipment from its stations, the oldest units first
+func (facilitySet *FacilitySet) ship(shipment Shipment) {
+	for _, facility := range facilitySet.facilities {
+		if shipment.Station >= 0 && facility.id != shipment.Station {
+			continue
+		}
+		if facility.warehouse == nil {
+			continue
+		}
+		warehouse := facility.warehouse
+		warehouse.mutex.Lock()
+		var kept []FinishedUnit
+		shipped := 0
+		for _, unit := range warehouse.goods.Units {
+			if (shipment.Product != "" && unit.Product != shipment.Product) || (shipment.Quantity > 0 && shipped == shipment.Quantity) {
+				kept = append(kept, unit)
+				continue
+			}
+			shipped++
+			warehouse.goods.Shipped[unit.Product]++
+			if unit.Order != "" {
+				warehouse.goods.Orders[unit.Order]++
+			}
+		}
+		warehouse.goods.Units = kept
+		if shipped > 0 {
+			close(warehouse.shipped)
+			warehouse.shipped = make(chan struct{})
+		}
+		warehouse.mutex.Unlock()
+		if shipped > 0 {
+			facility.events.println("📦:", shipped, "units shipped from", facility.facilityType, "station", facility.id)
+		}
+	}
+}
+
+// //////////////////// Reporting //////////////////////
+
+// copy of the finished goods of the station, nil if it keeps none
+func (facility *Facility) finishedGoods() *FinishedGoods {
+	if facility.warehouse == nil {
+		return nil
+	}
+	facility.warehouse.mutex.Lock()
+	defer facility.warehouse.mutex.Unlock()
+	goods := FinishedGoods{Units: append([]FinishedUnit(nil), facility.warehouse.goods.Units...), Received: make(map[string]int), Shipped: make(map[string]int), Orders: make(map[string]int)}
+	for product, n := range facility.warehouse.goods.Received {
+		goods.Received[product] = n
+	}
+	for product, n := range facility.warehouse.goods.Shipped {
+		goods.Shipped[product] = n
+	}
+	for order, n := range facility.warehouse.goods.Orders {
+		goods.Orders[order] = n
+	}
+	return &goods
+}
+
+// restore the finished goods of the station from a snapshot
+func (facility *Facility) restoreGoods(goods *FinishedGoods) {
+	facility.warehouse = newWarehouse()
+	facility.warehouse.goods.Units = append([]FinishedUnit(nil), goods.Units...)
+	for product, n := range goods.Received {
+		facility.warehouse.goods.Received[product] = n
+	}
+	for product, n := range goods.Shipped {
+		facility.warehouse.goods.Shipped[product] = n
+	}
+	for order, n := range goods.Orders {
+		facility.warehouse.goods.Orders[order] = n
+	}
+}
+
+// get the units in stock at the dropoff stations by station, the oldest first
+func (controlCenter *ControlCenter) FinishedUnits() []FinishedUnit {
+	var units []FinishedUnit
+	for _, facility := range controlCenter.DropoffStations.facilities {
+		if goods := facility.finishedGoods(); goods != nil {
+			units = append(units, goods.Units...)
+		}
+	}
+	return units
+}
+
+// get the finished goods of the dropoff stations by station and product
+func (controlCenter *ControlCenter) FinishedGoods() []GoodsLevel {
+	var levels []GoodsLevel
+	for _, facility := range controlCenter.DropoffStations.facilities {
+		goods := facility.finishedGoods()
+		if goods == nil {
+			continue
+		}
+		byProduct := make(map[string]*GoodsLevel)
+		level := func(product string) *GoodsLevel {
+			if byProduct[product] == nil {
+				byProduct[product] = &GoodsLevel{Station: facility.id, Product: product, Capacity: controlCenter.DropoffStations.shippingPolicy.Capacity[product]}
+			}
+			return byProduct[product]
+		}
+		for product, n := range goods.Received {
+			level(product).Received = n
+		}
+		for product, n := range goods.Shipped {
+			level(product).Shipped = n
+		}
+		for _, unit := range goods.Units {
+			level(unit.Product).Quantity++
+		}
+		for _, level := range byProduct {
+			levels = append(levels, *level)
+		}
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		a, b := levels[i], levels[j]
+		return a.Station < b.Station || a.Station == b.Station && a.Product < b.Product
+	})
+	return levels
+}
+
+// get the fulfilment of the customer orders by their id
+func (controlCenter *ControlCenter) Fulfilment() []OrderStatus {
+	orders := make(map[string]*OrderStatus)
+	status := func(order string) *OrderStatus {
+		if orders[order] == nil {
+			orders[order] = &OrderStatus{Order: order}
+		}
+		return orders[order]
+	}
+	for order, n := range controlCenter.orders.booked() {
+		status(order).Ordered = n
+	}
+	for _, facility := range controlCenter.DropoffStations.facilities {
+		goods := facility.finishedGoods()
+		if goods == nil {
+			continue
+		}
+		for order, n := range goods.Orders {
+			status(order).Shipped += n
+			status(order).Finished += n
+		}
+		for _, unit := range goods.Units {
+			if unit.Order != "" {
+				status(unit.Order).Finished++
+			}
+		}
+	}
+	var fulfilment []OrderStatus
+	for _, order := range orders {
+		switch {
+		case order.Finished < order.Ordered:
+			order.Status = OrderOpen
+		case order.Shipped < order.Finished:
+			order.Status = OrderFinished
+		default:
+			order.Status = OrderShipped
+		}
+		fulfilment = append(fulfilment, *order)
+	}
+	sort.Slice(fulfilment, func(i, j int) bool { return fulfilment[i].Order < fulfilment[j].Order })
+	return fulfilment
+}
@@ -0,0 +1,98 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the finished goods and their shipping
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that the dropoff stations keep the finished goods of the orders
+func TestFinishedGoods(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 0, 0, 0, 1, 0, 0, 0, 2, programTime)
+	go controlCenter.Boot()
+
+	plateOrder(t, &controlCenter, Order{ID: "A", Quantity: 2}, Order{ID: "B"}, Order{})
+	// an order that is expanded but never submitted is not booked
+	if _, err := plates.Expand(&controlCenter, Order{ID: "C", Product: "plate"}, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	units := controlCenter.FinishedUnits()
+	orders := make(map[string]int)
+	for _, unit := range units {
+		orders[unit.Order]++
+	}
+	if len(units) != 4 || orders["A"] != 2 || orders["B"] != 1 || orders[""] != 1 {
+		t.Errorf("Finished units are %+v", units)
+	}
+	want := GoodsLevel{Station: 0, Product: "plate", Quantity: 4, Received: 4}
+	if levels := controlCenter.FinishedGoods(); len(levels) != 1 || levels[0] != want {
+		t.Errorf("Finished goods are %+v, want %+v", levels, want)
+	}
+	fulfilment := controlCenter.Fulfilment()
+	wantOrders := []OrderStatus{{"A", 2, 2, 0, OrderFinished}, {"B", 1, 1, 0, OrderFinished}}
+	if len(fulfilment) != len(wantOrders) {
+		t.Fatalf("Fulfilment is %+v, want %+v", fulfilment, wantOrders)
+	}
+	for i := range wantOrders {
+		if fulfilment[i] != wantOrders[i] {
+			t.Errorf("Order %s is %+v, want %+v", wantOrders[i].Order, fulfilment[i], wantOrders[i])
+		}
+	}
+
+	// an order that is submitted but not finished stays open, a task set the
+	// intake queue rejects is not booked
+	waiting := BuildFactory(1, 0, 0, 0, 1, 0, 0, 0, 1, programTime)
+	waiting.SetIntake(1, IntakeReject)
+	tasksets, err := plates.Expand(&waiting, Order{ID: "D", Product: "plate", Quantity: 2}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waiting.Submit(&tasksets[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waiting.Submit(&tasksets[1]); err == nil {
+		t.Fatalf("Full intake queue took taskset %d", tasksets[1].id)
+	}
+	if fulfilment := waiting.Fulfilment(); len(fulfilment) != 1 || fulfilment[0] != (OrderStatus{"D", 1, 0, 0, OrderOpen}) {
+		t.Errorf("Fulfilment of the waiting order is %+v", fulfilment)
+	}
+}
+
+// Test that a full dropoff station waits for the next shipment
+func TestShipmentCapacity(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 0, 0, 0, 1, 0, 0, 0, 2, programTime)
+	controlCenter.DropoffStations.SetShippingPolicy(ShippingPolicy{Capacity: map[string]int{"plate": 1}, Shipments: []Shipment{{Station: -1, Start: 40, Every: 40}}})
+	go controlCenter.Boot()
+
+	results := plateOrder(t, &controlCenter, Order{ID: "A", Quantity: 2})
+	latest := 0
+	for _, result := range results {
+		if result.Status != taskSetCompleted {
+			t.Fatalf("Taskset %d finished with %+v", result.ID, result)
+		}
+		latest = max(latest, result.Tasks[1].Finished)
+	}
+	// the second plate is dropped off after the first one is shipped
+	if latest < 40 {
+		t.Errorf("Both plates were dropped off by %d, before the shipment", latest)
+	}
+	want := OrderStatus{"A", 2, 2, 1, OrderFinished}
+	if fulfilment := controlCenter.Fulfilment(); len(fulfilment) != 1 || fulfilment[0] != want {
+		t.Errorf("Fulfilment is %+v, want %+v", fulfilment, want)
+	}
+
+	// the next shipment collects the second plate
+	controlCenter.ProgramTime.Wait(85 - controlCenter.ProgramTime.GetCurrentTime())
+	want = OrderStatus{"A", 2, 2, 2, OrderShipped}
+	if fulfilment := controlCenter.Fulfilment(); len(fulfilment) != 1 || fulfilment[0] != want {
+		t.Errorf("Fulfilment is %+v, want %+v", fulfilment, want)
+	}
+}
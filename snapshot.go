@@ -0,0 +1,521 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains pausing, snapshots and restoring of the factory
+
+// Pausing the factory brings it to a consistent state:
+//  - the control center stops dispatching requests, the received ones
+//    wait in the intake queue
+//  - every transportation worker finishes its current task and waits at
+//    the facility of that task before requesting the next one
+//  - all other workers finish their tasks and return to the control center
+// The state of the paused factory (facilities, workers, task sets, counters,
+// program time and configuration) can be taken as a snapshot, saved to a
+// file and restored into any number of new factories, e. g. to continue
+// the run or to fork it into several what-if experiments.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// pause state of the factory, shared by the request handler,
+// the transportation workers and the control center
+type pauseGate struct {
+	mutex         sync.Mutex
+	paused        bool
+	pause         chan struct{}              // closed while the factory is paused
+	resume        chan struct{}              // closed when the factory resumes
+	inFlight      int                        // loads carried by transportation workers
+	handlerParked bool                       // request handler waits for the factory to resume
+	parked        map[*Worker]*transportLoad // waiting transportation workers and their loads
+}
+
+func newPauseGate() *pauseGate {
+	return &pauseGate{pause: make(chan struct{}), resume: make(chan struct{}), parked: make(map[*Worker]*transportLoad)}
+}
+
+// snapshot of the whole factory
+type FactorySnapshot struct {
+	Time              int
+	Tick              time.Duration // real duration of one unit of program time
+	Layout            Layout
+	Timeouts          Timeouts
+	FacilitySets      []FacilitySetSnapshot
+	Facilities        []FacilitySnapshot
+	WorkerSets        []WorkerSetSnapshot
+	Workers           []WorkerSnapshot
+	TaskSets          []TaskSetSnapshot // task sets carried by transportation workers
+	Pending           []TaskSetSnapshot // task sets in the intake queue, in the order they are dispatched
+	IntakeCapacity    int
+	IntakePolicy      IntakePolicy
+	DeadLetters       []TaskSetSnapshot
+	CompletedTaskSets int
+	FailedTaskSets    int
+	RetriedTasks      int
+	Orders            map[string]int `json:",omitempty"` // units booked by customer order
+	Traceability      []TraceRecord  `json:",omitempty"`
+	Kitting           []KitPart      `json:",omitempty"` // parts waiting in the kitting area
+	Assemblies        []Assembly     `json:",omitempty"`
+	Transport         TransportPolicy
+	Trips             TransportMetrics
+	Battery           BatteryPolicy
+}
+
+// configuration of a facility type
+type FacilitySetSnapshot struct {
+	Type        string
+	RetryPolicy RetryPolicy
+	RejectRate  float64
+	BatchPolicy BatchPolicy
+	SetupPolicy SetupPolicy
+	Inventory   *InventoryPolicy `json:",omitempty"`
+	Shipping    ShippingPolicy
+}
+
+// state of one facility
+type FacilitySnapshot struct {
+	Type            string
+	ID              int
+	Free            bool
+	AvailableAt     int // program time a facility in maintenance or repair is free again
+	Maintenance     MaintenancePlan
+	NextMaintenance int
+	TasksDone       int
+	Maintenances    int
+	Faults          int
+	Setup           string         `json:",omitempty"`
+	Changeovers     int            `json:",omitempty"`
+	SetupTime       int            `json:",omitempty"`
+	Stock           []StockLevel   `json:",omitempty"`
+	Goods           *FinishedGoods `json:",omitempty"`
+}
+
+// configuration of a worker specialization
+type WorkerSetSnapshot struct {
+	Specialization  string
+	BreakdownRate   float64
+	BreakdownRepair int
+}
+
+// location and assignment of one worker
+type WorkerSnapshot struct {
+	Specialization string
+	ID             int
+	Station        string `json:",omitempty"` // type of the facility the worker waits at, empty at the control center
+	StationID      int    `json:",omitempty"`
+	TaskSet        int    // id of the carried task set, 0 if none
+	Battery        int    `json:",omitempty"` // energy left in the battery
+}
+
+// progress of one task set
+type TaskSetSnapshot struct {
+	ID          int
+	Steps       []JournalStep
+	Transporter int    // id of the transportation worker carrying it, -1 if none
+	Priority    int    `json:",omitempty"`
+	Failure     string `json:",omitempty"`
+	Time        int    `json:",omitempty"` // program time a dead letter failed
+}
+
+// //////////////////// Pause gate //////////////////////
+
+// channel that is closed while the factory is paused
+func (gate *pauseGate) pausing() <-chan struct{} {
+	gate.mutex.Lock()
+	defer gate.mutex.Unlock()
+	return gate.pause
+}
+
+// a transportation worker starts to carry a load
+func (gate *pauseGate) enter() {
+	gate.mutex.Lock()
+	defer gate.mutex.Unlock()
+	gate.inFlight++
+}
+
+// a transportation worker is back at the control center
+func (gate *pauseGate) leave() {
+	gate.mutex.Lock()
+	defer gate.mutex.Unlock()
+	gate.inFlight--
+}
+
+// request handler waits while the factory is paused
+func (gate *pauseGate) parkHandler() {
+	gate.mutex.Lock()
+	if !gate.paused {
+		gate.mutex.Unlock()
+		return
+	}
+	gate.handlerParked = true
+	resume := gate.resume
+	gate.mutex.Unlock()
+	<-resume
+	gate.mutex.Lock()
+	gate.handlerParked = false
+	gate.mutex.Unlock()
+}
+
+// transportation worker waits in between two stops while the factory is paused
+func (gate *pauseGate) parkTransporter(transportWorker *Worker, load *transportLoad) {
+	gate.mutex.Lock()
+	if !gate.paused {
+		gate.mutex.Unlock()
+		return
+	}
+	gate.parked[transportWorker] = load
+	resume := gate.resume
+	gate.mutex.Unlock()
+	<-resume
+	gate.mutex.Lock()
+	delete(gate.parked, transportWorker)
+	gate.mutex.Unlock()
+}
+
+// //////////////////// Pause and resume //////////////////////
+
+// pause the factory and wait until it reached a consistent state
+func (controlCenter *ControlCenter) Pause() {
+	gate := controlCenter.gate
+	gate.mutex.Lock()
+	if gate.paused {
+		gate.mutex.Unlock()
+		return
+	}
+	gate.paused = true
+	close(gate.pause)
+	gate.mutex.Unlock()
+	controlCenter.events.println("⏸️ : pausing factory")
+	for !controlCenter.quiescent() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	controlCenter.events.println("⏸️ : factory paused at", controlCenter.ProgramTime.GetCurrentTime())
+}
+
+// check if the paused factory reached a consistent state
+func (controlCenter *ControlCenter) quiescent() bool {
+	gate := controlCenter.gate
+	gate.mutex.Lock()
+	defer gate.mutex.Unlock()
+	if !gate.handlerParked || len(gate.parked) != gate.inFlight {
+		return false
+	}
+	workers := len(controlCenter.AssemblyWorkers.workers) + len(controlCenter.WeldingWorkers.workers) + len(controlCenter.PaintingWorkers.workers)
+	return controlCenter.State().FreeWorkers("assembly", "welding", "painting") == workers
+}
+
+// resume the paused factory
+func (controlCenter *ControlCenter) Resume() {
+	gate := controlCenter.gate
+	gate.mutex.Lock()
+	defer gate.mutex.Unlock()
+	if !gate.paused {
+		return
+	}
+	gate.paused = false
+	close(gate.resume)
+	gate.pause = make(chan struct{})
+	gate.resume = make(chan struct{})
+	controlCenter.events.println("▶️ : factory resumed")
+}
+
+// //////////////////// Snapshot //////////////////////
+
+// take a snapshot of the paused factory
+func (controlCenter *ControlCenter) Snapshot() (*FactorySnapshot, error) {
+	gate := controlCenter.gate
+	gate.mutex.Lock()
+	defer gate.mutex.Unlock()
+	if !gate.paused {
+		return nil, fmt.Errorf("factory must be paused for a snapshot")
+	}
+	state := controlCenter.State()
+	snapshot := FactorySnapshot{
+		Time:              state.Time,
+		Tick:              controlCenter.ProgramTime.Tick(),
+		Layout:            controlCenter.Layout(),
+		Timeouts:          controlCenter.Timeouts,
+		CompletedTaskSets: state.CompletedTaskSets,
+		FailedTaskSets:    state.FailedTaskSets,
+		RetriedTasks:      state.RetriedTasks,
+		Orders:            controlCenter.orders.booked(),
+		Traceability:      controlCenter.TraceRecords(),
+		Kitting:           controlCenter.KittingArea(),
+		Assemblies:        controlCenter.Assemblies(),
+		Transport:         controlCenter.transportPolicy,
+		Trips:             state.Transport,
+		Battery:           controlCenter.power.policy,
+	}
+	// facilities
+	for _, facilitySet := range []*FacilitySet{controlCenter.PickupStations, controlCenter.AssemblyStations, controlCenter.WeldingStations, controlCenter.PaintingStations, controlCenter.DropoffStations} {
+		snapshot.FacilitySets = append(snapshot.FacilitySets, FacilitySetSnapshot{facilitySet.facilityType, facilitySet.retryPolicy, facilitySet.rejectRate, facilitySet.batchPolicy(), facilitySet.setupPolicy, facilitySet.inventoryPolicy, facilitySet.shippingPolicy})
+		free := facilitySet.takeFree()
+		for _, facility := range facilitySet.facilities {
+			facility.statusMutex.Lock()
+			snapshot.Facilities = append(snapshot.Facilities, FacilitySnapshot{
+				Type:            facility.facilityType,
+				ID:              facility.id,
+				Free:            free[facility],
+				AvailableAt:     facility.availableAt,
+				Maintenance:     facility.maintenance,
+				NextMaintenance: facility.nextMaintenance,
+				TasksDone:       facility.tasksDone,
+				Maintenances:    facility.maintenances,
+				Faults:          facility.faults,
+				Setup:           facility.setup,
+				Changeovers:     facility.changeovers,
+				SetupTime:       facility.setupTime,
+				Stock:           facility.stock(),
+				Goods:           facility.finishedGoods(),
+			})
+			facility.statusMutex.Unlock()
+		}
+		for facility := range free {
+			facilitySet.freeFacilities <- facility
+		}
+	}
+	// workers, only transportation workers may be away from the control center
+	for _, workerSet := range []*WorkerSet{controlCenter.AssemblyWorkers, controlCenter.WeldingWorkers, controlCenter.PaintingWorkers, controlCenter.TransportWorkers} {
+		snapshot.WorkerSets = append(snapshot.WorkerSets, WorkerSetSnapshot{workerSet.specialization, workerSet.breakdownRate, workerSet.breakdownRepair})
+		for _, worker := range workerSet.workers {
+			state := WorkerSnapshot{Specialization: workerSet.specialization, ID: worker.id, Battery: worker.level()}
+			if load, carrying := gate.parked[worker]; carrying {
+				if last := load.at; last != nil {
+					state.Station, state.StationID = last.facilityType, last.id
+				}
+				for _, taskset := range load.unfinished() {
+					if state.TaskSet == 0 {
+						state.TaskSet = taskset.id
+					}
+					snapshot.TaskSets = append(snapshot.TaskSets, TaskSetSnapshot{ID: taskset.id, Steps: taskset.steps(), Transporter: worker.id, Priority: taskset.priority})
+				}
+			}
+			snapshot.Workers = append(snapshot.Workers, state)
+		}
+	}
+	// requests and dead letters
+	intake := controlCenter.intake
+	intake.mutex.Lock()
+	snapshot.IntakeCapacity, snapshot.IntakePolicy = intake.capacity, intake.policy
+	for _, taskset := range intake.contents() {
+		snapshot.Pending = append(snapshot.Pending, TaskSetSnapshot{ID: taskset.id, Steps: taskset.steps(), Transporter: -1, Priority: taskset.priority})
+	}
+	intake.mutex.Unlock()
+	for _, letter := range controlCenter.DeadLetters() {
+		snapshot.DeadLetters = append(snapshot.DeadLetters, TaskSetSnapshot{ID: letter.TaskSet.id, Steps: letter.TaskSet.steps(), Transporter: -1, Priority: letter.TaskSet.priority, Failure: letter.Reason, Time: letter.Time})
+	}
+	return &snapshot, nil
+}
+
+// take all free facilities out of the set
+func (facilitySet *FacilitySet) takeFree() map[*Facility]bool {
+	free := make(map[*Facility]bool)
+	for {
+		select {
+		case facility := <-facilitySet.freeFacilities:
+			free[facility] = true
+		default:
+			return free
+		}
+	}
+}
+
+// save the snapshot to a file
+func (snapshot *FactorySnapshot) Save(path string) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// load a snapshot from a file
+func LoadSnapshot(path string) (*FactorySnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot FactorySnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// //////////////////// Restore //////////////////////
+
+// a task set of a snapshot and the transportation worker carrying it
+type restoredTaskSet struct {
+	transportWorker *Worker
+	taskset         *TaskSet
+}
+
+// build a new factory in the state of the snapshot
+// the program time continues at the time and with the tick of the snapshot,
+// the task sets continue once the factory is booted
+// the layout of the snapshot may be enlarged before to fork a what-if experiment
+func RestoreFactory(snapshot *FactorySnapshot) (ControlCenter, error) {
+	controlCenter := snapshot.Layout.Build(StartSimulatedTime(snapshot.Time, snapshot.Tick))
+	controlCenter.Timeouts = snapshot.Timeouts
+	controlCenter.state.setCounters(snapshot.CompletedTaskSets, snapshot.FailedTaskSets, snapshot.RetriedTasks)
+	controlCenter.state.setTransport(snapshot.Trips)
+	controlCenter.transportPolicy = snapshot.Transport
+	if snapshot.Battery.Capacity > 0 {
+		controlCenter.SetBatteryPolicy(snapshot.Battery)
+	}
+	for order, units := range snapshot.Orders {
+		controlCenter.orders.book(order, units)
+	}
+	controlCenter.trace.records = append([]TraceRecord(nil), snapshot.Traceability...)
+	controlCenter.kitting.parts = append([]KitPart(nil), snapshot.Kitting...)
+	controlCenter.kitting.assemblies = append([]Assembly(nil), snapshot.Assemblies...)
+	// facilities
+	for _, state := range snapshot.FacilitySets {
+		facilitySet := controlCenter.facilitySet(state.Type)
+		if facilitySet == nil {
+			return controlCenter, fmt.Errorf("snapshot: unknown station %q", state.Type)
+		}
+		facilitySet.retryPolicy = state.RetryPolicy
+		facilitySet.rejectRate = state.RejectRate
+		facilitySet.SetBatchPolicy(state.BatchPolicy)
+		facilitySet.setupPolicy = state.SetupPolicy
+		if state.Inventory != nil {
+			facilitySet.SetInventory(*state.Inventory)
+		}
+		facilitySet.shippingPolicy = state.Shipping
+	}
+	for _, state := range snapshot.Facilities {
+		facilitySet := controlCenter.facilitySet(state.Type)
+		if facilitySet == nil || state.ID >= len(facilitySet.facilities) {
+			return controlCenter, fmt.Errorf("snapshot: unknown %s station %d", state.Type, state.ID)
+		}
+		facility := facilitySet.facilities[state.ID]
+		facility.maintenance = state.Maintenance
+		facility.nextMaintenance = state.NextMaintenance
+		facility.tasksDone = state.TasksDone
+		facility.maintenances = state.Maintenances
+		facility.faults = state.Faults
+		controlCenter.state.serviced(facility, state.TasksDone, state.Maintenances, state.Faults)
+		facility.setup, facility.changeovers, facility.setupTime = state.Setup, state.Changeovers, state.SetupTime
+		controlCenter.state.setup(facility, state.Setup, state.Changeovers, state.SetupTime)
+		if state.Stock != nil {
+			facility.restock(state.Stock)
+		}
+		if state.Goods != nil {
+			facility.restoreGoods(state.Goods)
+		}
+		if !state.Free {
+			facility.availableAt = state.AvailableAt
+		}
+	}
+	// workers and the task sets they carry
+	for _, state := range snapshot.WorkerSets {
+		workerSet := controlCenter.workerSet(state.Specialization)
+		if workerSet == nil {
+			return controlCenter, fmt.Errorf("snapshot: unknown worker specialization %q", state.Specialization)
+		}
+		workerSet.breakdownRate = state.BreakdownRate
+		workerSet.breakdownRepair = state.BreakdownRepair
+	}
+	// battery levels, workers added to the layout start with a full battery
+	for _, state := range snapshot.Workers {
+		workerSet := controlCenter.workerSet(state.Specialization)
+		if snapshot.Battery.Capacity == 0 || workerSet == nil || state.ID >= len(workerSet.workers) {
+			continue
+		}
+		workerSet.workers[state.ID].battery.level = state.Battery
+		controlCenter.state.battery(state.Specialization, workerSet.workers[state.ID], state.Battery)
+	}
+	for _, state := range snapshot.TaskSets {
+		if state.Transporter < 0 || state.Transporter >= len(controlCenter.TransportWorkers.workers) {
+			return controlCenter, fmt.Errorf("snapshot: taskset %d carried by unknown transport worker %d", state.ID, state.Transporter)
+		}
+		taskset, err := controlCenter.rebuildTaskSet(state.ID, state.Steps)
+		if err != nil {
+			return controlCenter, fmt.Errorf("snapshot: %v", err)
+		}
+		taskset.priority = state.Priority
+		transportWorker := controlCenter.TransportWorkers.workers[state.Transporter]
+		for _, task := range taskset.tasks {
+			task.Transporter = transportWorker
+		}
+		controlCenter.restored = append(controlCenter.restored, restoredTaskSet{transportWorker, taskset})
+		controlCenter.notifier.open(taskset.id, false)
+	}
+	// the transportation workers wait at the facility of the last completed task
+	for _, state := range snapshot.Workers {
+		if state.TaskSet == 0 || state.Station == "" {
+			continue
+		}
+		facilitySet := controlCenter.facilitySet(state.Station)
+		if facilitySet == nil || state.StationID >= len(facilitySet.facilities) {
+			return controlCenter, fmt.Errorf("snapshot: transport worker %d waits at unknown %s station %d", state.ID, state.Station, state.StationID)
+		}
+		for _, restored := range controlCenter.restored {
+			if restored.transportWorker.id == state.ID && restored.taskset.id == state.TaskSet {
+				restored.taskset.tasks[restored.taskset.resumeAt()-1].Facility = facilitySet.facilities[state.StationID]
+			}
+		}
+	}
+	// requests and dead letters
+	controlCenter.SetIntake(snapshot.IntakeCapacity, snapshot.IntakePolicy)
+	for _, state := range snapshot.Pending {
+		taskset, err := controlCenter.rebuildTaskSet(state.ID, state.Steps)
+		if err != nil {
+			return controlCenter, fmt.Errorf("snapshot: %v", err)
+		}
+		taskset.priority = state.Priority
+		taskset.submitted, taskset.queued = snapshot.Time, time.Now()
+		controlCenter.intake.waiting = append(controlCenter.intake.waiting, taskset)
+		controlCenter.state.received(taskset)
+		controlCenter.notifier.open(taskset.id, false)
+	}
+	for _, state := range snapshot.DeadLetters {
+		taskset, err := controlCenter.rebuildTaskSet(state.ID, state.Steps)
+		if err != nil {
+			return controlCenter, fmt.Errorf("snapshot: %v", err)
+		}
+		taskset.failure = state.Failure
+		taskset.priority = state.Priority
+		// the unit is booked in the orders of the snapshot
+		taskset.booked = true
+		controlCenter.deadLetters.letters = append(controlCenter.deadLetters.letters, DeadLetter{taskset, state.Failure, state.Time})
+	}
+	return controlCenter, nil
+}
+
+// check if the transportation worker carries a task set of a restored snapshot
+func (controlCenter *ControlCenter) carriesRestored(transportWorker *Worker) bool {
+	for _, restored := range controlCenter.restored {
+		if restored.transportWorker == transportWorker {
+			return true
+		}
+	}
+	return false
+}
+
+// hand the task sets of a restored snapshot back to their transportation
+// workers, those of the same worker as one load
+func (controlCenter *ControlCenter) resumeRestored() {
+	loads := make(map[*Worker]*TaskSet)
+	var workers []*Worker
+	for _, restored := range controlCenter.restored {
+		if load, loaded := loads[restored.transportWorker]; loaded {
+			load.load = append(load.load, *restored.taskset)
+			continue
+		}
+		loads[restored.transportWorker] = restored.taskset
+		workers = append(workers, restored.transportWorker)
+	}
+	for _, worker := range workers {
+		controlCenter.gate.enter()
+		worker.inbox <- *loads[worker]
+	}
+}
@@ -0,0 +1,98 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for pausing, snapshots and restore
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test that a paused factory can be saved, resumed and forked from its snapshot
+func TestSnapshotRestore(t *testing.T) {
+	programTime := StartProgramTime()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	// Build the factory with 1 pickup, 1 welding and 1 dropoff station
+	controlCenter := BuildFactory(1, 0, 1, 0, 1, 2, 2, 2, 2, programTime)
+
+	// Boot the control center
+	go controlCenter.Boot()
+
+	tasksetA := gen_task_set(&controlCenter, 1, []string{"pickup", "welding", "dropoff"}, []string{"pickup steel bar", "weld steel bar", "dropoff steel bar"})
+	tasksetB := gen_task_set(&controlCenter, 2, []string{"pickup", "welding", "dropoff"}, []string{"pickup steel wool", "weld steel wool", "dropoff steel wool"})
+	controlCenter.request <- &tasksetA
+	controlCenter.request <- &tasksetB
+	time.Sleep(3 * time.Second)
+
+	// Pause the factory and save its snapshot
+	controlCenter.Pause()
+	snapshot, err := controlCenter.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshot.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unfinished := len(loaded.TaskSets) + len(loaded.Pending); unfinished+loaded.CompletedTaskSets != 2 {
+		t.Errorf("Snapshot contains %d unfinished and %d completed task sets, want 2 in total", unfinished, loaded.CompletedTaskSets)
+	}
+	controlCenter.Resume()
+
+	// Fork the factory twice from the snapshot
+	var forks []ControlCenter
+	for i := 0; i < 2; i++ {
+		fork, err := RestoreFactory(loaded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forks = append(forks, fork)
+	}
+
+	// Check that the carried task sets continue at the station of the snapshot
+	for _, state := range loaded.Workers {
+		for _, restored := range forks[0].restored {
+			if state.TaskSet == 0 || restored.taskset.id != state.TaskSet {
+				continue
+			}
+			last := restored.taskset.tasks[restored.taskset.resumeAt()-1].Facility
+			if last == nil || last.facilityType != state.Station || last.id != state.StationID {
+				t.Errorf("Taskset %d is restored away from %s station %d", state.TaskSet, state.Station, state.StationID)
+			}
+		}
+	}
+	for i := range forks {
+		go forks[i].Boot()
+	}
+
+	for programTime.GetCurrentTime() < 20 {
+		time.Sleep(1 * time.Second)
+		if controlCenter.State().CompletedTaskSets == 2 && forks[0].State().CompletedTaskSets == 2 && forks[1].State().CompletedTaskSets == 2 {
+			break
+		}
+	}
+
+	// Check that the original factory and both forks completed all task sets
+	if controlCenter.State().CompletedTaskSets != 2 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 2", controlCenter.State().CompletedTaskSets)
+	}
+	for i := range forks {
+		if forks[i].State().CompletedTaskSets != 2 {
+			t.Errorf("Total number of tasks done in fork %d is %d, want 2", i, forks[i].State().CompletedTaskSets)
+		}
+		if forks[i].ProgramTime.GetCurrentTime() < loaded.Time {
+			t.Errorf("Program time of fork %d went back before the snapshot", i)
+		}
+		if forks[i].ProgramTime.Tick() != programTime.Tick() {
+			t.Errorf("Program time of fork %d ticks every %v, want %v", i, forks[i].ProgramTime.Tick(), programTime.Tick())
+		}
+	}
+}
@@ -0,0 +1,447 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the state store of the factory
+
+// The go routines of the factory report every change of state to the
+// store instead of keeping it in fields others read without synchronization:
+//  - the counters of completed and failed task sets and retried tasks
+//    (dropped task sets are not counted)
+//  - the status of every task set and the task it is at
+//  - the status of every facility and worker and the task set it works for
+//  - the maintenance and fault counters of every facility (see maintenance.go)
+//  - the contention of the request handler and the assignment handlers
+//  - the trips of the transportation workers (see transport.go)
+//  - the battery levels of the workers and their charging (see battery.go)
+// State returns a consistent copy of the whole store, all changes before
+// the call are contained in it and no change after it.
+
+package main
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// status of a task set
+const (
+	taskSetWaiting   = "waiting"   // received by the control center, not dispatched yet
+	taskSetRunning   = "running"   // carried by a transportation worker
+	taskSetCompleted = "completed" // all tasks completed
+	taskSetFailed    = "failed"    // moved to the dead-letter queue
+	taskSetDropped   = "dropped"   // dropped from the full intake queue
+)
+
+// status of a facility or worker
+const (
+	statusFree        = "free"
+	statusBusy        = "busy"        // assigned to a task
+	statusMaintenance = "maintenance" // facility in a maintenance window
+	statusRepair      = "repair"      // facility repaired after a fault, worker after a breakdown
+	statusCharging    = "charging"    // worker charging its battery or on its way to do so, charging station in use
+)
+
+// consistent copy of the state of the factory
+type FactoryState struct {
+	Time              int
+	CompletedTaskSets int
+	FailedTaskSets    int
+	RetriedTasks      int
+	TaskSets          []TaskSetStatus  // in the order they were received
+	Facilities        []FacilityStatus // by type and id
+	Workers           []WorkerStatus   // by specialization and id
+	Handlers          []HandlerStatus  // by station type, the request handler is "dispatch"
+	Transport         TransportMetrics
+	Batteries         BatteryMetrics
+}
+
+// status of one task set
+type TaskSetStatus struct {
+	ID          int
+	Status      string
+	Task        int    // index of the current task
+	Station     string // station type of the current task
+	Transporter int    // id of the transportation worker carrying it, -1 if none
+	Failure     string
+}
+
+// status of one facility
+type FacilityStatus struct {
+	Type        string
+	ID          int
+	Status      string
+	TaskSet     int    // task set of the current task, 0 if none
+	Setup       string // current setup, see setup.go
+	Changeovers int
+	SetupTime   int
+	// counters of the maintenance windows and faults, see maintenance.go
+	TasksDone    int // tasks processed since the last maintenance window, a batch counts once
+	Maintenances int
+	Faults       int
+}
+
+// status of one worker
+type WorkerStatus struct {
+	Specialization string
+	ID             int
+	Status         string
+	TaskSet        int // task set of the current task, 0 if none
+	Battery        int // energy left in the battery, see battery.go
+}
+
+// contention of one handler of the control center, all durations are in real time
+// a handler serves one request at a time, so requests wait while it is busy
+// in the decentralised dispatch mode the transportation workers serve their
+// requests themselves and only wait for the claim of the workers
+type HandlerStatus struct {
+	Station string
+	Handled int           // number of requests served
+	Busy    time.Duration // time spent serving requests, including waiting for free facilities and workers
+	Waited  time.Duration // time requests waited for the handler to take them
+}
+
+// state store shared by the control center, the facilities and the workers
+type stateStore struct {
+	mutex      sync.Mutex
+	completed  int
+	failed     int
+	retried    int
+	tasksets   map[int]*TaskSetStatus
+	order      []int
+	facilities map[*Facility]*FacilityStatus
+	workers    map[*Worker]*WorkerStatus
+	handlers   map[string]*HandlerStatus
+	transport  TransportMetrics
+	batteries  BatteryMetrics
+}
+
+func newStateStore() *stateStore {
+	return &stateStore{tasksets: make(map[int]*TaskSetStatus), facilities: make(map[*Facility]*FacilityStatus), workers: make(map[*Worker]*WorkerStatus), handlers: make(map[string]*HandlerStatus)}
+}
+
+// //////////////////// Queries //////////////////////
+
+// get a consistent copy of the state of the factory
+func (controlCenter *ControlCenter) State() FactoryState {
+	store := controlCenter.state
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	state := FactoryState{
+		Time:              controlCenter.ProgramTime.GetCurrentTime(),
+		CompletedTaskSets: store.completed,
+		FailedTaskSets:    store.failed,
+		RetriedTasks:      store.retried,
+		Transport:         store.transport,
+		Batteries:         store.batteries,
+	}
+	for _, id := range store.order {
+		state.TaskSets = append(state.TaskSets, *store.tasksets[id])
+	}
+	for _, status := range store.facilities {
+		state.Facilities = append(state.Facilities, *status)
+	}
+	sort.Slice(state.Facilities, func(i, j int) bool {
+		a, b := state.Facilities[i], state.Facilities[j]
+		return a.Type < b.Type || a.Type == b.Type && a.ID < b.ID
+	})
+	for _, status := range store.workers {
+		state.Workers = append(state.Workers, *status)
+	}
+	sort.Slice(state.Workers, func(i, j int) bool {
+		a, b := state.Workers[i], state.Workers[j]
+		return a.Specialization < b.Specialization || a.Specialization == b.Specialization && a.ID < b.ID
+	})
+	for _, status := range store.handlers {
+		state.Handlers = append(state.Handlers, *status)
+	}
+	sort.Slice(state.Handlers, func(i, j int) bool { return state.Handlers[i].Station < state.Handlers[j].Station })
+	return state
+}
+
+// get the status of a task set, false if it was never received
+func (state FactoryState) TaskSet(id int) (TaskSetStatus, bool) {
+	for _, status := range state.TaskSets {
+		if status.ID == id {
+			return status, true
+		}
+	}
+	return TaskSetStatus{}, false
+}
+
+// number of free workers, of the given specializations or of all
+func (state FactoryState) FreeWorkers(specializations ...string) int {
+	free := 0
+	for _, status := range state.Workers {
+		if status.Status == statusFree && (len(specializations) == 0 || slices.Contains(specializations, status.Specialization)) {
+			free++
+		}
+	}
+	return free
+}
+
+// get the status of a facility, false if the factory has no such facility
+func (state FactoryState) Facility(facilityType string, id int) (FacilityStatus, bool) {
+	for _, status := range state.Facilities {
+		if status.Type == facilityType && status.ID == id {
+			return status, true
+		}
+	}
+	return FacilityStatus{}, false
+}
+
+// number of free facilities, of the given types or of all
+func (state FactoryState) FreeFacilities(types ...string) int {
+	free := 0
+	for _, status := range state.Facilities {
+		if status.Status == statusFree && (len(types) == 0 || slices.Contains(types, status.Type)) {
+			free++
+		}
+	}
+	return free
+}
+
+// //////////////////// Counters //////////////////////
+
+// set the counters, e. g. after a recovery or restore
+// must be called before the factory is booted
+func (store *stateStore) setCounters(completed, failed, retried int) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.completed, store.failed, store.retried = completed, failed, retried
+}
+
+// count a retried task
+func (store *stateStore) retriedTask() {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.retried++
+}
+
+// //////////////////// Task sets //////////////////////
+
+// a task set was received by the control center
+func (store *stateStore) received(taskset *TaskSet) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	status, known := store.tasksets[taskset.id]
+	if !known {
+		status = &TaskSetStatus{ID: taskset.id}
+		store.tasksets[taskset.id] = status
+		store.order = append(store.order, taskset.id)
+	}
+	*status = TaskSetStatus{ID: taskset.id, Status: taskSetWaiting, Task: taskset.resumeAt(), Transporter: -1}
+	if status.Task < len(taskset.tasks) {
+		status.Station = taskset.tasks[status.Task].FacilityType.facilityType
+	}
+}
+
+// a task set is at the given task
+func (store *stateStore) atTask(taskset *TaskSet, i int, transportWorker *Worker) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	status := store.taskset(taskset)
+	status.Status = taskSetRunning
+	status.Task = i
+	status.Station = taskset.tasks[i].FacilityType.facilityType
+	status.Transporter = transportWorker.id
+}
+
+// a task set was completed or failed
+func (store *stateStore) finished(taskset *TaskSet) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	status := store.taskset(taskset)
+	status.Transporter = -1
+	if taskset.failure != "" {
+		status.Status = taskSetFailed
+		status.Failure = taskset.failure
+		store.failed++
+		return
+	}
+	status.Status = taskSetCompleted
+	status.Task = len(taskset.tasks)
+	status.Station = ""
+	store.completed++
+}
+
+// a task set was dropped from the intake queue
+func (store *stateStore) dropped(taskset *TaskSet) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.taskset(taskset).Status = taskSetDropped
+}
+
+// status of a task set, task sets restored from a snapshot were never received
+func (store *stateStore) taskset(taskset *TaskSet) *TaskSetStatus {
+	status, known := store.tasksets[taskset.id]
+	if !known {
+		status = &TaskSetStatus{ID: taskset.id, Transporter: -1}
+		store.tasksets[taskset.id] = status
+		store.order = append(store.order, taskset.id)
+	}
+	return status
+}
+
+// //////////////////// Facilities and workers //////////////////////
+
+// set the status of a facility
+func (store *stateStore) facility(facility *Facility, status string, taskset int) {
+	if store == nil {
+		return
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	updated := store.facilityStatus(facility)
+	updated.Status, updated.TaskSet = status, taskset
+}
+
+// status of a facility, a free one if it is not known yet
+// the caller must hold the mutex of the store
+func (store *stateStore) facilityStatus(facility *Facility) *FacilityStatus {
+	status, known := store.facilities[facility]
+	if !known {
+		status = &FacilityStatus{Type: facility.facilityType, ID: facility.id, Status: statusFree}
+		store.facilities[facility] = status
+	}
+	return status
+}
+
+// set the setup of a facility and its changeovers so far
+func (store *stateStore) setup(facility *Facility, setup string, changeovers, setupTime int) {
+	if store == nil {
+		return
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	status := store.facilityStatus(facility)
+	status.Setup, status.Changeovers, status.SetupTime = setup, changeovers, setupTime
+}
+
+// set the maintenance and fault counters of a facility
+func (store *stateStore) serviced(facility *Facility, tasksDone, maintenances, faults int) {
+	if store == nil {
+		return
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	status := store.facilityStatus(facility)
+	status.TasksDone, status.Maintenances, status.Faults = tasksDone, maintenances, faults
+}
+
+// set the status of a worker
+func (store *stateStore) worker(worker *Worker, status string, taskset int) {
+	if store == nil {
+		return
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	battery := 0
+	if previous, known := store.workers[worker]; known {
+		battery = previous.Battery
+	}
+	store.workers[worker] = &WorkerStatus{worker.specialization.specialization, worker.id, status, taskset, battery}
+}
+
+// the battery level of a worker changed
+func (store *stateStore) battery(specialization string, worker *Worker, level int) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	status, known := store.workers[worker]
+	if !known {
+		status = &WorkerStatus{Specialization: specialization, ID: worker.id, Status: statusFree}
+		store.workers[worker] = status
+	}
+	status.Battery = level
+}
+
+// //////////////////// Transport //////////////////////
+
+// a transportation worker travelled with parts on board
+func (store *stateStore) trip(parts int) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.transport.Trips++
+	store.transport.PartsMoved += parts
+	if parts == 0 {
+		store.transport.EmptyTrips++
+	}
+}
+
+// a transportation worker with a load capacity of one would have travelled
+func (store *stateStore) singleLoadTrip(loaded bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.transport.SingleLoadTrips++
+	if !loaded {
+		store.transport.SingleLoadEmptyTrips++
+	}
+}
+
+// set the trips of a restored snapshot
+func (store *stateStore) setTransport(metrics TransportMetrics) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.transport = metrics
+}
+
+// //////////////////// Batteries //////////////////////
+
+// a worker charged its battery after it waited for a charging station
+func (store *stateStore) charged(duration, waited int) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.batteries.Charges++
+	store.batteries.ChargingTime += duration
+	store.batteries.Waited += waited
+}
+
+// the battery of a worker ran empty
+func (store *stateStore) depleted() {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.batteries.Depleted++
+}
+
+// //////////////////// Handlers //////////////////////
+
+// a handler served a request after it waited for the handler
+func (store *stateStore) handled(station string, waited, busy time.Duration) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	status := store.handler(station)
+	status.Handled++
+	status.Waited += waited
+	status.Busy += busy
+}
+
+// a request waited for a handler, which takes the request as soon as it is done waiting
+func (store *stateStore) waited(station string, waited time.Duration) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.handler(station).Waited += waited
+}
+
+// contention of a handler
+func (store *stateStore) handler(station string) *HandlerStatus {
+	status, known := store.handlers[station]
+	if !known {
+		status = &HandlerStatus{Station: station}
+		store.handlers[station] = status
+	}
+	return status
+}
+
+// free the facility
+func (facility *Facility) free(freeFacilities chan *Facility) {
+	facility.state.facility(facility, statusFree, 0)
+	freeFacilities <- facility
+}
+
+// free the worker
+func (worker *Worker) free(freeWorkers chan *Worker) {
+	worker.specialization.state.worker(worker, statusFree, 0)
+	freeWorkers <- worker
+}
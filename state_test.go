@@ -0,0 +1,57 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the state store
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that the state follows a task set through the factory
+func TestStateOfTaskSet(t *testing.T) {
+	programTime := StartProgramTime()
+
+	// Build the factory with 1 pickup, 1 welding and 1 dropoff station
+	controlCenter := BuildFactory(1, 0, 1, 0, 1, 1, 2, 1, 1, programTime)
+
+	// Boot the control center
+	go controlCenter.Boot()
+
+	taskset := gen_task_set(&controlCenter, 1, []string{"pickup", "welding", "dropoff"}, []string{"pickup steel bar", "weld steel bar", "dropoff steel bar"})
+	controlCenter.request <- &taskset
+
+	// the task set is carried by the transportation worker
+	time.Sleep(500 * time.Millisecond)
+	state := controlCenter.State()
+	status, known := state.TaskSet(1)
+	if !known || status.Status != taskSetRunning || status.Transporter != 0 {
+		t.Errorf("Status of taskset 1 is %+v, want running with transport worker 0", status)
+	}
+	if state.FreeWorkers("transport") != 0 || state.FreeFacilities("pickup") != 0 {
+		t.Errorf("Transport worker and pickup station are free while taskset 1 is picked up")
+	}
+
+	for programTime.GetCurrentTime() < 15 {
+		time.Sleep(1 * time.Second)
+		if controlCenter.State().CompletedTaskSets == 1 {
+			time.Sleep(2 * time.Second)
+			break
+		}
+	}
+
+	// all tasks are done and everybody is free again
+	state = controlCenter.State()
+	if status, _ := state.TaskSet(1); status.Status != taskSetCompleted || status.Task != 3 {
+		t.Errorf("Status of taskset 1 is %+v, want completed", status)
+	}
+	if state.FreeWorkers() != len(state.Workers) || state.FreeFacilities() != len(state.Facilities) {
+		t.Errorf("%d of %d workers and %d of %d facilities are free, want all", state.FreeWorkers(), len(state.Workers), state.FreeFacilities(), len(state.Facilities))
+	}
+	if len(state.Workers) != 5 || len(state.Facilities) != 3 {
+		t.Errorf("State contains %d workers and %d facilities, want 5 and 3", len(state.Workers), len(state.Facilities))
+	}
+}
@@ -0,0 +1,217 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the traceability records of the tasks
+
+// For quality audits the control center records every attempt of every
+// task: the station and the facility, the transportation worker, the
+// workers that were at the station and when the attempt started, when all
+// workers were at the station and when it finished. Failed attempts are
+// recorded with the reason they failed, a task that joined a batch (see
+// batch.go) is recorded with the workers of the batch and an assembly of a
+// kit (see kitting.go) with the task sets of the parts it consumed.
+// The records can be queried by task set, by worker and by station and
+// saved as JSON or CSV. They are kept in snapshots (see snapshot.go) but
+// not in the journal, a recovered task set only has the records of the
+// attempts after the recovery.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// one attempt of a task, all times are in program time
+type TraceRecord struct {
+	TaskSet     int
+	Task        int // index of the task in its task set
+	Attempt     int
+	Station     string
+	Facility    int // id of the facility, -1 if none was assigned
+	Description string
+	Attributes  *TaskAttributes `json:",omitempty"`
+	Transporter int             // id of the transportation worker
+	Workers     []TracedWorker  `json:",omitempty"` // workers at the station besides the transportation worker
+	Started     int
+	Arrived     int // all workers were at the station, -1 if they never were
+	Finished    int
+	Completed   bool
+	Failure     string `json:",omitempty"`
+	Inputs      []int  `json:",omitempty"` // task sets of the components consumed by an assembly, see kitting.go
+}
+
+// worker of a traceability record
+type TracedWorker struct {
+	Specialization string
+	ID             int
+}
+
+// traceability records in the order the attempts finished
+type traceStore struct {
+	mutex   sync.Mutex
+	records []TraceRecord
+}
+
+// //////////////////// Recording //////////////////////
+
+// the workers are at the station to carry out the current attempt of the task
+func (task *Task) handledBy(workers []*Worker, now int) {
+	task.watch.mutex.Lock()
+	defer task.watch.mutex.Unlock()
+	task.watch.handlers = append([]*Worker(nil), workers...)
+	task.watch.arrived = now
+}
+
+// workers at the station for the current attempt and the program time
+// they were all there, -1 if they never were
+func (task *Task) handlers() ([]*Worker, int) {
+	task.watch.mutex.Lock()
+	defer task.watch.mutex.Unlock()
+	if task.watch.handlers == nil {
+		return nil, -1
+	}
+	return task.watch.handlers, task.watch.arrived
+}
+
+// record a finished attempt of the i-th task of the task set
+func (controlCenter *ControlCenter) traceAttempt(taskset *TaskSet, i int, attempt int, transporter *Worker, facility *Facility, started int, completed bool) {
+	task := taskset.tasks[i]
+	record := TraceRecord{
+		TaskSet:     taskset.id,
+		Task:        i,
+		Attempt:     attempt,
+		Station:     task.FacilityType.facilityType,
+		Facility:    -1,
+		Description: task.description,
+		Attributes:  task.attributes.typed(),
+		Transporter: transporter.id,
+		Started:     started,
+		Finished:    controlCenter.ProgramTime.GetCurrentTime(),
+		Completed:   completed,
+	}
+	if facility != nil {
+		record.Facility = facility.id
+	}
+	if !completed {
+		record.Failure = task.abortReason()
+	}
+	for _, part := range task.consumed {
+		record.Inputs = append(record.Inputs, part.TaskSet)
+	}
+	var handlers []*Worker
+	handlers, record.Arrived = task.handlers()
+	for _, worker := range handlers {
+		if worker != transporter {
+			record.Workers = append(record.Workers, TracedWorker{worker.specialization.specialization, worker.id})
+		}
+	}
+	controlCenter.trace.mutex.Lock()
+	defer controlCenter.trace.mutex.Unlock()
+	controlCenter.trace.records = append(controlCenter.trace.records, record)
+}
+
+// //////////////////// Queries //////////////////////
+
+// records that match a filter
+func (store *traceStore) filter(match func(TraceRecord) bool) []TraceRecord {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var records []TraceRecord
+	for _, record := range store.records {
+		if match(record) {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// get all traceability records in the order the attempts finished
+func (controlCenter *ControlCenter) TraceRecords() []TraceRecord {
+	return controlCenter.trace.filter(func(TraceRecord) bool { return true })
+}
+
+// get the traceability records of a task set
+func (controlCenter *ControlCenter) TraceTaskSet(id int) []TraceRecord {
+	return controlCenter.trace.filter(func(record TraceRecord) bool { return record.TaskSet == id })
+}
+
+// get the traceability records of the attempts a worker took part in
+func (controlCenter *ControlCenter) TraceWorker(specialization string, id int) []TraceRecord {
+	return controlCenter.trace.filter(func(record TraceRecord) bool {
+		if specialization == "transport" {
+			return record.Transporter == id
+		}
+		for _, worker := range record.Workers {
+			if worker.Specialization == specialization && worker.ID == id {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// get the traceability records of a station
+func (controlCenter *ControlCenter) TraceStation(station string, id int) []TraceRecord {
+	return controlCenter.trace.filter(func(record TraceRecord) bool { return record.Station == station && record.Facility == id })
+}
+
+// //////////////////// Export //////////////////////
+
+// save traceability records to a file, as CSV if its name ends in .csv
+// and as JSON otherwise
+func SaveTrace(path string, records []TraceRecord) error {
+	if strings.HasSuffix(path, ".csv") {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := WriteTraceCSV(file, records); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// write traceability records as CSV with a header line, the workers are
+// separated by spaces, e. g. welding:0 welding:1
+func WriteTraceCSV(w io.Writer, records []TraceRecord) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"taskset", "task", "attempt", "station", "facility", "description", "transporter", "workers", "started", "arrived", "finished", "completed", "failure"})
+	for _, record := range records {
+		workers := make([]string, len(record.Workers))
+		for i, worker := range record.Workers {
+			workers[i] = fmt.Sprintf("%s:%d", worker.Specialization, worker.ID)
+		}
+		writer.Write([]string{
+			strconv.Itoa(record.TaskSet),
+			strconv.Itoa(record.Task),
+			strconv.Itoa(record.Attempt),
+			record.Station,
+			strconv.Itoa(record.Facility),
+			record.Description,
+			strconv.Itoa(record.Transporter),
+			strings.Join(workers, " "),
+			strconv.Itoa(record.Started),
+			strconv.Itoa(record.Arrived),
+			strconv.Itoa(record.Finished),
+			strconv.FormatBool(record.Completed),
+			record.Failure,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
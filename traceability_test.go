@@ -0,0 +1,130 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the traceability records
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// submit a task set and wait for it
+func runTaskSet(t *testing.T, controlCenter *ControlCenter, taskset TaskSet) TaskSetResult {
+	handle, err := controlCenter.Submit(&taskset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := handle.Wait(ctx)
+	if err != nil {
+		t.Fatalf("Taskset %d did not finish: %v", taskset.id, err)
+	}
+	return result
+}
+
+// Test that every task of a task set is traced with its station and workers
+func TestTraceability(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 1, 1, 1, 1, 1, 2, 1, 1, programTime)
+	go controlCenter.Boot()
+	runTaskSet(t, &controlCenter, gen_task_set(&controlCenter, 1, []string{"pickup", "welding", "assembly", "painting", "dropoff"}, []string{"pickup steel bar", "weld steel bar", "assemble steel bar", "paint steel bar in blue", "dropoff steel bar"}))
+
+	records := controlCenter.TraceTaskSet(1)
+	if len(records) != 5 {
+		t.Fatalf("Taskset has %d records, want 5: %+v", len(records), records)
+	}
+	workers := map[string]int{"pickup": 0, "welding": 2, "assembly": 1, "painting": 1, "dropoff": 0}
+	for i, record := range records {
+		if record.Task != i || record.Attempt != 1 || !record.Completed || record.Facility != 0 || record.Transporter != 0 {
+			t.Errorf("Record of task %d is %+v", i, record)
+		}
+		if len(record.Workers) != workers[record.Station] {
+			t.Errorf("Record of the %s task has the workers %+v", record.Station, record.Workers)
+		}
+		for _, worker := range record.Workers {
+			if worker.Specialization != record.Station {
+				t.Errorf("Record of the %s task has a %s worker", record.Station, worker.Specialization)
+			}
+		}
+		if record.Arrived < record.Started || record.Finished < record.Arrived {
+			t.Errorf("Record of task %d has the times %d, %d and %d", i, record.Started, record.Arrived, record.Finished)
+		}
+	}
+
+	// the queries by worker and by station
+	if welded := controlCenter.TraceWorker("welding", 1); len(welded) != 1 || welded[0].Station != "welding" {
+		t.Errorf("Welding worker 1 has the records %+v", welded)
+	}
+	if carried := controlCenter.TraceWorker("transport", 0); len(carried) != 5 {
+		t.Errorf("Transport worker 0 has %d records, want 5", len(carried))
+	}
+	if painted := controlCenter.TraceStation("painting", 0); len(painted) != 1 || painted[0].Description != "paint steel bar in blue" {
+		t.Errorf("Painting station 0 has the records %+v", painted)
+	}
+	if none := controlCenter.TraceStation("painting", 1); len(none) != 0 {
+		t.Errorf("Painting station 1 that does not exist has the records %+v", none)
+	}
+}
+
+// Test that failed attempts are traced with their reason
+func TestTraceFailedAttempts(t *testing.T) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 0, 0, 1, 1, 0, 0, 1, 1, programTime)
+	controlCenter.PaintingStations.SetQualityCheck(0.5)
+	go controlCenter.Boot()
+	result := runTaskSet(t, &controlCenter, gen_task_set(&controlCenter, 1, []string{"pickup", "painting", "dropoff"}, []string{"pickup sign", "paint sign in red", "dropoff sign"}))
+
+	painted := controlCenter.TraceStation("painting", 0)
+	if len(painted) != result.Tasks[1].Attempts {
+		t.Fatalf("Painting has %d records for %d attempts", len(painted), result.Tasks[1].Attempts)
+	}
+	for i, record := range painted {
+		last := i == len(painted)-1
+		if record.Attempt != i+1 || record.Completed != last || (record.Failure == "") != last || len(record.Workers) != 1 {
+			t.Errorf("Record of attempt %d is %+v", i+1, record)
+		}
+	}
+}
+
+// Test that the records are exported as CSV and JSON
+func TestTraceExport(t *testing.T) {
+	records := []TraceRecord{
+		{TaskSet: 1, Task: 1, Attempt: 1, Station: "welding", Facility: 0, Description: "weld steel bar", Transporter: 2, Workers: []TracedWorker{{"welding", 0}, {"welding", 1}}, Started: 3, Arrived: 5, Finished: 6, Completed: true},
+		{TaskSet: 2, Task: 0, Attempt: 2, Station: "pickup", Facility: -1, Description: "pickup, steel", Transporter: 0, Started: 7, Arrived: -1, Finished: 9, Failure: "breakdown"},
+	}
+	var buffer bytes.Buffer
+	if err := WriteTraceCSV(&buffer, records); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 || lines[1][7] != "welding:0 welding:1" || lines[2][5] != "pickup, steel" || lines[2][12] != "breakdown" {
+		t.Errorf("CSV is %q", lines)
+	}
+
+	path := filepath.Join(t.TempDir(), "trace.json")
+	if err := SaveTrace(path, records); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded []TraceRecord
+	if err := json.Unmarshal(data, &loaded); err != nil || !reflect.DeepEqual(loaded, records) {
+		t.Errorf("JSON records are %+v, %v", loaded, err)
+	}
+}
@@ -0,0 +1,249 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the load capacity of the transportation workers
+
+// A transportation worker carries up to its load capacity of task sets at
+// once. When the request handler dispatches a task set it loads the
+// waiting task sets whose next station is near the next station of the
+// dispatched one onto the same transportation worker, in the order they
+// would be dispatched. The distance of two station types is their distance
+// in the flow pickup, welding, assembly, painting, dropoff, the reach of
+// the policy is the largest distance that is loaded together.
+// The transportation worker builds its route stop by stop. The first stop
+// is the next station of the dispatched task set, the route strategy picks
+// the following ones:
+//  - most parts: the station type most parts of the load head to next
+//  - nearest: the station type nearest to the current stop
+// At a stop the worker hands over the parts heading to it one after the
+// other, possibly at different stations of the type, and only travels once
+// to get there. Only task sets whose kits are complete are loaded (see
+// kitting.go), a part waiting for its kit anyway is only served when no
+// other part of the load can go on. A retried task travels again.
+// A part that is finished or failed is reported at once, the worker goes
+// back to the control center once all parts of its load are finished.
+// The state store (see state.go) counts the trips, the empty ones and the
+// parts on board, and the trips the same tasks would have taken with a
+// load capacity of one. Recorded dispatch decisions (see replay.go) do not
+// cover the loaded task sets.
+
+package main
+
+import (
+	"slices"
+	"time"
+)
+
+// strategy that picks the next stop of a load
+type RouteStrategy int
+
+const (
+	RouteMostParts RouteStrategy = iota
+	RouteNearest
+)
+
+// station types in the order of the flow
+var stationFlow = []string{"pickup", "welding", "assembly", "painting", "dropoff"}
+
+// load capacity of the transportation workers and their routes
+type TransportPolicy struct {
+	Capacity int // task sets a transportation worker carries at once, 1 if 0
+	Reach    int // largest distance of the next stations of task sets loaded together
+	Route    RouteStrategy
+}
+
+// trips of the transportation workers, including those back to the control center
+type TransportMetrics struct {
+	Trips                int
+	EmptyTrips           int // trips without a part on board
+	PartsMoved           int // parts on board summed over all trips
+	SingleLoadTrips      int // trips with a load capacity of one
+	SingleLoadEmptyTrips int
+}
+
+// task sets carried by a transportation worker at once
+type transportLoad struct {
+	parts     []*TaskSet
+	next      []int        // index of the next task of each part, its number of tasks once it is finished
+	stop      *FacilitySet // station type of the current stop, nil at the control center
+	travelled bool         // the worker already travelled to the current stop
+	at        *Facility    // facility of the last completed task, nil at the control center
+}
+
+// set the load capacity of the transportation workers and their routes
+// must be called before the factory is booted
+func (controlCenter *ControlCenter) SetTransportPolicy(policy TransportPolicy) {
+	controlCenter.transportPolicy = policy
+}
+
+// //////////////////// Loading //////////////////////
+
+// distance of two station types in the flow
+func distance(a, b string) int {
+	i, j := slices.Index(stationFlow, a), slices.Index(stationFlow, b)
+	if i < 0 || j < 0 {
+		return len(stationFlow)
+	}
+	return max(i-j, j-i)
+}
+
+// station type of the next task of a task set, empty if all are completed
+func (taskset *TaskSet) nextStation() string {
+	if next := taskset.resumeAt(); next < len(taskset.tasks) {
+		return taskset.tasks[next].FacilityType.facilityType
+	}
+	return ""
+}
+
+// take the waiting task sets carried together with a dispatched one out of
+// the intake queue
+func (controlCenter *ControlCenter) loadWith(request *TaskSet, transportWorker *Worker) []TaskSet {
+	policy := controlCenter.transportPolicy
+	if policy.Capacity <= 1 {
+		return nil
+	}
+	station := request.nextStation()
+	taken := controlCenter.intake.take(policy.Capacity-1, func(taskset *TaskSet) bool {
+		return distance(station, taskset.nextStation()) <= policy.Reach && controlCenter.kitted(taskset)
+	})
+	load := make([]TaskSet, len(taken))
+	for i, taskset := range taken {
+		for _, task := range taskset.tasks {
+			task.Transporter = transportWorker
+		}
+		controlCenter.state.handled(dispatchStation, time.Since(taskset.queued), 0)
+		controlCenter.intake.dispatched(controlCenter.ProgramTime.GetCurrentTime())
+		// print taskset X is loaded together with taskset Y
+		controlCenter.events.println("[", taskset.id, "]", "📦: taskset", taskset.id, "is loaded together with taskset", request.id, "on transportation worker", transportWorker.id)
+		load[i] = *taskset
+	}
+	return load
+}
+
+// load of a task set handed to a transportation worker and the task sets
+// loaded together with it
+func newTransportLoad(taskset TaskSet) *transportLoad {
+	load := &transportLoad{}
+	for _, part := range append([]TaskSet{taskset}, taskset.load...) {
+		part := part
+		part.load = nil
+		load.parts = append(load.parts, &part)
+		load.next = append(load.next, part.resumeAt())
+	}
+	// a load restored from a snapshot waits at the facility of the last
+	// completed task of its first task set
+	if load.next[0] > 0 {
+		load.at = load.parts[0].tasks[load.next[0]-1].Facility
+	}
+	return load
+}
+
+// //////////////////// Routing //////////////////////
+
+// next stop of the load and the parts served there in the order of the load
+// returns nil if all parts are finished
+func (controlCenter *ControlCenter) nextStop(load *transportLoad) (*FacilitySet, []int) {
+	var heading, waiting []int
+	for p, part := range load.parts {
+		if load.next[p] >= len(part.tasks) {
+			continue
+		}
+		if controlCenter.ready(part.tasks[load.next[p]]) {
+			heading = append(heading, p)
+		} else {
+			waiting = append(waiting, p)
+		}
+	}
+	if len(heading) == 0 {
+		heading = waiting
+	}
+	if len(heading) == 0 {
+		return nil, nil
+	}
+	station := func(p int) *FacilitySet { return load.parts[p].tasks[load.next[p]].FacilityType }
+	counts := make(map[*FacilitySet]int)
+	for _, p := range heading {
+		counts[station(p)]++
+	}
+	// the first stop is the next station of the dispatched task set
+	stop := station(heading[0])
+	if load.stop != nil || heading[0] != 0 {
+		here := ""
+		if load.stop != nil {
+			here = load.stop.facilityType
+		}
+		better := func(a, b *FacilitySet) bool {
+			byDistance := distance(here, a.facilityType) - distance(here, b.facilityType)
+			byParts := counts[b] - counts[a]
+			byFlow := slices.Index(stationFlow, a.facilityType) - slices.Index(stationFlow, b.facilityType)
+			if controlCenter.transportPolicy.Route == RouteNearest {
+				return byDistance < 0 || byDistance == 0 && (byParts < 0 || byParts == 0 && byFlow < 0)
+			}
+			return byParts < 0 || byParts == 0 && byFlow < 0
+		}
+		for candidate := range counts {
+			if better(candidate, stop) {
+				stop = candidate
+			}
+		}
+	}
+	var served []int
+	for _, p := range heading {
+		if station(p) == stop {
+			served = append(served, p)
+		}
+	}
+	return stop, served
+}
+
+// the worker heads to the next stop
+func (load *transportLoad) head(stop *FacilitySet) {
+	load.stop = stop
+	load.travelled = false
+}
+
+// check if the worker still has to travel to the current stop
+// the first part served at a stop travels, the others come along
+func (load *transportLoad) departs() bool {
+	departs := !load.travelled
+	load.travelled = true
+	return departs
+}
+
+// number of parts on board, those picked up and not finished yet
+func (load *transportLoad) onBoard() int {
+	parts := 0
+	for p, part := range load.parts {
+		if load.next[p] > 0 && load.next[p] < len(part.tasks) {
+			parts++
+		}
+	}
+	return parts
+}
+
+// parts of the load that are not finished yet
+func (load *transportLoad) unfinished() []*TaskSet {
+	var parts []*TaskSet
+	for p, part := range load.parts {
+		if load.next[p] < len(part.tasks) {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// //////////////////// Metrics //////////////////////
+
+// average number of parts on board of the trips that were not empty
+func (metrics TransportMetrics) MeanLoad() float64 {
+	if metrics.Trips == metrics.EmptyTrips {
+		return 0
+	}
+	return float64(metrics.PartsMoved) / float64(metrics.Trips-metrics.EmptyTrips)
+}
+
+// trips saved compared to a load capacity of one
+func (metrics TransportMetrics) SavedTrips() int {
+	return metrics.SingleLoadTrips - metrics.Trips
+}
@@ -0,0 +1,132 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the load capacity of the transportation workers
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// run three task sets with one transportation worker of a load capacity
+func runLoad(t *testing.T, capacity int) (ControlCenter, TransportMetrics) {
+	programTime := StartSimulatedTime(0, 5*time.Millisecond)
+	controlCenter := BuildFactory(1, 0, 0, 1, 1, 0, 0, 1, 1, programTime)
+	controlCenter.SetTransportPolicy(TransportPolicy{Capacity: capacity})
+	// all task sets wait in the intake queue when the factory boots
+	var handles []*TaskSetHandle
+	for id := 1; id <= 3; id++ {
+		taskset := gen_task_set(&controlCenter, id, []string{"pickup", "painting", "dropoff"}, []string{"pickup sign", "paint sign in red", "dropoff sign"})
+		handle, err := controlCenter.Submit(&taskset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handles = append(handles, handle)
+	}
+	go controlCenter.Boot()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, handle := range handles {
+		if result, err := handle.Wait(ctx); err != nil || result.Status != taskSetCompleted {
+			t.Fatalf("Taskset %d finished with %+v, %v", handle.ID(), result, err)
+		}
+	}
+	// the trip back to the control center
+	deadline := time.Now().Add(10 * time.Second)
+	for controlCenter.State().FreeWorkers("transport") == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return controlCenter, controlCenter.State().Transport
+}
+
+// Test that a transportation worker carries several parts per trip
+func TestTransportCapacity(t *testing.T) {
+	_, single := runLoad(t, 1)
+	want := TransportMetrics{Trips: 12, EmptyTrips: 6, PartsMoved: 6, SingleLoadTrips: 12, SingleLoadEmptyTrips: 6}
+	if single != want {
+		t.Errorf("Trips with a load capacity of one are %+v, want %+v", single, want)
+	}
+
+	// one trip to each station type and back
+	controlCenter, loaded := runLoad(t, 3)
+	want = TransportMetrics{Trips: 4, EmptyTrips: 2, PartsMoved: 6, SingleLoadTrips: 12, SingleLoadEmptyTrips: 6}
+	if loaded != want {
+		t.Errorf("Trips with a load capacity of three are %+v, want %+v", loaded, want)
+	}
+	if loaded.MeanLoad() != 3 || loaded.SavedTrips() != 8 {
+		t.Errorf("Mean load is %.1f and %d trips are saved", loaded.MeanLoad(), loaded.SavedTrips())
+	}
+	if carried := controlCenter.TraceWorker("transport", 0); len(carried) != 9 {
+		t.Errorf("Transport worker 0 has %d records, want 9", len(carried))
+	}
+}
+
+// Test that task sets are loaded within the reach and routed by the strategy
+func TestTransportRoute(t *testing.T) {
+	programTime := StartProgramTime()
+	controlCenter := BuildFactory(1, 1, 1, 1, 1, 1, 2, 1, 1, programTime)
+	controlCenter.SetTransportPolicy(TransportPolicy{Capacity: 3, Reach: 1})
+	request := gen_task_set(&controlCenter, 1, []string{"pickup", "dropoff"}, []string{"pickup bar", "dropoff bar"})
+	for id, first := range map[int]string{2: "painting", 3: "welding"} {
+		taskset := gen_task_set(&controlCenter, id, []string{first, "dropoff"}, []string{"work on bar", "dropoff bar"})
+		if _, err := controlCenter.Submit(&taskset); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a task set waiting for its kit is not loaded although it is within reach
+	assembly := gen_task_set(&controlCenter, 4, []string{"welding", "assembly"}, []string{"weld frame", "assemble scooter"})
+	assembly.tasks[1].kit = "scooter-4"
+	assembly.tasks[1].attributes.Components = []string{"frame"}
+	if _, err := controlCenter.Submit(&assembly); err != nil {
+		t.Fatal(err)
+	}
+	load := controlCenter.loadWith(&request, controlCenter.TransportWorkers.workers[0])
+	if len(load) != 1 || load[0].id != 3 || load[0].tasks[0].Transporter != controlCenter.TransportWorkers.workers[0] {
+		t.Fatalf("Task sets %+v are loaded with the pickup", load)
+	}
+	if queue := controlCenter.Queue(); len(queue) != 2 || queue[0].ID != 2 || queue[1].ID != 4 {
+		t.Errorf("Intake queue is %+v", queue)
+	}
+
+	// two parts head to welding and one to dropoff, seen from painting
+	parts := []TaskSet{
+		gen_task_set(&controlCenter, 4, []string{"welding"}, []string{"weld bar"}),
+		gen_task_set(&controlCenter, 5, []string{"dropoff"}, []string{"dropoff bar"}),
+		gen_task_set(&controlCenter, 6, []string{"welding"}, []string{"weld bar"}),
+		gen_task_set(&controlCenter, 7, []string{"assembly"}, []string{"assemble scooter"}),
+	}
+	parts[3].tasks[0].kit = "scooter-7"
+	parts[3].tasks[0].attributes.Components = []string{"frame"}
+	for _, tc := range []struct {
+		route  RouteStrategy
+		stop   *FacilitySet
+		served []int
+	}{
+		{RouteMostParts, controlCenter.WeldingStations, []int{0, 2}},
+		{RouteNearest, controlCenter.DropoffStations, []int{1}},
+	} {
+		controlCenter.SetTransportPolicy(TransportPolicy{Capacity: 4, Route: tc.route})
+		load := newTransportLoad(parts[0])
+		for _, part := range parts[1:] {
+			part := part
+			load.parts = append(load.parts, &part)
+			load.next = append(load.next, 0)
+		}
+		load.head(controlCenter.PaintingStations)
+		stop, served := controlCenter.nextStop(load)
+		if stop != tc.stop || len(served) != len(tc.served) || served[0] != tc.served[0] {
+			t.Errorf("Route %d stops at %s for the parts %v", tc.route, stop.facilityType, served)
+		}
+	}
+
+	// a part waiting for its kit is served once no other part can go on
+	waiting := newTransportLoad(parts[3])
+	waiting.head(controlCenter.PaintingStations)
+	if stop, served := controlCenter.nextStop(waiting); stop != controlCenter.AssemblyStations || len(served) != 1 {
+		t.Errorf("Waiting part stops at %v for the parts %v", stop, served)
+	}
+}
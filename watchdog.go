@@ -0,0 +1,182 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the timeouts and the watchdog of the control center
+
+// Every attempt to carry out a task goes through three stages:
+//  1. waiting for a free facility of the required type
+//  2. waiting for the workers to arrive at the facility
+//  3. processing the task at the facility
+// The transportation worker registers the attempt with the watchdog,
+// which checks once per unit of program time whether the current stage
+// (or the whole task) takes longer than allowed. A stuck attempt is
+// aborted by closing its abort channel: the control center gives back
+// the workers it already assigned, the facility sends back the workers
+// that already arrived and frees itself, and the remaining workers go
+// back to the control center instead of arriving. The transportation
+// worker then either retries the task or fails the task set according
+// to the retry policy of the facility type (see retry.go).
+
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// timeouts of a task, all times are in program time
+// a zero value disables the respective timeout
+type Timeouts struct {
+	Facility   int // waiting for a free facility of the required type
+	Workers    int // waiting for the workers to arrive at the facility
+	Processing int // processing the task at the facility
+	Task       int // the whole task, from the request to its completion
+}
+
+// stages of an attempt to carry out a task
+const (
+	stageFacility   = "waiting for facility"
+	stageWorkers    = "waiting for workers"
+	stageProcessing = "processing"
+)
+
+// progress of one attempt to carry out a task
+// shared by the transportation worker, the control center, the facility and the watchdog
+type taskWatch struct {
+	mutex    sync.Mutex
+	stage    string
+	since    int // program time the current stage started
+	started  int // program time the attempt started
+	assigned int // program time the facility and the workers were assigned
+	abort    chan struct{}
+	reason   string    // why the attempt was aborted, empty if it was not
+	handlers []*Worker // workers at the station, see traceability.go
+	arrived  int       // program time the workers were all at the station
+}
+
+func newTaskWatch() *taskWatch {
+	return &taskWatch{abort: make(chan struct{})}
+}
+
+// attempts registered with the watchdog
+type watchList struct {
+	mutex sync.Mutex
+	tasks map[*Task]bool
+}
+
+// //////////////////// Task attempts //////////////////////
+
+// enter the next stage of the current attempt
+func (task *Task) enterStage(stage string, now int) {
+	task.watch.mutex.Lock()
+	defer task.watch.mutex.Unlock()
+	if stage == stageFacility {
+		task.watch.started = now
+	}
+	task.watch.stage = stage
+	task.watch.since = now
+}
+
+// the facility and all workers of the current attempt are assigned
+func (task *Task) assignedAt(now int) {
+	task.watch.mutex.Lock()
+	defer task.watch.mutex.Unlock()
+	task.watch.assigned = now
+}
+
+// program time the current attempt waited for its facility and workers,
+// 0 if they were assigned before the attempt, e. g. the first pickup station
+func (task *Task) waited() int {
+	task.watch.mutex.Lock()
+	defer task.watch.mutex.Unlock()
+	return max(task.watch.assigned-task.watch.started, 0)
+}
+
+// channel that is closed when the current attempt is aborted
+func (task *Task) aborted() <-chan struct{} {
+	return task.watch.abort
+}
+
+// abort the current attempt, everybody waiting on it is woken up
+// returns false if the attempt was already aborted
+func (task *Task) cancel(reason string) bool {
+	task.watch.mutex.Lock()
+	defer task.watch.mutex.Unlock()
+	if task.watch.reason != "" {
+		return false
+	}
+	task.watch.reason = reason
+	close(task.watch.abort)
+	return true
+}
+
+// reason why the current attempt was aborted, empty if it was not
+func (task *Task) abortReason() string {
+	task.watch.mutex.Lock()
+	defer task.watch.mutex.Unlock()
+	return task.watch.reason
+}
+
+// check if the current attempt exceeds one of the timeouts
+// returns the reason to abort it or an empty string
+func (task *Task) overdue(now int, timeouts Timeouts) string {
+	task.watch.mutex.Lock()
+	defer task.watch.mutex.Unlock()
+	limit := 0
+	switch task.watch.stage {
+	case stageFacility:
+		limit = timeouts.Facility
+	case stageWorkers:
+		limit = timeouts.Workers
+	case stageProcessing:
+		limit = timeouts.Processing
+	}
+	if limit > 0 && now-task.watch.since > limit {
+		return fmt.Sprintf("task %s timed out %s at %s station", task.description, task.watch.stage, task.FacilityType.facilityType)
+	}
+	if timeouts.Task > 0 && now-task.watch.started > timeouts.Task {
+		return fmt.Sprintf("task %s did not complete within %d time units", task.description, timeouts.Task)
+	}
+	return ""
+}
+
+// new attempt of an aborted task
+// the old task is left untouched as facilities and workers may still refer to it
+func (task *Task) retry() *Task {
+	retried := task.clone()
+	retried.Transporter = task.Transporter
+	return retried
+}
+
+// //////////////////// Watchdog //////////////////////
+
+// register the current attempt of a task with the watchdog
+func (controlCenter *ControlCenter) watch(task *Task) {
+	task.enterStage(stageFacility, controlCenter.ProgramTime.GetCurrentTime())
+	controlCenter.watched.mutex.Lock()
+	defer controlCenter.watched.mutex.Unlock()
+	controlCenter.watched.tasks[task] = true
+}
+
+// unregister an attempt once it is completed or aborted
+func (controlCenter *ControlCenter) unwatch(task *Task) {
+	controlCenter.watched.mutex.Lock()
+	defer controlCenter.watched.mutex.Unlock()
+	delete(controlCenter.watched.tasks, task)
+}
+
+// watchdog of the control center
+// aborts all registered attempts that exceed one of the timeouts
+func (controlCenter *ControlCenter) RunWatchdog() {
+	for controlCenter.ProgramTime.WaitRunning(1) {
+		now := controlCenter.ProgramTime.GetCurrentTime()
+		controlCenter.watched.mutex.Lock()
+		for task := range controlCenter.watched.tasks {
+			if reason := task.overdue(now, controlCenter.Timeouts); reason != "" && task.cancel(reason) {
+				controlCenter.events.println("[", task.tasksetID, "]", "⏰:", reason)
+			}
+		}
+		controlCenter.watched.mutex.Unlock()
+	}
+}
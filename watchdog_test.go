@@ -0,0 +1,120 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the timeouts and the watchdog
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that a task set fails if the workers never show up at a station
+func TestStuckWorkersFailTaskSet(t *testing.T) {
+	programTime := StartProgramTime()
+
+	N := 1 // N robots of each kind, welding needs 2 welders
+	W := 1 // W facilities on welding stations
+	P := 0 // P facilities on painting stations
+	A := 0 // A facilities on assembly stations
+	I := 1 // I facilities on pick-up stations
+	D := 1 // D facilities on drop-off stations
+
+	// Build the factory with specified number of facilities and workers
+	controlCenter := BuildFactory(I, A, W, P, D, N, N, N, N, programTime)
+	controlCenter.Timeouts = Timeouts{Workers: 3}
+	controlCenter.WeldingStations.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+
+	// Boot the control center
+	go controlCenter.Boot()
+
+	// Create a task set for welding station
+	weldingTask := gen_task_set(&controlCenter, 1, []string{"pickup", "welding", "dropoff"}, []string{"pickup steel bar", "weld steel bar", "dropoff steel bar"})
+	controlCenter.request <- &weldingTask
+
+	for programTime.GetCurrentTime() < 15 {
+		time.Sleep(1 * time.Second)
+		if controlCenter.State().FailedTaskSets == 1 {
+			time.Sleep(2 * time.Second)
+			break
+		}
+	}
+
+	// Check that the task set failed instead of hanging forever
+	if controlCenter.State().FailedTaskSets != 1 || controlCenter.State().CompletedTaskSets != 0 {
+		t.Errorf("Failed and completed task sets are %d and %d, want 1 and 0", controlCenter.State().FailedTaskSets, controlCenter.State().CompletedTaskSets)
+	}
+
+	// check if all workers are free
+	if FreeWorkersCount(&controlCenter) != 4*N {
+		t.Errorf("Total number of free workers in Factory is %d, want %d", FreeWorkersCount(&controlCenter), 4*N)
+	}
+
+	// check if all facilities are free
+	if FreeFacilitiesCount(&controlCenter) != I+D+A+W+P {
+		t.Errorf("Total number of free facilities in Factory is %d, want %d", FreeFacilitiesCount(&controlCenter), I+D+A+W+P)
+	}
+}
+
+// Test that a stuck task is retried and completes once the station is back
+func TestStuckTaskRetry(t *testing.T) {
+	programTime := StartProgramTime()
+
+	N := 2 // N robots of each kind
+	W := 1 // W facilities on welding stations
+	P := 0 // P facilities on painting stations
+	A := 0 // A facilities on assembly stations
+	I := 1 // I facilities on pick-up stations
+	D := 1 // D facilities on drop-off stations
+
+	// Build the factory with specified number of facilities and workers
+	controlCenter := BuildFactory(I, A, W, P, D, N, N, N, N, programTime)
+	controlCenter.Timeouts = Timeouts{Facility: 2}
+	controlCenter.WeldingStations.SetRetryPolicy(RetryPolicy{MaxAttempts: 6})
+
+	// the only welding station is in maintenance right after booting
+	controlCenter.WeldingStations.SetMaintenance(MaintenancePlan{Start: 0, Interval: 1000, Duration: 5})
+
+	// Boot the control center
+	go controlCenter.Boot()
+
+	// Create a task set for welding station
+	weldingTask := gen_task_set(&controlCenter, 1, []string{"pickup", "welding", "dropoff"}, []string{"pickup steel bar", "weld steel bar", "dropoff steel bar"})
+	controlCenter.request <- &weldingTask
+
+	for programTime.GetCurrentTime() < 20 {
+		time.Sleep(1 * time.Second)
+		if controlCenter.State().CompletedTaskSets+controlCenter.State().FailedTaskSets == 1 {
+			break
+		}
+	}
+
+	// Check if the welding task is complete
+	if controlCenter.State().CompletedTaskSets != 1 {
+		t.Errorf("Total number of tasks done in Factory is %d, want 1", controlCenter.State().CompletedTaskSets)
+	}
+
+	// Check that the task had to be retried
+	if controlCenter.State().RetriedTasks == 0 {
+		t.Errorf("Welding task was not retried while the station was in maintenance")
+	}
+}
+
+// Test the reason given for a stuck task
+func TestOverdueReason(t *testing.T) {
+	controlCenter := BuildFactory(1, 0, 1, 0, 1, 1, 1, 1, 1, &ProgramTime{})
+	taskset := gen_task_set(&controlCenter, 1, []string{"pickup", "welding"}, []string{"pickup steel bar", "weld steel bar"})
+	task := taskset.tasks[1]
+
+	task.enterStage(stageWorkers, 10)
+	if reason := task.overdue(12, Timeouts{Workers: 3}); reason != "" {
+		t.Errorf("Task is not overdue yet, got reason %q", reason)
+	}
+	reason := task.overdue(14, Timeouts{Workers: 3})
+	if !strings.Contains(reason, "waiting for workers at welding station") {
+		t.Errorf("Unexpected reason %q", reason)
+	}
+}
@@ -0,0 +1,406 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the what-if optimizer of the factory layout
+
+// The optimizer looks for the cheapest layout that meets a service level
+// for an order mix, a throughput of task sets and optionally a p95 latency.
+// It starts with the fewest resources the mix can be carried out with and
+// keeps adding one unit of the bottleneck of the capacity plan (see
+// capacity.go). Once the plan promises the throughput, the layout is
+// simulated under a fast clock with the task sets arriving at the target
+// rate. If the simulation misses the service level, the bottleneck grows
+// further, otherwise the optimizer tries to remove single units again, the
+// expensive ones first, as long as the simulation still meets the service
+// level.
+// Every layout looked at is a candidate, the ranked table lists the ones
+// meeting the service level by cost first and then the others by their
+// planned throughput.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cost of one unit of every kind of resource, by resource, e. g. welding station
+// resources without a cost are free
+type UnitCosts map[string]float64
+
+// illustrative costs, a station costs more than the robots working at it
+func DefaultUnitCosts() UnitCosts {
+	return UnitCosts{
+		"pickup station":   5,
+		"assembly station": 20,
+		"welding station":  30,
+		"painting station": 20,
+		"dropoff station":  5,
+		"assembly worker":  8,
+		"welding worker":   10,
+		"painting worker":  8,
+		"transport worker": 4,
+	}
+}
+
+// cost of a layout
+func (costs UnitCosts) of(layout Layout) float64 {
+	cost := 0.0
+	for resource, units := range layout.units() {
+		cost += costs[resource] * float64(*units)
+	}
+	return cost
+}
+
+// service level a layout has to meet
+type SLA struct {
+	Throughput float64 // task sets per unit of program time
+	Latency    int     // p95 latency of a task set in program time, 0 if not bounded
+}
+
+// share of the throughput a simulation may miss, short simulations jitter
+const slaTolerance = 0.1
+
+// result of a simulated run of a layout
+type Simulation struct {
+	TaskSets    int
+	Elapsed     int     // program time from the first submission to the last completion
+	Throughput  float64 // completed task sets per unit of program time
+	P50         int     // latencies from the submission to the completion in program time
+	P95         int
+	P99         int
+	Utilization map[string]float64 // share of the resources of a kind that were busy, sampled once per unit of program time
+	Results     []TaskSetResult    // by task set id
+}
+
+// whether the simulation meets the service level
+func (simulation Simulation) meets(sla SLA) bool {
+	return simulation.Throughput >= (1-slaTolerance)*sla.Throughput && (sla.Latency == 0 || simulation.P95 <= sla.Latency)
+}
+
+// one layout looked at by the optimizer
+type Candidate struct {
+	Layout     Layout
+	Cost       float64
+	Planned    float64     // maximum throughput of the capacity plan
+	Bottleneck string      // of the capacity plan
+	Simulation *Simulation // nil if the plan misses the throughput
+	Meets      bool
+}
+
+// ranked candidates of the optimizer
+type Candidates []Candidate
+
+// search of the optimizer
+type WhatIf struct {
+	Mix      OrderMix
+	SLA      SLA
+	Costs    UnitCosts
+	TaskSets int           // task sets per simulation, 100 if 0
+	Tick     time.Duration // real duration of one unit of program time in the simulations, 1ms if 0
+	MaxSteps int           // units added to the fewest resources at most, 50 if 0
+	Output   io.Writer     // events of the simulated factories, discarded if nil
+}
+
+// //////////////////// Simulation //////////////////////
+
+// simulate the order mix arriving at the rate in a factory with the layout
+// under a fast clock, one unit of program time lasts tick
+// the events of the simulated factory are printed to output, discarded if nil
+func Simulate(layout Layout, mix OrderMix, rate float64, tasksets int, tick time.Duration, output io.Writer) (Simulation, error) {
+	if rate <= 0 || tasksets < 2 {
+		return Simulation{}, fmt.Errorf("simulation: need a positive rate and at least 2 task sets")
+	}
+	// a layout without a required resource never completes a task set
+	plan, err := PlanCapacity(layout, FactoryDurations(), mix, rate)
+	if err != nil {
+		return Simulation{}, err
+	}
+	if plan.MaxThroughput == 0 {
+		return Simulation{}, fmt.Errorf("simulation: layout has no %s", plan.Bottleneck)
+	}
+
+	programTime := StartSimulatedTime(0, tick)
+	controlCenter := layout.Build(programTime)
+	if output == nil {
+		output = io.Discard
+	}
+	controlCenter.SetOutput(output)
+	go controlCenter.Boot()
+	// the simulated factory and its clock stop once the simulation is over
+	defer controlCenter.Shutdown()
+
+	// sample the busy resources until all task sets are finished
+	sampled := make(chan map[string]float64, 1)
+	finished := make(chan struct{})
+	go controlCenter.sampleUtilization(layout, finished, sampled)
+
+	// the task sets arrive at the rate
+	start := programTime.GetCurrentTime()
+	handles := make([]*TaskSetHandle, 0, tasksets)
+	for id, share := range mix.spread(tasksets) {
+		for float64(programTime.GetCurrentTime()-start) < float64(id)/rate {
+			programTime.Wait(1)
+		}
+		taskset := share.taskset(&controlCenter, id+1)
+		handle, err := controlCenter.Submit(&taskset)
+		if err != nil {
+			close(finished)
+			return Simulation{}, err
+		}
+		handles = append(handles, handle)
+	}
+
+	// the throughput is the rate of the completions, which follows the rate
+	// of the arrivals as long as the layout keeps up
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(100*tasksets)*programTime.Tick()+time.Minute)
+	defer cancel()
+	latencies := make([]int, 0, tasksets)
+	results := make([]TaskSetResult, 0, tasksets)
+	first, last := -1, 0
+	for _, handle := range handles {
+		result, err := handle.Wait(ctx)
+		if err != nil {
+			close(finished)
+			return Simulation{}, fmt.Errorf("simulation: taskset %d is not finished: %v", handle.ID(), err)
+		}
+		latencies = append(latencies, result.Time-result.Submitted)
+		results = append(results, result)
+		if first < 0 || result.Time < first {
+			first = result.Time
+		}
+		last = max(last, result.Time)
+	}
+	close(finished)
+	simulation := Simulation{TaskSets: tasksets, Elapsed: last - start, P50: percentile(latencies, 50), P95: percentile(latencies, 95), P99: percentile(latencies, 99), Utilization: <-sampled, Results: results}
+	simulation.Throughput = float64(tasksets-1) / float64(max(last-first, 1))
+	return simulation, nil
+}
+
+// sample the share of busy resources of every kind once per unit of program
+// time until finished is closed, the mean shares are sent to sampled
+func (controlCenter *ControlCenter) sampleUtilization(layout Layout, finished <-chan struct{}, sampled chan<- map[string]float64) {
+	units := layout.units()
+	busy := make(map[string]float64)
+	samples := 0
+	for {
+		select {
+		case <-finished:
+			for resource := range busy {
+				busy[resource] /= float64(max(samples, 1))
+			}
+			sampled <- busy
+			return
+		case <-controlCenter.ProgramTime.After(1):
+		}
+		state := controlCenter.State()
+		samples++
+		for _, status := range state.Facilities {
+			if resource := status.Type + " station"; status.Status == statusBusy {
+				busy[resource] += 1 / float64(*units[resource])
+			}
+		}
+		for _, status := range state.Workers {
+			if resource := status.Specialization + " worker"; status.Status == statusBusy {
+				busy[resource] += 1 / float64(*units[resource])
+			}
+		}
+	}
+}
+
+// routes of n task sets in the proportions of the mix, spread evenly
+func (mix OrderMix) spread(n int) []OrderShare {
+	total := 0.0
+	for _, share := range mix {
+		total += share.Share
+	}
+	routes := make([]OrderShare, 0, n)
+	current := make([]float64, len(mix))
+	for len(routes) < n {
+		next := 0
+		for i, share := range mix {
+			current[i] += share.Share
+			if current[i] > current[next] {
+				next = i
+			}
+		}
+		current[next] -= total
+		routes = append(routes, mix[next])
+	}
+	return routes
+}
+
+// latency below which the given percentage of the latencies lie
+func percentile(latencies []int, percentage float64) int {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+	i := int(percentage/100*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+// //////////////////// Search //////////////////////
+
+// search the cheapest layout meeting the service level
+// returns all candidates looked at, ranked
+func (whatIf WhatIf) Optimize() (Candidates, error) {
+	if whatIf.SLA.Throughput <= 0 {
+		return nil, fmt.Errorf("what-if: need a positive target throughput")
+	}
+	if whatIf.TaskSets == 0 {
+		whatIf.TaskSets = 100
+	}
+	if whatIf.Tick == 0 {
+		whatIf.Tick = time.Millisecond
+	}
+	if whatIf.MaxSteps == 0 {
+		whatIf.MaxSteps = 50
+	}
+
+	// the fewest resources the mix can be carried out with
+	minimum, err := whatIf.minimum()
+	if err != nil {
+		return nil, err
+	}
+	evaluated := make(map[Layout]*Candidate)
+
+	// add the bottleneck until a simulated layout meets the service level
+	layout := minimum
+	var best *Candidate
+	for step := 0; step <= whatIf.MaxSteps && best == nil; step++ {
+		candidate, err := whatIf.evaluate(layout, evaluated)
+		if err != nil {
+			return nil, err
+		}
+		if candidate.Meets {
+			best = candidate
+			break
+		}
+		*layout.units()[candidate.Bottleneck]++
+	}
+
+	// remove single units, the expensive ones first, while the layout still meets it
+	for best != nil {
+		cheaper := false
+		for _, resource := range whatIf.byCost() {
+			layout := best.Layout
+			units := layout.units()[resource]
+			if *units <= *minimum.units()[resource] {
+				continue
+			}
+			*units--
+			candidate, err := whatIf.evaluate(layout, evaluated)
+			if err != nil {
+				return nil, err
+			}
+			if candidate.Meets {
+				best, cheaper = candidate, true
+				break
+			}
+		}
+		if !cheaper {
+			break
+		}
+	}
+
+	var candidates Candidates
+	for _, candidate := range evaluated {
+		candidates = append(candidates, *candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Meets != b.Meets {
+			return a.Meets
+		}
+		if a.Meets {
+			return a.Cost < b.Cost || a.Cost == b.Cost && a.Planned > b.Planned
+		}
+		return a.Planned > b.Planned || a.Planned == b.Planned && a.Cost < b.Cost
+	})
+	return candidates, nil
+}
+
+// plan the layout and simulate it if the plan promises the throughput
+// layouts evaluated before are not evaluated again
+func (whatIf WhatIf) evaluate(layout Layout, evaluated map[Layout]*Candidate) (*Candidate, error) {
+	if candidate, known := evaluated[layout]; known {
+		return candidate, nil
+	}
+	plan, err := PlanCapacity(layout, FactoryDurations(), whatIf.Mix, whatIf.SLA.Throughput)
+	if err != nil {
+		return nil, err
+	}
+	candidate := &Candidate{Layout: layout, Cost: whatIf.Costs.of(layout), Planned: plan.MaxThroughput, Bottleneck: plan.Bottleneck}
+	if plan.MaxThroughput >= whatIf.SLA.Throughput {
+		simulation, err := Simulate(layout, whatIf.Mix, whatIf.SLA.Throughput, whatIf.TaskSets, whatIf.Tick, whatIf.Output)
+		if err != nil {
+			return nil, err
+		}
+		candidate.Simulation = &simulation
+		candidate.Meets = simulation.meets(whatIf.SLA)
+	}
+	evaluated[layout] = candidate
+	return candidate, nil
+}
+
+// layout with the fewest resources for the mix: one unit of every resource
+// it uses, and as many workers of a specialization as a station requires
+func (whatIf WhatIf) minimum() (Layout, error) {
+	var layout Layout
+	plan, err := PlanCapacity(layout, FactoryDurations(), whatIf.Mix, 0)
+	if err != nil {
+		return layout, err
+	}
+	units := layout.units()
+	for _, load := range plan.Resources {
+		*units[load.Resource] = 1
+	}
+	for _, required := range stationWorkers {
+		if workers := units[required.specialization+" worker"]; required.n > 0 && *workers > 0 {
+			*workers = max(*workers, required.n)
+		}
+	}
+	return layout, nil
+}
+
+// kinds of resources, the most expensive first
+func (whatIf WhatIf) byCost() []string {
+	var resources []string
+	for resource := range (&Layout{}).units() {
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		a, b := whatIf.Costs[resources[i]], whatIf.Costs[resources[j]]
+		return a > b || a == b && resources[i] < resources[j]
+	})
+	return resources
+}
+
+// table of the ranked candidates
+func (candidates Candidates) String() string {
+	var table strings.Builder
+	fmt.Fprintf(&table, "%4s %-22s %-22s %7s %8s %-18s %10s %5s %5s\n", "rank", "stations P/A/W/Pt/D", "workers A/W/Pt/T", "cost", "planned", "bottleneck", "simulated", "p95", "meets")
+	for i, candidate := range candidates {
+		layout := candidate.Layout
+		stations := fmt.Sprintf("%d/%d/%d/%d/%d", layout.PickupStations, layout.AssemblyStations, layout.WeldingStations, layout.PaintingStations, layout.DropoffStations)
+		workers := fmt.Sprintf("%d/%d/%d/%d", layout.AssemblyWorkers, layout.WeldingWorkers, layout.PaintingWorkers, layout.TransportWorkers)
+		simulated, p95 := "-", "-"
+		if candidate.Simulation != nil {
+			simulated, p95 = fmt.Sprintf("%.3f", candidate.Simulation.Throughput), fmt.Sprint(candidate.Simulation.P95)
+		}
+		meets := "no"
+		if candidate.Meets {
+			meets = "yes"
+		}
+		fmt.Fprintf(&table, "%4d %-22s %-22s %7.1f %8.3f %-18s %10s %5s %5s\n", i+1, stations, workers, candidate.Cost, candidate.Planned, candidate.Bottleneck, simulated, p95, meets)
+	}
+	return table.String()
+}
@@ -0,0 +1,83 @@
+///////////////////////////////////////////////////////////////////////
+/////////////// Automatic Factory Floor using Robots //////////////////
+///////////////////////////////////////////////////////////////////////
+
+// This file contains the test cases for the what-if optimizer
+
+package main
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Test that the optimizer finds the cheapest layout for painting task sets
+func TestOptimize(t *testing.T) {
+	// a task set takes a transport worker for 7 time units, so 0.2 task sets
+	// per time unit take 2 of them, 1 painter and 1 station of each kind suffice
+	whatIf := WhatIf{
+		Mix:      OrderMix{{Route: []string{"pickup", "painting", "dropoff"}, Share: 1}},
+		SLA:      SLA{Throughput: 0.2},
+		Costs:    DefaultUnitCosts(),
+		TaskSets: 80,
+		// a coarse tick keeps the real time the go routines take, e. g. under
+		// the race detector, small against the program time of the tasks
+		Tick: 5 * time.Millisecond,
+	}
+	candidates, err := whatIf.Optimize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("\n%v", candidates)
+
+	want := Layout{PickupStations: 1, PaintingStations: 1, DropoffStations: 1, PaintingWorkers: 1, TransportWorkers: 2}
+	if best := candidates[0]; !best.Meets || best.Layout != want || best.Cost != 46 {
+		t.Errorf("Best candidate is %+v, want %+v for 46", best, want)
+	}
+	for _, candidate := range candidates[1:] {
+		if candidate.Meets && candidate.Cost < candidates[0].Cost {
+			t.Errorf("Candidate %+v is cheaper than the best one", candidate)
+		}
+		if candidate.Planned < whatIf.SLA.Throughput && candidate.Simulation != nil {
+			t.Errorf("Candidate %+v was simulated although the plan misses the throughput", candidate)
+		}
+	}
+
+	if _, err := (WhatIf{Mix: whatIf.Mix}).Optimize(); err == nil {
+		t.Errorf("Optimizer ran without a target throughput")
+	}
+}
+
+// Test that a simulation shuts its factory and its clock down
+func TestSimulateShutdown(t *testing.T) {
+	running := runtime.NumGoroutine()
+	layout := Layout{PickupStations: 1, PaintingStations: 1, DropoffStations: 1, PaintingWorkers: 1, TransportWorkers: 2}
+	mix := OrderMix{{Route: []string{"pickup", "painting", "dropoff"}, Share: 1}}
+	if _, err := Simulate(layout, mix, 0.2, 10, time.Millisecond, nil); err != nil {
+		t.Fatal(err)
+	}
+	// the workers may still be on their way back to the control center
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > running && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if left := runtime.NumGoroutine(); left > running {
+		t.Errorf("%d go routines are left of the simulation", left-running)
+	}
+}
+
+// Test that the routes of the simulated task sets follow the order mix
+func TestOrderMixRoutes(t *testing.T) {
+	mix := OrderMix{{Route: []string{"pickup", "welding", "dropoff"}, Share: 3}, {Route: []string{"pickup", "dropoff"}, Share: 1}}
+	welded := 0
+	for i, share := range mix.spread(40) {
+		if len(share.Route) == 3 {
+			welded++
+		}
+		// the routes are spread evenly, every 4 task sets contain 1 without welding
+		if i%4 == 3 && welded != 3*(i+1)/4 {
+			t.Errorf("%d of the first %d task sets are welded, want %d", welded, i+1, 3*(i+1)/4)
+		}
+	}
+}